@@ -29,15 +29,49 @@ var (
 	// ErrKnowledgeMemoryNotConfigured is returned when an operation is attempted
 	// on an agent that does not have a KnowledgeMemory initialized.
 	ErrKnowledgeMemoryNotConfigured = errors.New("knowledge memory is not configured for this agent")
+
+	// ErrHandoffMemoryNotConfigured is returned when an operation is attempted
+	// on an agent that does not have a HandoffMemory initialized.
+	ErrHandoffMemoryNotConfigured = errors.New("handoff memory is not configured for this agent")
+
+	// ErrStateMemoryNotConfigured is returned when an operation is attempted
+	// on an agent that does not have a StateMemory initialized.
+	ErrStateMemoryNotConfigured = errors.New("state memory is not configured for this agent")
 )
 
+// Runner is implemented by components that process an incoming message and
+// produce a model response, such as Agent and Router.
+type Runner interface {
+	// Name returns the identifier of the runner.
+	Name() string
+
+	// Run processes the given message and returns the resulting model response.
+	Run(ctx context.Context, msg *ai.Message) (*ai.ModelResponse, error)
+}
+
+// StreamRunner is a Runner that can also stream the response while it is generated.
+type StreamRunner interface {
+	Runner
+
+	// RunStream processes the given message like Run, invoking cb with each
+	// chunk of the response as it is generated.
+	RunStream(ctx context.Context, msg *ai.Message, cb ai.ModelStreamCallback) (*ai.ModelResponse, error)
+}
+
+var _ StreamRunner = &Agent{}
+
 // Agent represents a generic AI agent that encapsulates execution logic (flow).
 type Agent struct {
 	config          *AgentConfig
 	knowledgeMemory KnowledgeMemory
 	historyMemory   HistoryMemory
+	stateMemory     StateMemory
+	handoffMemory   HandoffMemory
+
+	conversationLock *conversationLock
+	metrics          *agentMetrics
 
-	flow *core.Flow[*ai.Message, *ai.ModelResponse, struct{}]
+	flow *core.Flow[*ai.Message, *ai.ModelResponse, *ai.ModelResponseChunk]
 }
 
 // NewAgent initializes a new Agent instance. It defines a Genkit flow based on the provided AgentConfig.
@@ -62,18 +96,69 @@ func NewAgent(g *genkit.Genkit, cfg AgentConfig) (*Agent, error) {
 			return nil, err
 		}
 
+		if cfg.KnowledgeMode.useTool() {
+			agent.config.Tools = append(
+				agent.config.Tools,
+				agent.knowledgeMemory.AsTool(),
+			)
+		}
+	}
+
+	// state
+	if cfg.StateProvider != nil {
+		agent.stateMemory, err = cfg.StateProvider.ForAgent(cfg.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tool := range StateTools(cfg.Name, agent.stateMemory) {
+			agent.config.Tools = append(agent.config.Tools, tool)
+		}
+	}
+
+	// handoff
+	if cfg.HandoffProvider != nil {
+		agent.handoffMemory, err = cfg.HandoffProvider.ForAgent(cfg.Name)
+		if err != nil {
+			return nil, err
+		}
+
 		agent.config.Tools = append(
 			agent.config.Tools,
-			agent.knowledgeMemory.AsTool(),
+			RequestHumanTool(cfg.Name, agent.handoffMemory, cfg.HandoffNotifier),
 		)
 	}
 
+	// conversation lock
+	agent.conversationLock = newConversationLock(&cfg)
+
+	// metrics
+	agent.metrics, err = newAgentMetrics(cfg.MeterProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	// system prompt
+	systemPrompt, err := parseSystemPromptTemplate(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	// flow
-	agent.flow = genkit.DefineFlow(g, cfg.Name, baseFlow(g, &cfg, agent.historyMemory))
+	agent.flow = genkit.DefineStreamingFlow(g, cfg.Name, baseFlow(g, agent, systemPrompt))
 
 	return agent, nil
 }
 
+// Description returns the description of the agent defined in its configuration.
+// If the agent or its configuration is nil, it returns an empty string.
+func (agent *Agent) Description() string {
+	if agent == nil || agent.config == nil {
+		return ""
+	}
+	return agent.config.Description
+}
+
 // DeleteKnowledge removes documents associated with a specific label from the agent's memory.
 // It returns ErrKnowledgeMemoryNotConfigured if the agent was not initialized with knowledge capabilities.
 func (agent *Agent) DeleteKnowledge(ctx context.Context, label string) error {
@@ -83,6 +168,33 @@ func (agent *Agent) DeleteKnowledge(ctx context.Context, label string) error {
 	return agent.knowledgeMemory.DeleteKnowledge(ctx, label)
 }
 
+// DeleteState removes a key from the state of the given conversation.
+// It returns ErrStateMemoryNotConfigured if the agent was not initialized with state capabilities.
+func (agent *Agent) DeleteState(ctx context.Context, conversationID string, key string) error {
+	if agent.stateMemory == nil {
+		return ErrStateMemoryNotConfigured
+	}
+	return agent.stateMemory.DeleteState(ctx, conversationID, key)
+}
+
+// GetState returns the key/value state stored for the given conversation.
+// It returns ErrStateMemoryNotConfigured if the agent was not initialized with state capabilities.
+func (agent *Agent) GetState(ctx context.Context, conversationID string) (map[string]any, error) {
+	if agent.stateMemory == nil {
+		return nil, ErrStateMemoryNotConfigured
+	}
+	return agent.stateMemory.GetState(ctx, conversationID)
+}
+
+// IsPaused reports whether the given conversation is paused for a human operator.
+// It returns ErrHandoffMemoryNotConfigured if the agent was not initialized with handoff capabilities.
+func (agent *Agent) IsPaused(ctx context.Context, conversationID string) (bool, error) {
+	if agent.handoffMemory == nil {
+		return false, ErrHandoffMemoryNotConfigured
+	}
+	return agent.handoffMemory.IsPaused(ctx, conversationID)
+}
+
 // IndexKnowledge adds and indexes a set of documents into the agent's memory under a given label.
 // This allows the agent to retrieve this information later during conversations.
 // It returns ErrKnowledgeMemoryNotConfigured if the agent was not initialized with knowledge capabilities.
@@ -102,6 +214,35 @@ func (agent *Agent) Name() string {
 	return agent.config.Name
 }
 
+// SetState stores a value under a key in the state of the given conversation.
+// It returns ErrStateMemoryNotConfigured if the agent was not initialized with state capabilities.
+func (agent *Agent) SetState(ctx context.Context, conversationID string, key string, value any) error {
+	if agent.stateMemory == nil {
+		return ErrStateMemoryNotConfigured
+	}
+	return agent.stateMemory.SetState(ctx, conversationID, key, value)
+}
+
+// Pause hands the given conversation over to a human operator. While paused,
+// the agent stores the incoming messages in the history but does not answer them
+// (the runs return a delegated response, see IsPausedResponse).
+// It returns ErrHandoffMemoryNotConfigured if the agent was not initialized with handoff capabilities.
+func (agent *Agent) Pause(ctx context.Context, conversationID string) error {
+	if agent.handoffMemory == nil {
+		return ErrHandoffMemoryNotConfigured
+	}
+	return agent.handoffMemory.Pause(ctx, conversationID)
+}
+
+// Resume gives the given conversation back to the agent after a human handoff.
+// It returns ErrHandoffMemoryNotConfigured if the agent was not initialized with handoff capabilities.
+func (agent *Agent) Resume(ctx context.Context, conversationID string) error {
+	if agent.handoffMemory == nil {
+		return ErrHandoffMemoryNotConfigured
+	}
+	return agent.handoffMemory.Resume(ctx, conversationID)
+}
+
 // Run executes the agent's internal flow with a given message within the provided context.
 // It returns a *ai.ModelResponse containing the AI's output or an error if execution fails.
 func (agent *Agent) Run(ctx context.Context, msg *ai.Message) (*ai.ModelResponse, error) {
@@ -111,6 +252,26 @@ func (agent *Agent) Run(ctx context.Context, msg *ai.Message) (*ai.ModelResponse
 	return agent.flow.Run(ctx, msg)
 }
 
+// RunStream executes the agent's internal flow like Run, streaming the response.
+// The callback cb is invoked with each chunk of the response as it is generated;
+// if it returns an error, the run is aborted and that error is returned.
+// The conversation history is stored once the stream completes.
+func (agent *Agent) RunStream(ctx context.Context, msg *ai.Message, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+	if agent.flow == nil {
+		return EmptyModelResponse(), ErrAgentNotInitialized
+	}
+	return runFlowStream(ctx, agent.flow, msg, cb)
+}
+
+func runFlowStream(ctx context.Context, flow *core.Flow[*ai.Message, *ai.ModelResponse, *ai.ModelResponseChunk], msg *ai.Message, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+	if cb == nil {
+		return flow.Run(ctx, msg)
+	}
+
+	action := (*core.ActionDef[*ai.Message, *ai.ModelResponse, *ai.ModelResponseChunk])(flow)
+	return action.Run(withStreaming(ctx, true), msg, cb)
+}
+
 // DelegatedModelResponse creates a model response that indicates the message
 // was delegated. This is useful when an agent decides not to handle a message.
 func DelegatedModelResponse() *ai.ModelResponse {
@@ -0,0 +1,170 @@
+package agenstest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/gonzxlezs/agens"
+)
+
+// DefaultGoldenDir is the directory of the golden files when GoldenTest.Dir is not set.
+const DefaultGoldenDir = "testdata/golden"
+
+// UpdateGolden is set by the -update-golden flag of go test. When true, the
+// golden files are rewritten with the replayed outputs instead of compared:
+//
+//	go test ./... -update-golden
+var UpdateGolden = flag.Bool("update-golden", false, "rewrite the agenstest golden files with the replayed outputs")
+
+// GoldenTurn is a turn as stored in a golden file.
+type GoldenTurn struct {
+	Input        string          `json:"input"`
+	FinishReason ai.FinishReason `json:"finishReason,omitempty"`
+	Output       *ai.Message     `json:"output,omitempty"`
+}
+
+// GoldenTest replays transcripts through a runner and compares the outputs to
+// golden files, one per transcript (<Dir>/<transcript name>.golden.json).
+type GoldenTest struct {
+	// Runner is the agent (or router) under test.
+	Runner agens.Runner
+
+	// Model is the replay model of the runner, if any. It is loaded with each
+	// transcript before it is replayed.
+	Model *ReplayModel
+
+	// Dir is the directory of the golden files. Defaults to DefaultGoldenDir.
+	Dir string
+
+	// Matcher compares the outputs. Defaults to Exact.
+	Matcher Matcher
+
+	// Context is the context of the runs. Defaults to context.Background.
+	Context context.Context
+}
+
+// Run replays each transcript in a subtest named after it.
+func (gt *GoldenTest) Run(t *testing.T, transcripts ...*Transcript) {
+	t.Helper()
+
+	for _, transcript := range transcripts {
+		t.Run(transcript.Name, func(t *testing.T) {
+			if err := gt.check(transcript); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func (gt *GoldenTest) check(transcript *Transcript) error {
+	ctx := gt.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if gt.Model != nil {
+		gt.Model.Load(transcript)
+	}
+
+	turns, err := Replay(ctx, gt.Runner, transcript)
+	if err != nil {
+		return fmt.Errorf("error replaying transcript %s: %w", transcript.Name, err)
+	}
+
+	path := gt.path(transcript)
+	if *UpdateGolden {
+		return WriteGolden(path, turns)
+	}
+
+	golden, err := ReadGolden(path)
+	if err != nil {
+		return fmt.Errorf("%w (run go test with -update-golden to create it)", err)
+	}
+
+	return gt.compare(ctx, golden, turns)
+}
+
+func (gt *GoldenTest) compare(ctx context.Context, golden []GoldenTurn, turns []Turn) error {
+	if len(golden) != len(turns) {
+		return fmt.Errorf("expected %d turns, got %d", len(golden), len(turns))
+	}
+
+	matcher := gt.Matcher
+	if matcher == nil {
+		matcher = Exact()
+	}
+
+	var errs []error
+	for i, turn := range turns {
+		expected := golden[i]
+
+		if expected.FinishReason != turn.FinishReason {
+			errs = append(errs, fmt.Errorf("turn %d (%q): expected finish reason %q, got %q",
+				i+1, expected.Input, expected.FinishReason, turn.FinishReason))
+			continue
+		}
+
+		if (expected.Output == nil) && (turn.Output == nil) {
+			continue
+		}
+
+		if err := matcher.Match(ctx, expected.Output, turn.Output); err != nil {
+			errs = append(errs, fmt.Errorf("turn %d (%q): %w", i+1, expected.Input, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (gt *GoldenTest) path(transcript *Transcript) string {
+	dir := gt.Dir
+	if dir == "" {
+		dir = DefaultGoldenDir
+	}
+	return filepath.Join(dir, transcript.Name+".golden.json")
+}
+
+// ReadGolden reads the turns of a golden file.
+func ReadGolden(path string) ([]GoldenTurn, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var golden []GoldenTurn
+	if err := json.Unmarshal(b, &golden); err != nil {
+		return nil, fmt.Errorf("error parsing golden file %s: %w", path, err)
+	}
+	return golden, nil
+}
+
+// WriteGolden writes the turns to a golden file, creating its directory if needed.
+func WriteGolden(path string, turns []Turn) error {
+	golden := make([]GoldenTurn, 0, len(turns))
+	for _, turn := range turns {
+		golden = append(golden, GoldenTurn{
+			Input:        messageText(turn.Input),
+			FinishReason: turn.FinishReason,
+			Output:       turn.Output,
+		})
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(golden); err != nil {
+		return fmt.Errorf("error serializing golden file: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
@@ -0,0 +1,115 @@
+package agenstest_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/gonzxlezs/agens"
+	"github.com/gonzxlezs/agens/agenstest"
+)
+
+const transcriptPath = "testdata/transcripts/opening_hours.jsonl"
+
+// newReplayAgent creates an agent answered by a replay model, with a fresh history.
+func newReplayAgent(t *testing.T) (*agens.Agent, *agenstest.ReplayModel) {
+	t.Helper()
+
+	g := genkit.Init(context.Background())
+	model := agenstest.DefineReplayModel(g, "")
+
+	agent, err := agens.NewAgent(g, agens.AgentConfig{
+		Name:            "replayer",
+		Model:           model,
+		HistoryProvider: &agenstest.HistoryMemory{},
+	})
+	if err != nil {
+		t.Fatalf("NewAgent: %v", err)
+	}
+	return agent, model
+}
+
+func loadTranscript(t *testing.T) *agenstest.Transcript {
+	t.Helper()
+
+	transcript, err := agenstest.LoadTranscript(transcriptPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return transcript
+}
+
+func TestReplay(t *testing.T) {
+	agent, model := newReplayAgent(t)
+	transcript := loadTranscript(t)
+	model.Load(transcript)
+
+	turns, err := agenstest.Replay(context.Background(), agent, transcript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"Hello! How can I help you?", "The store opens at 9am."}
+	if len(turns) != len(want) {
+		t.Fatalf("replayed %d turns, want %d", len(turns), len(want))
+	}
+	for i, turn := range turns {
+		if turn.Output.Text() != want[i] || turn.FinishReason != ai.FinishReasonStop {
+			t.Errorf("turn %d = %q (%s), want %q", i+1, turn.Output.Text(), turn.FinishReason, want[i])
+		}
+	}
+
+	// the second request carries the first turn as history
+	requests := model.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("the model got %d requests, want 2", len(requests))
+	}
+	messages := requests[1].Messages
+	if n := len(messages); (n < 3) || (messages[n-2].Text() != want[0]) {
+		t.Errorf("the second request has no history")
+	}
+	if model.Remaining() != 0 {
+		t.Errorf("%d responses left", model.Remaining())
+	}
+
+	// the responses are exhausted
+	if _, err := agenstest.Replay(context.Background(), agent, transcript); !errors.Is(err, agenstest.ErrNoRecordedResponse) {
+		t.Errorf("err = %v, want %v", err, agenstest.ErrNoRecordedResponse)
+	}
+}
+
+func TestGoldenTest(t *testing.T) {
+	agent, model := newReplayAgent(t)
+
+	gt := &agenstest.GoldenTest{Runner: agent, Model: model}
+	gt.Run(t, loadTranscript(t))
+}
+
+func TestGoldenTestUpdate(t *testing.T) {
+	update := *agenstest.UpdateGolden
+	t.Cleanup(func() { *agenstest.UpdateGolden = update })
+
+	dir := t.TempDir()
+	agent, model := newReplayAgent(t)
+	gt := &agenstest.GoldenTest{Runner: agent, Model: model, Dir: dir}
+
+	*agenstest.UpdateGolden = true
+	gt.Run(t, loadTranscript(t))
+
+	golden, err := agenstest.ReadGolden(filepath.Join(dir, "opening_hours.golden.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(golden) != 2 || golden[1].Input != "When does the store open?" || golden[1].Output.Text() != "The store opens at 9am." {
+		t.Errorf("golden = %+v", golden)
+	}
+
+	// the written file matches a new replay, with a fresh history
+	*agenstest.UpdateGolden = false
+	agent, model = newReplayAgent(t)
+	gt = &agenstest.GoldenTest{Runner: agent, Model: model, Dir: dir}
+	gt.Run(t, loadTranscript(t))
+}
@@ -0,0 +1,142 @@
+package agenstest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// DefaultJudgePrompt is the prompt format of the Judge matcher: the criteria,
+// the expected response and the actual response.
+const DefaultJudgePrompt = `You are grading the response of an AI agent against a reference response.
+Criteria: %s
+
+Reference response:
+%s
+
+Actual response:
+%s
+
+Decide whether the actual response meets the criteria when compared with the reference.`
+
+// Matcher compares the output of a replayed turn with the golden one.
+type Matcher interface {
+	// Match returns an error describing the mismatch, or nil if actual matches expected.
+	Match(ctx context.Context, expected *ai.Message, actual *ai.Message) error
+}
+
+// MatcherFunc is a Matcher built from a function.
+type MatcherFunc func(ctx context.Context, expected *ai.Message, actual *ai.Message) error
+
+// Match calls the function.
+func (fn MatcherFunc) Match(ctx context.Context, expected *ai.Message, actual *ai.Message) error {
+	return fn(ctx, expected, actual)
+}
+
+func messageText(msg *ai.Message) string {
+	if msg == nil {
+		return ""
+	}
+	return msg.Text()
+}
+
+// Exact matches when both messages have the same text.
+func Exact() Matcher {
+	return MatcherFunc(func(_ context.Context, expected *ai.Message, actual *ai.Message) error {
+		if e, a := messageText(expected), messageText(actual); e != a {
+			return fmt.Errorf("text mismatch:\nexpected: %q\nactual:   %q", e, a)
+		}
+		return nil
+	})
+}
+
+// Contains matches when the text of the actual message contains every
+// substring. Without substrings, it must contain the expected text.
+func Contains(substrings ...string) Matcher {
+	return MatcherFunc(func(_ context.Context, expected *ai.Message, actual *ai.Message) error {
+		subs := substrings
+		if len(subs) == 0 {
+			subs = []string{messageText(expected)}
+		}
+
+		text := messageText(actual)
+		for _, sub := range subs {
+			if !strings.Contains(text, sub) {
+				return fmt.Errorf("%q does not contain %q", text, sub)
+			}
+		}
+		return nil
+	})
+}
+
+// JSONSchema matches when the text of the actual message is a JSON document
+// valid against the schema, given as a map, a struct or a JSON string.
+// The expected message is ignored.
+func JSONSchema(schema any) Matcher {
+	var loader gojsonschema.JSONLoader
+	if s, ok := schema.(string); ok {
+		loader = gojsonschema.NewStringLoader(s)
+	} else {
+		loader = gojsonschema.NewGoLoader(schema)
+	}
+
+	return MatcherFunc(func(_ context.Context, _ *ai.Message, actual *ai.Message) error {
+		result, err := gojsonschema.Validate(loader, gojsonschema.NewStringLoader(messageText(actual)))
+		if err != nil {
+			return fmt.Errorf("error validating JSON output: %w", err)
+		}
+
+		if !result.Valid() {
+			errs := make([]error, 0, len(result.Errors()))
+			for _, e := range result.Errors() {
+				errs = append(errs, errors.New(e.String()))
+			}
+			return fmt.Errorf("invalid JSON output: %w", errors.Join(errs...))
+		}
+		return nil
+	})
+}
+
+// Verdict is the output of the Judge model.
+type Verdict struct {
+	Pass   bool   `json:"pass" jsonschema_description:"Whether the actual response meets the criteria."`
+	Reason string `json:"reason" jsonschema_description:"Short explanation of the verdict."`
+}
+
+// Judge matches when a model, used as a judge, decides that the actual
+// message meets the criteria compared with the expected one (see DefaultJudgePrompt).
+// It suits responses that vary between runs, such as those of real models.
+func Judge(g *genkit.Genkit, model ai.ModelArg, criteria string) Matcher {
+	return MatcherFunc(func(ctx context.Context, expected *ai.Message, actual *ai.Message) error {
+		verdict, _, err := genkit.GenerateData[Verdict](ctx, g,
+			ai.WithModel(model),
+			ai.WithPrompt(DefaultJudgePrompt, criteria, messageText(expected), messageText(actual)),
+		)
+		if err != nil {
+			return fmt.Errorf("error judging the response: %w", err)
+		}
+
+		if !verdict.Pass {
+			return fmt.Errorf("rejected by the judge: %s", verdict.Reason)
+		}
+		return nil
+	})
+}
+
+// All matches when every matcher matches.
+func All(matchers ...Matcher) Matcher {
+	return MatcherFunc(func(ctx context.Context, expected *ai.Message, actual *ai.Message) error {
+		var errs []error
+		for _, m := range matchers {
+			if err := m.Match(ctx, expected, actual); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
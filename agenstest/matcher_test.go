@@ -0,0 +1,81 @@
+package agenstest_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/gonzxlezs/agens/agenstest"
+)
+
+func TestMatchers(t *testing.T) {
+	schema := `{
+		"type": "object",
+		"properties": {"opens": {"type": "string"}},
+		"required": ["opens"]
+	}`
+
+	tests := []struct {
+		name     string
+		matcher  agenstest.Matcher
+		expected string
+		actual   string
+		mismatch string
+	}{
+		{"exact", agenstest.Exact(), "Opens at 9am.", "Opens at 9am.", ""},
+		{"exact mismatch", agenstest.Exact(), "Opens at 9am.", "Opens at 10am.", "text mismatch"},
+		{"contains expected", agenstest.Contains(), "9am", "It opens at 9am.", ""},
+		{"contains substrings", agenstest.Contains("opens", "9am"), "", "It opens at 9am.", ""},
+		{"contains mismatch", agenstest.Contains("opens", "10am"), "", "It opens at 9am.", `does not contain "10am"`},
+		{"json schema", agenstest.JSONSchema(schema), "", `{"opens": "9am"}`, ""},
+		{"json schema mismatch", agenstest.JSONSchema(schema), "", `{"closes": "5pm"}`, "invalid JSON output"},
+		{"all", agenstest.All(agenstest.Contains("9am"), agenstest.JSONSchema(schema)), "", `{"opens": "9am"}`, ""},
+		{"all mismatch", agenstest.All(agenstest.Contains("9am"), agenstest.Exact()), "Opens at 9am.", "It opens at 9am.", "text mismatch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.matcher.Match(context.Background(), ai.NewModelTextMessage(tt.expected), ai.NewModelTextMessage(tt.actual))
+
+			switch {
+			case (tt.mismatch == "") && (err != nil):
+				t.Errorf("unexpected mismatch: %v", err)
+			case (tt.mismatch != "") && (err == nil):
+				t.Errorf("expected a mismatch")
+			case (tt.mismatch != "") && !strings.Contains(err.Error(), tt.mismatch):
+				t.Errorf("mismatch = %v, want %q", err, tt.mismatch)
+			}
+		})
+	}
+}
+
+func TestJudge(t *testing.T) {
+	g := genkit.Init(context.Background())
+	model := agenstest.DefineFakeModel(g, "")
+	judge := agenstest.Judge(g, model, "gives the opening time")
+
+	expected := ai.NewModelTextMessage("The store opens at 9am.")
+	actual := ai.NewModelTextMessage("We open at nine.")
+
+	model.ReplyJSON(agenstest.Verdict{Pass: true, Reason: "same time"})
+	if err := judge.Match(context.Background(), expected, actual); err != nil {
+		t.Errorf("unexpected mismatch: %v", err)
+	}
+
+	// the judge is given the criteria and both responses
+	prompt := model.LastRequest().Messages
+	text := prompt[len(prompt)-1].Text()
+	for _, want := range []string{"gives the opening time", expected.Text(), actual.Text()} {
+		if !strings.Contains(text, want) {
+			t.Errorf("judge prompt does not contain %q", want)
+		}
+	}
+
+	model.ReplyJSON(agenstest.Verdict{Pass: false, Reason: "no time given"})
+	err := judge.Match(context.Background(), expected, ai.NewModelTextMessage("Hello!"))
+	if (err == nil) || !strings.Contains(err.Error(), "no time given") {
+		t.Errorf("mismatch = %v, want the reason of the judge", err)
+	}
+}
@@ -0,0 +1,322 @@
+package agenstest
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/gonzxlezs/agens"
+)
+
+var (
+	_ agens.HistoryProvider       = &HistoryMemory{}
+	_ agens.HistoryMemory         = &HistoryMemory{}
+	_ agens.HistoryMessageDeleter = &HistoryMemory{}
+	_ agens.KnowledgeProvider     = &KnowledgeMemory{}
+	_ agens.KnowledgeMemory       = &KnowledgeMemory{}
+)
+
+// Call is a call received by a fake.
+type Call struct {
+	// Method is the name of the method called.
+	Method string
+
+	// Key is the main argument of the call: the conversation ID, the label or the query.
+	Key string
+}
+
+// HistoryMemory is an in-memory HistoryMemory that records its calls. It is
+// also a HistoryProvider that returns itself, so it can be set as the
+// HistoryProvider of an agent and inspected afterwards. Like the persistent
+// memories, it sets the StoredIDKey of the messages it returns and skips the
+// messages that already have one when storing.
+type HistoryMemory struct {
+	// Err, if set, is returned by every method.
+	Err error
+
+	mu            sync.Mutex
+	calls         []Call
+	agentName     string
+	maxMessages   int
+	nextID        int
+	conversations map[string][]*ai.Message
+}
+
+func (h *HistoryMemory) ForAgent(agentName string, maxMessagesPerConversation int) (agens.HistoryMemory, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.agentName = agentName
+	h.maxMessages = maxMessagesPerConversation
+	return h, h.Err
+}
+
+func (h *HistoryMemory) RetrieveHistory(_ context.Context, conversationID string) ([]*ai.Message, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.calls = append(h.calls, Call{Method: "RetrieveHistory", Key: conversationID})
+	if h.Err != nil {
+		return nil, h.Err
+	}
+
+	history := h.conversations[conversationID]
+	if (h.maxMessages > 0) && (len(history) > h.maxMessages) {
+		history = history[len(history)-h.maxMessages:]
+	}
+
+	messages := make([]*ai.Message, 0, len(history))
+	for _, msg := range history {
+		messages = append(messages, cloneMessage(msg))
+	}
+	return messages, nil
+}
+
+func (h *HistoryMemory) StoreHistory(_ context.Context, conversationID string, messages []*ai.Message) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.calls = append(h.calls, Call{Method: "StoreHistory", Key: conversationID})
+	if h.Err != nil {
+		return h.Err
+	}
+
+	if h.conversations == nil {
+		h.conversations = make(map[string][]*ai.Message)
+	}
+
+	for _, msg := range messages {
+		if msg.Role == ai.RoleSystem {
+			continue
+		}
+		if storedID, _ := agens.GetStoredID(msg); storedID != "" {
+			continue
+		}
+
+		h.nextID++
+		stored := agens.SetStoredID(cloneMessage(msg), strconv.Itoa(h.nextID))
+		h.conversations[conversationID] = append(h.conversations[conversationID], stored)
+	}
+	return nil
+}
+
+func (h *HistoryMemory) DeleteHistory(_ context.Context, conversationID string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.calls = append(h.calls, Call{Method: "DeleteHistory", Key: conversationID})
+	if h.Err != nil {
+		return h.Err
+	}
+
+	delete(h.conversations, conversationID)
+	return nil
+}
+
+func (h *HistoryMemory) DeleteMessages(_ context.Context, conversationID string, storedIDs []string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.calls = append(h.calls, Call{Method: "DeleteMessages", Key: conversationID})
+	if h.Err != nil {
+		return h.Err
+	}
+
+	messages, ok := h.conversations[conversationID]
+	if !ok {
+		return nil
+	}
+
+	h.conversations[conversationID] = slices.DeleteFunc(slices.Clone(messages), func(msg *ai.Message) bool {
+		storedID, _ := agens.GetStoredID(msg)
+		return slices.Contains(storedIDs, storedID)
+	})
+	return nil
+}
+
+func (_ *HistoryMemory) Close() error {
+	return nil
+}
+
+// AgentName returns the name of the agent the memory was created for.
+func (h *HistoryMemory) AgentName() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.agentName
+}
+
+// Messages returns all the stored messages of a conversation.
+func (h *HistoryMemory) Messages(conversationID string) []*ai.Message {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return slices.Clone(h.conversations[conversationID])
+}
+
+// Seed stores messages in a conversation, e.g. to start a test with some history.
+func (h *HistoryMemory) Seed(conversationID string, messages ...*ai.Message) {
+	_ = h.StoreHistory(context.Background(), conversationID, messages)
+}
+
+// Calls returns the calls received by the memory.
+func (h *HistoryMemory) Calls() []Call {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return slices.Clone(h.calls)
+}
+
+// KnowledgeMemory is an in-memory KnowledgeMemory that records its calls. It
+// is also a KnowledgeProvider that returns itself. Documents are retrieved by
+// the number of query words they contain, so tests do not need an embedder.
+type KnowledgeMemory struct {
+	// Err, if set, is returned by every method.
+	Err error
+
+	mu        sync.Mutex
+	calls     []Call
+	agentName string
+	limit     int
+	documents map[string][]*ai.Document
+	tool      ai.Tool
+}
+
+func (k *KnowledgeMemory) ForAgent(agentName string, limit int) (agens.KnowledgeMemory, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.agentName = agentName
+	k.limit = limit
+	k.tool = nil
+	return k, k.Err
+}
+
+// KnowledgeQuery is the input of the tool of the fake knowledge memory.
+type KnowledgeQuery struct {
+	Query string `json:"query" jsonschema_description:"The query to search in the knowledge base."`
+}
+
+func (k *KnowledgeMemory) AsTool() ai.Tool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.tool == nil {
+		k.tool = ai.NewTool(
+			fmt.Sprintf("%s_knowledge_tool", k.agentName),
+			"Searches the knowledge base.",
+			func(ctx *ai.ToolContext, input KnowledgeQuery) ([]string, error) {
+				docs, err := k.RetrieveKnowledge(ctx, input.Query)
+				if err != nil {
+					return nil, err
+				}
+
+				results := make([]string, 0, len(docs))
+				for _, doc := range docs {
+					results = append(results, documentText(doc))
+				}
+				return results, nil
+			},
+		)
+	}
+	return k.tool
+}
+
+func (k *KnowledgeMemory) DeleteKnowledge(_ context.Context, label string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.calls = append(k.calls, Call{Method: "DeleteKnowledge", Key: label})
+	if k.Err != nil {
+		return k.Err
+	}
+
+	delete(k.documents, label)
+	return nil
+}
+
+func (k *KnowledgeMemory) IndexKnowledge(_ context.Context, label string, docs []*ai.Document) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.calls = append(k.calls, Call{Method: "IndexKnowledge", Key: label})
+	if k.Err != nil {
+		return k.Err
+	}
+
+	if k.documents == nil {
+		k.documents = make(map[string][]*ai.Document)
+	}
+	k.documents[label] = append(k.documents[label], docs...)
+	return nil
+}
+
+func (k *KnowledgeMemory) RetrieveKnowledge(_ context.Context, query string) ([]*ai.Document, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.calls = append(k.calls, Call{Method: "RetrieveKnowledge", Key: query})
+	if k.Err != nil {
+		return nil, k.Err
+	}
+
+	type scored struct {
+		doc   *ai.Document
+		score int
+	}
+
+	words := strings.Fields(strings.ToLower(query))
+
+	var results []scored
+	for _, label := range slices.Sorted(maps.Keys(k.documents)) {
+		for _, doc := range k.documents[label] {
+			text := strings.ToLower(documentText(doc))
+
+			score := 0
+			for _, word := range words {
+				if strings.Contains(text, word) {
+					score++
+				}
+			}
+			if score > 0 {
+				results = append(results, scored{doc, score})
+			}
+		}
+	}
+
+	slices.SortStableFunc(results, func(a, b scored) int {
+		return b.score - a.score
+	})
+	if (k.limit > 0) && (len(results) > k.limit) {
+		results = results[:k.limit]
+	}
+
+	docs := make([]*ai.Document, 0, len(results))
+	for _, r := range results {
+		docs = append(docs, r.doc)
+	}
+	return docs, nil
+}
+
+// Calls returns the calls received by the memory.
+func (k *KnowledgeMemory) Calls() []Call {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return slices.Clone(k.calls)
+}
+
+func documentText(doc *ai.Document) string {
+	var b strings.Builder
+	for _, part := range doc.Content {
+		if part.IsText() {
+			b.WriteString(part.Text)
+		}
+	}
+	return b.String()
+}
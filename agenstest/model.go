@@ -0,0 +1,285 @@
+package agenstest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// DefaultFakeModelName is the name of the model defined by DefineFakeModel
+// when no name is given.
+const DefaultFakeModelName = "agenstest/fake"
+
+var (
+	// ErrNoScriptedResponse is returned by the fake model when it is called
+	// more times than there are scripted responses.
+	ErrNoScriptedResponse = errors.New("no scripted response left")
+
+	// ErrUnexpectedRequest wraps the errors of the request assertions of the fake model.
+	ErrUnexpectedRequest = errors.New("unexpected model request")
+)
+
+// RequestCheck asserts a request received by the fake model.
+type RequestCheck func(req *ai.ModelRequest) error
+
+// FakeResponse is a scripted response of the fake model.
+type FakeResponse struct {
+	// Message is the model message returned.
+	Message *ai.Message
+
+	// Err, if set, is returned instead of the message.
+	Err error
+
+	// Usage is the token usage reported with the message.
+	Usage *ai.GenerationUsage
+
+	// Checks assert the request that gets this response. If one fails, the
+	// model returns an error wrapping ErrUnexpectedRequest.
+	Checks []RequestCheck
+}
+
+// FakeModel is a scriptable Genkit model: it returns the queued responses in
+// order and records the requests it receives.
+//
+//	model := agenstest.DefineFakeModel(g, "")
+//	model.CallTool("get_weather", map[string]any{"city": "Lima"}).
+//		Reply("It is sunny in Lima.").
+//		ExpectLastMessage(ai.RoleTool)
+type FakeModel struct {
+	ai.Model
+
+	mu        sync.Mutex
+	responses []*FakeResponse
+	requests  []*ai.ModelRequest
+}
+
+// DefineFakeModel defines a fake model in Genkit. The agents under test
+// should use it as their Model. If name is empty, DefaultFakeModelName is used.
+func DefineFakeModel(g *genkit.Genkit, name string) *FakeModel {
+	if name == "" {
+		name = DefaultFakeModelName
+	}
+
+	m := &FakeModel{}
+	m.Model = genkit.DefineModel(g, name, &ai.ModelOptions{Supports: testModelSupports}, m.generate)
+	return m
+}
+
+// Enqueue appends responses to the script.
+func (m *FakeModel) Enqueue(responses ...*FakeResponse) *FakeModel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.responses = append(m.responses, responses...)
+	return m
+}
+
+// Reply queues a text response.
+func (m *FakeModel) Reply(text string) *FakeModel {
+	return m.Enqueue(&FakeResponse{Message: ai.NewModelTextMessage(text)})
+}
+
+// ReplyJSON queues a response whose text is v encoded as JSON, e.g. for agents
+// with a structured output.
+func (m *FakeModel) ReplyJSON(v any) *FakeModel {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return m.Fail(fmt.Errorf("error serializing scripted response: %w", err))
+	}
+	return m.Reply(string(b))
+}
+
+// CallTool queues a response that requests a tool call. Genkit runs the tool
+// and calls the model again with its output, which gets the next response.
+func (m *FakeModel) CallTool(name string, input any) *FakeModel {
+	return m.CallTools(&ai.ToolRequest{Name: name, Input: input})
+}
+
+// CallTools queues a response that requests several tool calls at once.
+// Tool requests without Ref get one, so their outputs can be told apart.
+func (m *FakeModel) CallTools(requests ...*ai.ToolRequest) *FakeModel {
+	parts := make([]*ai.Part, 0, len(requests))
+	for i, req := range requests {
+		if req.Ref == "" {
+			req.Ref = fmt.Sprintf("%d", i)
+		}
+		parts = append(parts, ai.NewToolRequestPart(req))
+	}
+	return m.Enqueue(&FakeResponse{Message: ai.NewMessage(ai.RoleModel, nil, parts...)})
+}
+
+// Fail queues an error.
+func (m *FakeModel) Fail(err error) *FakeModel {
+	return m.Enqueue(&FakeResponse{Err: err})
+}
+
+// Expect adds request assertions to the last queued response.
+func (m *FakeModel) Expect(checks ...RequestCheck) *FakeModel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.responses) > 0 {
+		last := m.responses[len(m.responses)-1]
+		last.Checks = append(last.Checks, checks...)
+	}
+	return m
+}
+
+// ExpectLastMessage asserts that the last message of the request has the role
+// and contains every substring.
+func (m *FakeModel) ExpectLastMessage(role ai.Role, substrings ...string) *FakeModel {
+	return m.Expect(LastMessageIs(role, substrings...))
+}
+
+// Requests returns the requests received by the model.
+func (m *FakeModel) Requests() []*ai.ModelRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]*ai.ModelRequest(nil), m.requests...)
+}
+
+// LastRequest returns the last request received by the model, or nil.
+func (m *FakeModel) LastRequest() *ai.ModelRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.requests) == 0 {
+		return nil
+	}
+	return m.requests[len(m.requests)-1]
+}
+
+// Remaining returns the number of scripted responses not returned yet.
+func (m *FakeModel) Remaining() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.responses)
+}
+
+// Reset forgets the script and the received requests.
+func (m *FakeModel) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.responses = nil
+	m.requests = nil
+}
+
+func (m *FakeModel) generate(ctx context.Context, req *ai.ModelRequest, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+	m.mu.Lock()
+	m.requests = append(m.requests, req)
+	if len(m.responses) == 0 {
+		m.mu.Unlock()
+		return nil, ErrNoScriptedResponse
+	}
+
+	scripted := m.responses[0]
+	m.responses = m.responses[1:]
+	m.mu.Unlock()
+
+	for _, check := range scripted.Checks {
+		if err := check(req); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrUnexpectedRequest, err)
+		}
+	}
+
+	if scripted.Err != nil {
+		return nil, scripted.Err
+	}
+
+	resp, err := modelResponse(ctx, req, cloneMessage(scripted.Message), cb)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Usage = scripted.Usage
+	return resp, nil
+}
+
+// LastMessageIs asserts that the last message of the request has the role and
+// contains every substring. The outputs of tool responses are matched as JSON.
+func LastMessageIs(role ai.Role, substrings ...string) RequestCheck {
+	return func(req *ai.ModelRequest) error {
+		if len(req.Messages) == 0 {
+			return errors.New("the request has no messages")
+		}
+
+		last := req.Messages[len(req.Messages)-1]
+		if last.Role != role {
+			return fmt.Errorf("last message role is %q, expected %q", last.Role, role)
+		}
+
+		text := contentText(last)
+		for _, sub := range substrings {
+			if !strings.Contains(text, sub) {
+				return fmt.Errorf("%q does not contain %q", text, sub)
+			}
+		}
+		return nil
+	}
+}
+
+// SystemContains asserts that the system message of the request contains every substring.
+func SystemContains(substrings ...string) RequestCheck {
+	return func(req *ai.ModelRequest) error {
+		for _, msg := range req.Messages {
+			if msg.Role == ai.RoleSystem {
+				return Contains(substrings...).Match(context.Background(), nil, msg)
+			}
+		}
+		return errors.New("the request has no system message")
+	}
+}
+
+// HasTool asserts that the tools of the request include the named ones.
+func HasTool(names ...string) RequestCheck {
+	return func(req *ai.ModelRequest) error {
+		for _, name := range names {
+			found := false
+			for _, tool := range req.Tools {
+				if tool.Name == name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("tool %q not in the request", name)
+			}
+		}
+		return nil
+	}
+}
+
+// MessageCount asserts the number of messages of the request, including the system message.
+func MessageCount(n int) RequestCheck {
+	return func(req *ai.ModelRequest) error {
+		if len(req.Messages) != n {
+			return fmt.Errorf("the request has %d messages, expected %d", len(req.Messages), n)
+		}
+		return nil
+	}
+}
+
+// contentText returns the text of the message followed by the outputs of its
+// tool responses encoded as JSON.
+func contentText(msg *ai.Message) string {
+	var b strings.Builder
+	for _, part := range msg.Content {
+		switch {
+		case part.IsText():
+			b.WriteString(part.Text)
+		case part.IsToolResponse():
+			out, _ := json.Marshal(part.ToolResponse.Output)
+			b.Write(out)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,162 @@
+package agenstest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/gonzxlezs/agens"
+)
+
+// DefaultReplayModelName is the name of the model defined by DefineReplayModel
+// when no name is given.
+const DefaultReplayModelName = "agenstest/replay"
+
+// ErrNoRecordedResponse is returned by the replay model when it is called more
+// times than there are recorded model messages.
+var ErrNoRecordedResponse = errors.New("no recorded response left to replay")
+
+// testModelSupports are the capabilities declared by the test models, so
+// Genkit passes every request to them as is.
+var testModelSupports = &ai.ModelSupports{
+	Multiturn:   true,
+	Tools:       true,
+	ToolChoice:  true,
+	SystemRole:  true,
+	Media:       true,
+	Constrained: ai.ConstrainedSupportAll,
+}
+
+// ReplayModel is a Genkit model that answers with the recorded model messages
+// of a transcript, in order. It lets an agent be replayed without calling a
+// real model, e.g. to check the flow, the tools or the triggers.
+type ReplayModel struct {
+	ai.Model
+
+	mu        sync.Mutex
+	responses []*ai.Message
+	requests  []*ai.ModelRequest
+}
+
+// DefineReplayModel defines a replay model in Genkit. The agents under test
+// should use it as their Model. If name is empty, DefaultReplayModelName is used.
+func DefineReplayModel(g *genkit.Genkit, name string) *ReplayModel {
+	if name == "" {
+		name = DefaultReplayModelName
+	}
+
+	m := &ReplayModel{}
+	m.Model = genkit.DefineModel(g, name, &ai.ModelOptions{Supports: testModelSupports}, m.generate)
+	return m
+}
+
+// Load replaces the queued responses with the model messages of the transcript
+// and forgets the received requests.
+func (m *ReplayModel) Load(transcript *Transcript) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.responses = transcript.ModelMessages()
+	m.requests = nil
+}
+
+// Remaining returns the number of recorded responses not replayed yet.
+func (m *ReplayModel) Remaining() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.responses)
+}
+
+// Requests returns the requests received since the last Load.
+func (m *ReplayModel) Requests() []*ai.ModelRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]*ai.ModelRequest(nil), m.requests...)
+}
+
+func (m *ReplayModel) generate(ctx context.Context, req *ai.ModelRequest, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+	m.mu.Lock()
+	m.requests = append(m.requests, req)
+	if len(m.responses) == 0 {
+		m.mu.Unlock()
+		return nil, ErrNoRecordedResponse
+	}
+
+	msg := cloneMessage(m.responses[0])
+	m.responses = m.responses[1:]
+	m.mu.Unlock()
+
+	return modelResponse(ctx, req, msg, cb)
+}
+
+// modelResponse builds the response of a test model, streaming the message as
+// a single chunk if requested.
+func modelResponse(ctx context.Context, req *ai.ModelRequest, msg *ai.Message, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+	if cb != nil {
+		err := cb(ctx, &ai.ModelResponseChunk{Role: ai.RoleModel, Content: msg.Content})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &ai.ModelResponse{
+		Request:      req,
+		Message:      msg,
+		FinishReason: ai.FinishReasonStop,
+	}, nil
+}
+
+// cloneMessage deep copies a message, so the recorded messages are not
+// modified by the agent under test.
+func cloneMessage(msg *ai.Message) *ai.Message {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return msg
+	}
+
+	var clone ai.Message
+	if err := json.Unmarshal(b, &clone); err != nil {
+		return msg
+	}
+	return &clone
+}
+
+// Turn is the result of running one input message of a transcript.
+type Turn struct {
+	// Input is the user message that was run.
+	Input *ai.Message
+
+	// FinishReason is the finish reason of the response.
+	FinishReason ai.FinishReason
+
+	// Output is the response message. It is nil if the run returned no message,
+	// e.g. when the input was batched with the following messages.
+	Output *ai.Message
+}
+
+// Replay runs every user message of the transcript through the runner, in
+// order, and returns the turns. The runner should have a fresh history memory,
+// so previous replays do not leak into the conversation.
+func Replay(ctx context.Context, runner agens.Runner, transcript *Transcript) ([]Turn, error) {
+	inputs := transcript.Inputs()
+
+	turns := make([]Turn, 0, len(inputs))
+	for _, input := range inputs {
+		resp, err := runner.Run(ctx, cloneMessage(input))
+		if err != nil {
+			return turns, err
+		}
+
+		turns = append(turns, Turn{
+			Input:        input,
+			FinishReason: resp.FinishReason,
+			Output:       resp.Message,
+		})
+	}
+	return turns, nil
+}
@@ -0,0 +1,123 @@
+// Package agenstest provides helpers to test agents and the components built
+// on agens: a scriptable fake model, in-memory fakes of the memories and the
+// triggers, and recorded transcripts replayed through an agent and compared to
+// golden files.
+package agenstest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// Transcript is a recorded conversation.
+type Transcript struct {
+	// Name identifies the transcript, and its golden file. LoadTranscript sets
+	// it to the file name without the extension.
+	Name string
+
+	// Messages are the messages of the conversation in order, with their
+	// metadata (source, channel ID, user ID...). The user messages are the
+	// inputs of the replay and the model messages are the recorded responses
+	// (see ReplayModel).
+	Messages []*ai.Message
+}
+
+// LoadTranscript reads a transcript from a JSONL file with one ai.Message per line.
+// Empty lines are ignored.
+func LoadTranscript(path string) (*Transcript, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	transcript := &Transcript{
+		Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var msg ai.Message
+		if err := json.Unmarshal([]byte(text), &msg); err != nil {
+			return nil, fmt.Errorf("%s:%d: error parsing message: %w", path, line, err)
+		}
+		transcript.Messages = append(transcript.Messages, &msg)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return transcript, nil
+}
+
+// LoadTranscripts reads the transcripts of the files matching the pattern
+// (see filepath.Glob), e.g. "testdata/transcripts/*.jsonl".
+func LoadTranscripts(pattern string) ([]*Transcript, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	transcripts := make([]*Transcript, 0, len(paths))
+	for _, path := range paths {
+		transcript, err := LoadTranscript(path)
+		if err != nil {
+			return nil, err
+		}
+		transcripts = append(transcripts, transcript)
+	}
+	return transcripts, nil
+}
+
+// WriteTranscript writes the messages to a JSONL file, one ai.Message per line.
+// It can be used to record a conversation, e.g. from the history memory.
+func WriteTranscript(path string, messages []*ai.Message) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	for _, msg := range messages {
+		if err := enc.Encode(msg); err != nil {
+			f.Close()
+			return fmt.Errorf("error serializing message: %w", err)
+		}
+	}
+	return f.Close()
+}
+
+// Inputs returns the user messages of the transcript.
+func (t *Transcript) Inputs() []*ai.Message {
+	var inputs []*ai.Message
+	for _, msg := range t.Messages {
+		if msg.Role == ai.RoleUser {
+			inputs = append(inputs, msg)
+		}
+	}
+	return inputs
+}
+
+// ModelMessages returns the recorded model messages of the transcript.
+func (t *Transcript) ModelMessages() []*ai.Message {
+	var messages []*ai.Message
+	for _, msg := range t.Messages {
+		if msg.Role == ai.RoleModel {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
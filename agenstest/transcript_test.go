@@ -0,0 +1,54 @@
+package agenstest_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/gonzxlezs/agens"
+	"github.com/gonzxlezs/agens/agenstest"
+)
+
+func TestLoadTranscript(t *testing.T) {
+	transcript := loadTranscript(t)
+
+	if transcript.Name != "opening_hours" {
+		t.Errorf("name = %q, want opening_hours", transcript.Name)
+	}
+	if n := len(transcript.Inputs()); n != 2 {
+		t.Errorf("%d inputs, want 2", n)
+	}
+	if n := len(transcript.ModelMessages()); n != 2 {
+		t.Errorf("%d model messages, want 2", n)
+	}
+
+	// the metadata of the inputs is kept
+	if userID, _ := agens.GetUserID(transcript.Inputs()[0]); userID != "user" {
+		t.Errorf("user ID = %q, want user", userID)
+	}
+}
+
+func TestWriteTranscript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "written.jsonl")
+
+	messages := []*ai.Message{
+		ai.NewUserTextMessage("Hi"),
+		ai.NewModelTextMessage("Hello"),
+	}
+	if err := agenstest.WriteTranscript(path, messages); err != nil {
+		t.Fatal(err)
+	}
+
+	transcripts, err := agenstest.LoadTranscripts(filepath.Join(filepath.Dir(path), "*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transcripts) != 1 || transcripts[0].Name != "written" {
+		t.Fatalf("transcripts = %+v, want the written one", transcripts)
+	}
+
+	loaded := transcripts[0].Messages
+	if len(loaded) != 2 || loaded[0].Role != ai.RoleUser || loaded[1].Text() != "Hello" {
+		t.Errorf("loaded %+v", loaded)
+	}
+}
@@ -0,0 +1,191 @@
+package agenstest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/gonzxlezs/agens"
+)
+
+// DefaultTriggerName is the name of the fake trigger, and the source of the
+// messages it injects, when no name is given.
+const DefaultTriggerName = "agenstest"
+
+// ErrNoRunner is returned when a message is injected before a runner is registered.
+var ErrNoRunner = errors.New("no runner registered")
+
+var (
+	_ agens.Trigger        = &Trigger{}
+	_ agens.WebhookTrigger = &Trigger{}
+)
+
+// Reply is a response captured by the fake trigger.
+type Reply struct {
+	// Message is the injected message.
+	Message *ai.Message
+
+	// Response is the response of the runner.
+	Response *ai.ModelResponse
+
+	// Err is the error of the run.
+	Err error
+}
+
+// Trigger is a fake Trigger and WebhookTrigger. Messages are injected with
+// Send (or with a POST to its route) and run by the last registered runner;
+// the responses are captured as replies.
+type Trigger struct {
+	name string
+
+	mu         sync.Mutex
+	runner     agens.Runner
+	replies    []Reply
+	started    bool
+	webhookURL string
+}
+
+// NewTrigger creates a fake trigger. If name is empty, DefaultTriggerName is used.
+func NewTrigger(name string) *Trigger {
+	if name == "" {
+		name = DefaultTriggerName
+	}
+	return &Trigger{name: name}
+}
+
+func (t *Trigger) Name() string {
+	return t.name
+}
+
+func (t *Trigger) RegisterAgent(runner agens.Runner) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.runner = runner
+	return nil
+}
+
+func (t *Trigger) Start(_ context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.started = true
+	return nil
+}
+
+func (t *Trigger) Stop(_ context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.started = false
+	return nil
+}
+
+// Started reports whether the trigger was started and not stopped.
+func (t *Trigger) Started() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.started
+}
+
+// Send runs the message with the registered runner and captures the reply.
+// The source of the message is set to the name of the trigger if missing.
+func (t *Trigger) Send(ctx context.Context, msg *ai.Message) (*ai.ModelResponse, error) {
+	t.mu.Lock()
+	runner := t.runner
+	t.mu.Unlock()
+
+	if runner == nil {
+		return nil, ErrNoRunner
+	}
+
+	if source, _ := agens.GetSource(msg); source == "" {
+		agens.SetSource(msg, t.name)
+	}
+
+	resp, err := runner.Run(ctx, msg)
+
+	t.mu.Lock()
+	t.replies = append(t.replies, Reply{Message: msg, Response: resp, Err: err})
+	t.mu.Unlock()
+
+	return resp, err
+}
+
+// SendText sends a user text message from the user in the channel.
+func (t *Trigger) SendText(ctx context.Context, channelID string, userID string, text string) (*ai.ModelResponse, error) {
+	msg := ai.NewUserTextMessage(text)
+	agens.SetChannelID(msg, channelID)
+	agens.SetUserID(msg, userID)
+
+	return t.Send(ctx, msg)
+}
+
+// Replies returns the captured replies.
+func (t *Trigger) Replies() []Reply {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return slices.Clone(t.replies)
+}
+
+// LastReply returns the last captured reply. ok is false if there is none.
+func (t *Trigger) LastReply() (reply Reply, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.replies) == 0 {
+		return Reply{}, false
+	}
+	return t.replies[len(t.replies)-1], true
+}
+
+// GetRoutes returns a POST route at /<name>/ that injects the ai.Message of
+// the request body and answers with the ai.ModelResponse as JSON.
+func (t *Trigger) GetRoutes() []agens.WebhookTriggerRoute {
+	return []agens.WebhookTriggerRoute{
+		{
+			Method:  http.MethodPost,
+			Path:    "/" + t.name + "/",
+			Handler: t.handle,
+		},
+	}
+}
+
+func (t *Trigger) SetWebhook(baseURL string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.webhookURL = baseURL
+	return nil
+}
+
+// WebhookURL returns the base URL passed to SetWebhook.
+func (t *Trigger) WebhookURL() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.webhookURL
+}
+
+func (t *Trigger) handle(w http.ResponseWriter, r *http.Request) {
+	var msg ai.Message
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := t.Send(r.Context(), &msg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,65 @@
+package agens
+
+import (
+	"fmt"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// AgentToolNameFormat is the format used to name the tool returned by Agent.AsTool.
+// It receives the agent name as its only argument.
+const AgentToolNameFormat = "%s_agent_tool"
+
+type (
+	// AgentToolInput is the input schema of the tool returned by Agent.AsTool.
+	AgentToolInput struct {
+		Message string `json:"message" jsonschema_description:"The message or task to send to the agent. It must be self-contained, since the agent does not see the current conversation."`
+	}
+
+	// AgentToolOutput is the output schema of the tool returned by Agent.AsTool.
+	AgentToolOutput struct {
+		Response  string `json:"response" jsonschema_description:"The text response of the agent."`
+		Delegated bool   `json:"delegated,omitempty" jsonschema_description:"True if the agent did not handle the message."`
+	}
+)
+
+// AsTool exposes the agent as a Genkit tool, so that a coordinator agent can
+// call it like any other entry in AgentConfig.Tools.
+//
+// The sub-agent runs its own flow (history, knowledge and tools). The message
+// sent to it carries the parent's SourceKey, ChannelIDKey and UserIDKey metadata,
+// and its history is stored under a conversation ID derived from the parent's
+// one ("parentConversationID/agentName"), so it does not pollute the parent's history.
+func (agent *Agent) AsTool(description string) ai.Tool {
+	toolName := fmt.Sprintf(AgentToolNameFormat, agent.Name())
+
+	f := func(ctx *ai.ToolContext, input AgentToolInput) (AgentToolOutput, error) {
+		var (
+			msg       = ai.NewUserTextMessage(input.Message)
+			parentMsg = GetRunMessage(ctx)
+			runCtx    = WithOutputOption(ctx.Context, nil)
+		)
+
+		for _, key := range []string{SourceKey, ChannelIDKey, UserIDKey} {
+			if v, ok, _ := getMetadata(parentMsg, key); ok {
+				setMetadata(msg, key, v)
+			}
+		}
+
+		if parentID := GetRunConversationID(ctx); parentID != "" {
+			runCtx = WithConversationID(runCtx, parentID+"/"+agent.Name())
+		}
+
+		resp, err := agent.Run(runCtx, msg)
+		if err != nil {
+			return AgentToolOutput{}, err
+		}
+
+		if resp.FinishReason == FinishReasonDelegated {
+			return AgentToolOutput{Delegated: true}, nil
+		}
+		return AgentToolOutput{Response: resp.Text()}, nil
+	}
+
+	return ai.NewTool(toolName, description, f)
+}
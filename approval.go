@@ -0,0 +1,233 @@
+package agens
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+const (
+	// ToolApprovalKey is the key used in the interrupt metadata of the tool
+	// requests waiting for approval, and in the metadata of the incoming
+	// message that answers them (true to approve, false to reject).
+	ToolApprovalKey = "tool_approval"
+
+	// DefaultToolRejectedMessage is the message returned to the model when a tool call is rejected.
+	DefaultToolRejectedMessage = "The user rejected this action. It was not performed."
+
+	// DefaultApprovalReminder is the reply returned while a tool call waits for
+	// approval and the incoming message neither approves nor rejects it.
+	DefaultApprovalReminder = "Please approve or reject the pending action before continuing."
+
+	// DefaultApprovalPromptFormat is the format of the question sent to the
+	// user for each tool call waiting for approval (tool name and input).
+	DefaultApprovalPromptFormat = "Do you approve running %s with %s?"
+
+	// ApprovalPendingMessage is the finish message of the responses returned
+	// while a tool call waits for approval.
+	ApprovalPendingMessage = "tool approval pending"
+)
+
+var (
+	// ApproveWords are the texts (case-insensitive) that approve a pending tool call.
+	ApproveWords = []string{"approve", "approved", "yes", "y", "ok", "confirm"}
+
+	// RejectWords are the texts (case-insensitive) that reject a pending tool call.
+	RejectWords = []string{"reject", "rejected", "no", "n", "cancel", "deny"}
+)
+
+// ApprovalOutput is the output of a tool that requires approval.
+type ApprovalOutput[Out any] struct {
+	Approved bool   `json:"approved" jsonschema_description:"Whether the action was approved and performed."`
+	Output   Out    `json:"output,omitempty" jsonschema_description:"The result of the action, if it was approved."`
+	Message  string `json:"message,omitempty" jsonschema_description:"Explanation when the action was not approved."`
+}
+
+// ToolApprovalRequest describes a tool call waiting for approval.
+type ToolApprovalRequest struct {
+	// Name is the name of the tool.
+	Name string
+
+	// Input is the input the model requested the tool with.
+	Input any
+}
+
+// Prompt returns the question asking the user to approve the tool call
+// (see DefaultApprovalPromptFormat).
+func (req ToolApprovalRequest) Prompt() string {
+	input, err := json.Marshal(req.Input)
+	if err != nil {
+		input = []byte(fmt.Sprint(req.Input))
+	}
+	return fmt.Sprintf(DefaultApprovalPromptFormat, req.Name, input)
+}
+
+// RequireApproval wraps a tool function so every call is interrupted until it
+// is approved. While waiting, the run returns a response with the
+// ai.FinishReasonInterrupted finish reason (see PendingToolApprovals) and the
+// pending request is stored with the conversation history. The next message
+// that approves or rejects it (see SetToolApproval) resumes the generation.
+// A retried resume (see RetryPolicy) runs fn again, so it should be idempotent.
+//
+//	genkit.DefineTool(g, "refund", "Refunds an order.", agens.RequireApproval(refund))
+func RequireApproval[In, Out any](fn ai.ToolFunc[In, Out]) ai.ToolFunc[In, ApprovalOutput[Out]] {
+	return func(ctx *ai.ToolContext, input In) (ApprovalOutput[Out], error) {
+		if ctx.Resumed == nil {
+			return ApprovalOutput[Out]{}, ctx.Interrupt(&ai.InterruptOptions{
+				Metadata: map[string]any{ToolApprovalKey: true},
+			})
+		}
+
+		if approved, _ := ctx.Resumed[ToolApprovalKey].(bool); !approved {
+			return ApprovalOutput[Out]{Message: DefaultToolRejectedMessage}, nil
+		}
+
+		output, err := fn(ctx, input)
+		if err != nil {
+			return ApprovalOutput[Out]{}, err
+		}
+		return ApprovalOutput[Out]{Approved: true, Output: output}, nil
+	}
+}
+
+// WithApproval returns a copy of tool whose calls require approval (see
+// RequireApproval). It is meant for tools created with ai.NewTool: a tool
+// registered in Genkit under the same name takes precedence over the copy.
+func WithApproval(tool ai.Tool) ai.Tool {
+	def := tool.Definition()
+
+	fn := func(ctx *ai.ToolContext, input any) (any, error) {
+		return tool.RunRaw(ctx, input)
+	}
+
+	return ai.NewTool(def.Name, def.Description, RequireApproval(fn), ai.WithInputSchema(def.InputSchema))
+}
+
+// ParseToolApproval reports whether text approves or rejects a pending tool
+// call (see ApproveWords and RejectWords). ok is false if it does neither.
+func ParseToolApproval(text string) (approved bool, ok bool) {
+	text = strings.ToLower(strings.Trim(strings.TrimSpace(text), ".!"))
+
+	for _, word := range ApproveWords {
+		if text == word {
+			return true, true
+		}
+	}
+	for _, word := range RejectWords {
+		if text == word {
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// SetToolApproval sets in the metadata of an incoming message whether it
+// approves or rejects the pending tool calls of the conversation.
+func SetToolApproval(msg *ai.Message, approved bool) *ai.Message {
+	return setMetadata(msg, ToolApprovalKey, approved)
+}
+
+// PendingToolApprovals returns the tool calls of an interrupted response that
+// are waiting for approval.
+func PendingToolApprovals(resp *ai.ModelResponse) []ToolApprovalRequest {
+	if (resp == nil) || (resp.FinishReason != ai.FinishReasonInterrupted) {
+		return nil
+	}
+
+	var requests []ToolApprovalRequest
+	for _, part := range approvalParts(resp.Message) {
+		requests = append(requests, ToolApprovalRequest{
+			Name:  part.ToolRequest.Name,
+			Input: part.ToolRequest.Input,
+		})
+	}
+	return requests
+}
+
+func approvalParts(msg *ai.Message) []*ai.Part {
+	if (msg == nil) || (msg.Role != ai.RoleModel) {
+		return nil
+	}
+
+	var parts []*ai.Part
+	for _, part := range msg.Content {
+		if !part.IsToolRequest() || (part.Metadata == nil) {
+			continue
+		}
+
+		interrupt, ok := part.Metadata["interrupt"].(map[string]any)
+		if ok && (interrupt[ToolApprovalKey] == true) {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// pendingApproval returns the last message of the history if it is a model
+// message whose tool calls are waiting for approval.
+func pendingApproval(history []*ai.Message) *ai.Message {
+	if len(history) == 0 {
+		return nil
+	}
+
+	last := history[len(history)-1]
+	if len(approvalParts(last)) == 0 {
+		return nil
+	}
+	return last
+}
+
+// toolApprovalDecision looks for an approval or a rejection in the batch,
+// first in the metadata (ToolApprovalKey) and then in the text of the messages.
+func toolApprovalDecision(batch []*ai.Message) (approved bool, ok bool) {
+	for i := len(batch) - 1; i >= 0; i-- {
+		v, found, _ := getMetadata(batch[i], ToolApprovalKey)
+		if approved, isBool := v.(bool); found && isBool {
+			return approved, true
+		}
+
+		if approved, ok := ParseToolApproval(batch[i].Text()); ok {
+			return approved, true
+		}
+	}
+	return false, false
+}
+
+// approvalRestarts builds the parts that resume the tool calls waiting for
+// approval in msg (see ai.WithToolRestarts).
+func approvalRestarts(msg *ai.Message, approved bool) []*ai.Part {
+	var restarts []*ai.Part
+	for _, part := range approvalParts(msg) {
+		metadata := maps.Clone(part.Metadata)
+		delete(metadata, "interrupt")
+		metadata["resumed"] = map[string]any{ToolApprovalKey: approved}
+
+		restart := ai.NewToolRequestPart(&ai.ToolRequest{
+			Name:  part.ToolRequest.Name,
+			Ref:   part.ToolRequest.Ref,
+			Input: part.ToolRequest.Input,
+		})
+		restart.Metadata = metadata
+
+		restarts = append(restarts, restart)
+	}
+	return restarts
+}
+
+// approvalReminderModelResponse builds the response returned while a tool call
+// waits for approval. Nothing of it is stored in the history.
+func approvalReminderModelResponse(reply string) *ai.ModelResponse {
+	if reply == "" {
+		reply = DefaultApprovalReminder
+	}
+
+	return &ai.ModelResponse{
+		FinishReason:  ai.FinishReasonBlocked,
+		FinishMessage: ApprovalPendingMessage,
+		Message:       ai.NewModelTextMessage(reply),
+		Request:       &ai.ModelRequest{},
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/firebase/genkit/go/ai"
+	"go.opentelemetry.io/otel/metric"
 )
 
 // DefaultSystemMessageFormat is the default template used to format the
@@ -34,6 +35,15 @@ type AgentConfig struct {
 	// It is used only if Model is not defined (nil).
 	ModelName string
 
+	// FallbackModels is an ordered list of models tried, one after another,
+	// when the primary model (Model or ModelName) keeps failing.
+	// The model that actually answered is recorded in the response message metadata (ModelNameKey).
+	FallbackModels []ai.ModelArg
+
+	// RetryPolicy controls how failed generations are retried with the same
+	// model before falling through to the next one. If nil, each model is tried once.
+	RetryPolicy *RetryPolicy
+
 	// Tools is a list of tools that the agent can use.
 	Tools []ai.ToolRef
 
@@ -49,6 +59,29 @@ type AgentConfig struct {
 	// MaxMessagesPerConversation defines the limit of messages to keep in context.
 	MaxMessagesPerConversation int
 
+	// MaxHistoryTokens is an optional token budget for the conversation history
+	// sent to the model. When the retrieved history exceeds it, the oldest turns
+	// are dropped (a tool request is never separated from its tool response).
+	// Zero or negative values disable the budget.
+	MaxHistoryTokens int
+
+	// TokenEstimator estimates the tokens of each message for MaxHistoryTokens.
+	// If nil, DefaultTokenEstimator is used.
+	TokenEstimator TokenEstimator
+
+	// StateProvider is responsible for persisting structured key/value facts
+	// per conversation. When set, the agent gets tools to read and write them.
+	StateProvider StateProvider
+
+	// HandoffProvider is responsible for persisting which conversations are
+	// paused for a human operator. When set, the agent gets the request human
+	// tool and the Pause and Resume methods can be used.
+	HandoffProvider HandoffProvider
+
+	// HandoffNotifier is an optional hook called when the model escalates a
+	// conversation through the request human tool, e.g. to notify an operator channel.
+	HandoffNotifier HandoffNotifier
+
 	// KnowledgeProvider is responsible for managing and retrieving domain-specific
 	// information to augment the agent's responses.
 	KnowledgeProvider KnowledgeProvider
@@ -57,12 +90,78 @@ type AgentConfig struct {
 	// to retrieve from the knowledge base per query.
 	KnowledgeRetrieveLimit int
 
+	// KnowledgeMode controls whether the knowledge base is exposed as a tool,
+	// queried with the incoming batch and injected as context before generation,
+	// or both. Defaults to KnowledgeModeTool.
+	KnowledgeMode KnowledgeMode
+
+	// KnowledgeQueryFunc is an optional function that builds the query of the
+	// knowledge injected before generation from the incoming batch. It defaults
+	// to the text of the messages. Triggers that send the platform messages as
+	// JSON provide one that keeps only the text written by the user (e.g.
+	// tgbot.KnowledgeQuery).
+	KnowledgeQueryFunc func(batch []*ai.Message) string
+
 	// SystemPromptFunc is an optional function for formatting the system message.
 	// The system message is crucial for providing high-level instructions to the AI model.
 	SystemPromptFunc func(*AgentConfig) string
 
+	// SystemPromptTemplate is an optional text/template rendered on every run to
+	// build the system message, with a SystemPromptData as its data. It has access
+	// to the incoming message metadata, the current time and the variables attached
+	// to the context with WithPromptVars. If set, it takes precedence over SystemPromptFunc.
+	SystemPromptTemplate string
+
 	// ConversationIDFunc is an optional function for formatting the conversation id.
 	ConversationIDFunc func(msg *ai.Message) (string, error)
+
+	// RateLimit optionally limits how often the agent runs per user and per
+	// conversation. Limited runs are rejected with a slow down reply or delayed.
+	RateLimit *RateLimitConfig
+
+	// ConcurrencyPolicy selects what happens when a message arrives while the
+	// agent is still running the same conversation: wait for it (the default),
+	// merge the messages into the next turn, reject them or run in parallel.
+	ConcurrencyPolicy ConcurrencyPolicy
+
+	// ConversationLocker provides the mutual exclusion between the runs of a
+	// conversation. If nil, an in-process locker (NewLocalConversationLocker) is used.
+	ConversationLocker ConversationLocker
+
+	// BusyReply is the reply returned to runs rejected by ConcurrencyReject.
+	// Defaults to DefaultBusyReply.
+	BusyReply string
+
+	// ApprovalReminder is the reply returned when a message arrives while a tool
+	// call waits for approval (see RequireApproval) and the message neither
+	// approves nor rejects it. Defaults to DefaultApprovalReminder.
+	ApprovalReminder string
+
+	// UsageRecorder is an optional sink for the tokens, tool calls, latency and
+	// cost of every generation, keyed by agent, conversation and user. Its
+	// errors do not fail the run (see UsageErrorKey).
+	UsageRecorder UsageRecorder
+
+	// PriceTable optionally maps model names to their prices, used to compute
+	// the cost of the usage records.
+	PriceTable PriceTable
+
+	// MeterProvider provides the meter of the OpenTelemetry metrics of the agent
+	// runs (see MetricAgentRuns). If nil, the global MeterProvider is used.
+	MeterProvider metric.MeterProvider
+
+	// Middlewares are hooks that run around the steps of the agent flow.
+	// They can be used for logging, redaction, auth checks or response rewriting.
+	Middlewares []Middleware
+
+	// InputGuards check the incoming batch of messages before generation.
+	// They can allow it, rewrite it or block the turn with a canned reply.
+	InputGuards []InputGuard
+
+	// OutputGuards check the model response before it is stored and returned.
+	// They can allow it, rewrite it or replace it with a canned reply. When
+	// streaming, the chunks are held until the guards pass.
+	OutputGuards []OutputGuard
 }
 
 // GetConversationID retrieves the conversation identifier for a given message.
@@ -0,0 +1,69 @@
+package agens
+
+import (
+	"context"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// ConversationIDKey is used as a context key to force the conversation ID of the next agent run.
+type ConversationIDKey struct{}
+
+type runKey struct{}
+
+type streamingKey struct{}
+
+type runInfo struct {
+	conversationID string
+	message        *ai.Message
+}
+
+// WithConversationID returns a new context.Context derived from the provided ctx
+// that forces the conversation ID used by the next agent run, bypassing
+// AgentConfig.ConversationIDFunc. The value only applies to the agent run that
+// receives the context; nested runs resolve their own conversation IDs.
+func WithConversationID(ctx context.Context, conversationID string) context.Context {
+	return context.WithValue(ctx, ConversationIDKey{}, conversationID)
+}
+
+// GetRunConversationID returns the conversation ID of the agent run in progress
+// within ctx (e.g. from inside a tool called by the agent). It returns an empty
+// string if ctx does not belong to an agent run.
+func GetRunConversationID(ctx context.Context) string {
+	if info, ok := ctx.Value(runKey{}).(*runInfo); ok {
+		return info.conversationID
+	}
+	return ""
+}
+
+// GetRunMessage returns the incoming message of the agent run in progress
+// within ctx. It returns nil if ctx does not belong to an agent run.
+func GetRunMessage(ctx context.Context) *ai.Message {
+	if info, ok := ctx.Value(runKey{}).(*runInfo); ok {
+		return info.message
+	}
+	return nil
+}
+
+func forcedConversationID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(ConversationIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+func withStreaming(ctx context.Context, streaming bool) context.Context {
+	return context.WithValue(ctx, streamingKey{}, streaming)
+}
+
+func isStreaming(ctx context.Context) bool {
+	streaming, _ := ctx.Value(streamingKey{}).(bool)
+	return streaming
+}
+
+func withRun(ctx context.Context, conversationID string, msg *ai.Message) context.Context {
+	ctx = context.WithValue(ctx, ConversationIDKey{}, "")
+	ctx = withStreaming(ctx, false)
+	return context.WithValue(ctx, runKey{}, &runInfo{
+		conversationID: conversationID,
+		message:        msg,
+	})
+}
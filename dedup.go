@@ -0,0 +1,83 @@
+package agens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// MessageDeduplicator remembers the incoming messages already processed, so
+// the messages redelivered by the platforms (e.g. webhook retries) are not run twice.
+type MessageDeduplicator interface {
+	// MarkSeen records key as seen and reports whether it had already been
+	// recorded (within the retention period of the implementation).
+	MarkSeen(ctx context.Context, key string) (bool, error)
+
+	// Forget removes key, so the next message with it is not a duplicate.
+	Forget(ctx context.Context, key string) error
+}
+
+// DeduplicationKey builds the key that identifies an incoming message from its
+// source, channel ID and platform message ID (MessageIDKey). It returns an
+// empty string if the message has no message ID.
+func DeduplicationKey(msg *ai.Message) (string, error) {
+	messageID, err := GetMessageID(msg)
+	if (err != nil) || (messageID == "") {
+		return "", err
+	}
+
+	source, err := GetSource(msg)
+	if err != nil {
+		return "", err
+	}
+
+	channel, err := GetChannelID(msg)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s:%s:%s", source, channel, messageID), nil
+}
+
+// IsDuplicate reports whether msg was already seen by the deduplicator, and
+// records it otherwise. Messages without a message ID are never duplicates.
+// It returns false if deduplicator is nil.
+func IsDuplicate(ctx context.Context, deduplicator MessageDeduplicator, msg *ai.Message) (bool, error) {
+	if deduplicator == nil {
+		return false, nil
+	}
+
+	key, err := DeduplicationKey(msg)
+	if (err != nil) || (key == "") {
+		return false, err
+	}
+	return deduplicator.MarkSeen(ctx, key)
+}
+
+// ProcessOnce calls process unless msg was already seen by the deduplicator.
+// If process fails, msg is forgotten so that the platform's retry is processed
+// again. It calls process directly if deduplicator is nil.
+func ProcessOnce(ctx context.Context, deduplicator MessageDeduplicator, msg *ai.Message, process func() error) error {
+	duplicate, err := IsDuplicate(ctx, deduplicator, msg)
+	if err != nil {
+		return err
+	} else if duplicate {
+		return nil
+	}
+
+	err = process()
+	if (err == nil) || (deduplicator == nil) {
+		return err
+	}
+
+	key, keyErr := DeduplicationKey(msg)
+	if (keyErr != nil) || (key == "") {
+		return err
+	}
+	if forgetErr := deduplicator.Forget(ctx, key); forgetErr != nil {
+		return errors.Join(err, fmt.Errorf("error forgetting message: %w", forgetErr))
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+package agens_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/gonzxlezs/agens"
+	"github.com/gonzxlezs/agens/extensions/memdedup"
+)
+
+func TestProcessOnceForgetsFailedMessages(t *testing.T) {
+	var (
+		ctx          = context.Background()
+		deduplicator = &memdedup.Deduplicator{}
+		errReply     = errors.New("reply failed")
+
+		msg = ai.NewUserTextMessage("Hi")
+	)
+	agens.SetSource(msg, "tester")
+	agens.SetChannelID(msg, "channel")
+	agens.SetMessageID(msg, "1")
+
+	var calls int
+	process := func(err error) func() error {
+		return func() error {
+			calls++
+			return err
+		}
+	}
+
+	if err := agens.ProcessOnce(ctx, deduplicator, msg, process(errReply)); !errors.Is(err, errReply) {
+		t.Fatalf("err = %v, want %v", err, errReply)
+	}
+
+	// the retry of the failed message is processed
+	if err := agens.ProcessOnce(ctx, deduplicator, msg, process(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("processed %d times, want the retry processed", calls)
+	}
+
+	// and once it succeeds, the redeliveries are dropped
+	if err := agens.ProcessOnce(ctx, deduplicator, msg, process(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("processed %d times, want the redelivery dropped", calls)
+	}
+}
@@ -0,0 +1,71 @@
+package memdedup
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gonzxlezs/agens"
+)
+
+// DefaultTTL is the default time a message is remembered.
+const DefaultTTL = 24 * time.Hour
+
+var _ agens.MessageDeduplicator = &Deduplicator{}
+
+// Deduplicator remembers the seen keys in memory for TTL, so duplicates are
+// only detected within a single process. Expired keys are pruned from time to time.
+type Deduplicator struct {
+	TTL time.Duration
+
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+func (d *Deduplicator) MarkSeen(_ context.Context, key string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.seen == nil {
+		d.seen = make(map[string]time.Time)
+	}
+
+	now := time.Now()
+	d.prune(now)
+
+	if expires, ok := d.seen[key]; ok && now.Before(expires) {
+		return true, nil
+	}
+
+	d.seen[key] = now.Add(d.ttl())
+	return false, nil
+}
+
+func (d *Deduplicator) Forget(_ context.Context, key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.seen, key)
+	return nil
+}
+
+func (d *Deduplicator) ttl() time.Duration {
+	if d.TTL <= 0 {
+		return DefaultTTL
+	}
+	return d.TTL
+}
+
+func (d *Deduplicator) prune(now time.Time) {
+	if now.Sub(d.lastPrune) < d.ttl() {
+		return
+	}
+	d.lastPrune = now
+
+	for key, expires := range d.seen {
+		if !now.Before(expires) {
+			delete(d.seen, key)
+		}
+	}
+}
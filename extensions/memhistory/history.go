@@ -0,0 +1,272 @@
+package memhistory
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/gonzxlezs/agens"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+var _ agens.HistoryProvider = &HistoryProvider{}
+var _ agens.HistoryMemory = &historyMemory{}
+var _ agens.HistoryMessageDeleter = &historyMemory{}
+
+type conversationKey struct {
+	agentName      string
+	conversationID string
+}
+
+// HistoryProvider keeps the conversation histories in process, so they are
+// lost on restart unless saved with Save and restored with Load. Like
+// pgmemory, it keeps the last maxMessagesPerConversation messages of each
+// conversation of an agent (none if it is 0 or less) and sets the StoredIDKey
+// of the stored messages.
+// The zero value is ready to use.
+type HistoryProvider struct {
+	mu            sync.Mutex
+	lastID        int64
+	limits        map[string]int
+	conversations map[conversationKey][]*ai.Message
+}
+
+func (p *HistoryProvider) ForAgent(agentName string, maxMessages int) (agens.HistoryMemory, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.limits == nil {
+		p.limits = make(map[string]int)
+	}
+	p.limits[agentName] = maxMessages
+
+	return &historyMemory{provider: p, agentName: agentName}, nil
+}
+
+func (_ *HistoryProvider) Close() error {
+	return nil
+}
+
+func (p *HistoryProvider) deleteHistory(agentName string, conversationID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.conversations, conversationKey{agentName, conversationID})
+}
+
+func (p *HistoryProvider) deleteMessages(agentName string, conversationID string, storedIDs []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := conversationKey{agentName, conversationID}
+	messages, ok := p.conversations[key]
+	if !ok {
+		return
+	}
+
+	p.conversations[key] = slices.DeleteFunc(slices.Clone(messages), func(msg *ai.Message) bool {
+		storedID, _ := agens.GetStoredID(msg)
+		return slices.Contains(storedIDs, storedID)
+	})
+}
+
+func (p *HistoryProvider) retrieveHistory(agentName string, conversationID string) []*ai.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stored := p.conversations[conversationKey{agentName, conversationID}]
+
+	messages := make([]*ai.Message, 0, len(stored))
+	for _, msg := range stored {
+		messages = append(messages, cloneMessage(msg))
+	}
+	return messages
+}
+
+func (p *HistoryProvider) storeHistory(agentName string, conversationID string, history []*ai.Message) error {
+	var filtered []*ai.Message
+	for _, msg := range history {
+		// Skip system messages and those that have already been stored.
+		if msg.Role != ai.RoleSystem {
+			storedID, err := agens.GetStoredID(msg)
+			if err != nil {
+				return err
+			} else if storedID != "" {
+				continue
+			}
+
+			filtered = append(filtered, msg)
+		}
+	}
+
+	if len(filtered) == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conversations == nil {
+		p.conversations = make(map[conversationKey][]*ai.Message)
+	}
+
+	key := conversationKey{agentName, conversationID}
+	messages := p.conversations[key]
+	for _, msg := range filtered {
+		p.lastID++
+		messages = append(messages, agens.SetStoredID(cloneMessage(msg), strconv.FormatInt(p.lastID, 10)))
+	}
+
+	// Drop the oldest messages over the limit of the agent.
+	limit := max(p.limits[agentName], 0)
+	if len(messages) > limit {
+		messages = slices.Clone(messages[len(messages)-limit:])
+	}
+
+	p.conversations[key] = messages
+	return nil
+}
+
+// snapshot is the JSON document written by Save.
+type snapshot struct {
+	Conversations []snapshotConversation `json:"conversations"`
+}
+
+type snapshotConversation struct {
+	AgentName      string        `json:"agent_name"`
+	ConversationID string        `json:"conversation_id"`
+	Messages       []*ai.Message `json:"messages"`
+}
+
+// Save writes the histories of every agent to a JSON file. The file is
+// written to a temporary path first and renamed, so a crash does not leave a
+// truncated snapshot.
+func (p *HistoryProvider) Save(path string) error {
+	p.mu.Lock()
+	snap := snapshot{Conversations: make([]snapshotConversation, 0, len(p.conversations))}
+	for key, messages := range p.conversations {
+		snap.Conversations = append(snap.Conversations, snapshotConversation{
+			AgentName:      key.agentName,
+			ConversationID: key.conversationID,
+			Messages:       messages,
+		})
+	}
+	slices.SortFunc(snap.Conversations, func(a, b snapshotConversation) int {
+		return cmp.Or(cmp.Compare(a.AgentName, b.AgentName), cmp.Compare(a.ConversationID, b.ConversationID))
+	})
+	data, err := json.Marshal(snap)
+	p.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("error serializing history: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("error writing history snapshot: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load replaces the histories with those of a JSON file written by Save.
+// A missing file is not an error, so Load can be called on the first start.
+func (p *HistoryProvider) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error reading history snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("error parsing history snapshot: %w", err)
+	}
+
+	var (
+		conversations = make(map[conversationKey][]*ai.Message, len(snap.Conversations))
+		lastID        int64
+	)
+	for _, conv := range snap.Conversations {
+		key := conversationKey{conv.AgentName, conv.ConversationID}
+		for _, msg := range conv.Messages {
+			storedID, err := agens.GetStoredID(msg)
+			if err != nil {
+				return err
+			}
+
+			id, err := strconv.ParseInt(storedID, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid stored ID %q in history snapshot: %w", storedID, err)
+			}
+			lastID = max(lastID, id)
+
+			conversations[key] = append(conversations[key], msg)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.conversations = conversations
+	p.lastID = max(p.lastID, lastID)
+	return nil
+}
+
+// ConversationIDs returns the IDs of the stored conversations of an agent, sorted.
+func (p *HistoryProvider) ConversationIDs(agentName string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var ids []string
+	for key := range p.conversations {
+		if key.agentName == agentName {
+			ids = append(ids, key.conversationID)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// cloneMessage copies the message with its own content slice and metadata
+// map, so the stored messages are not changed by the flow.
+func cloneMessage(msg *ai.Message) *ai.Message {
+	clone := *msg
+	clone.Content = slices.Clone(msg.Content)
+	clone.Metadata = maps.Clone(msg.Metadata)
+	return &clone
+}
+
+type historyMemory struct {
+	provider  *HistoryProvider
+	agentName string
+}
+
+func (m *historyMemory) DeleteHistory(_ context.Context, conversationID string) error {
+	m.provider.deleteHistory(m.agentName, conversationID)
+	return nil
+}
+
+func (m *historyMemory) DeleteMessages(_ context.Context, conversationID string, storedIDs []string) error {
+	m.provider.deleteMessages(m.agentName, conversationID, storedIDs)
+	return nil
+}
+
+func (m *historyMemory) RetrieveHistory(_ context.Context, conversationID string) ([]*ai.Message, error) {
+	return m.provider.retrieveHistory(m.agentName, conversationID), nil
+}
+
+func (m *historyMemory) StoreHistory(_ context.Context, conversationID string, history []*ai.Message) error {
+	return m.provider.storeHistory(m.agentName, conversationID, history)
+}
+
+func (_ *historyMemory) Close() error {
+	return nil
+}
@@ -0,0 +1,122 @@
+package memhistory
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/gonzxlezs/agens"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+func texts(messages []*ai.Message) []string {
+	var texts []string
+	for _, msg := range messages {
+		texts = append(texts, msg.Text())
+	}
+	return texts
+}
+
+func TestHistoryTrimsAndSkipsStored(t *testing.T) {
+	ctx := context.Background()
+	p := &HistoryProvider{}
+
+	memory, err := p.ForAgent("agent", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = memory.StoreHistory(ctx, "conv", []*ai.Message{
+		ai.NewSystemTextMessage("system"),
+		ai.NewUserTextMessage("one"),
+		ai.NewModelTextMessage("two"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history, _ := memory.RetrieveHistory(ctx, "conv")
+	for _, msg := range history {
+		if id, _ := agens.GetStoredID(msg); id == "" {
+			t.Errorf("message %q has no stored ID", msg.Text())
+		}
+	}
+
+	// the retrieved messages are stored again by the flow, and must be skipped
+	history = append(history, ai.NewUserTextMessage("three"), ai.NewModelTextMessage("four"))
+	if err := memory.StoreHistory(ctx, "conv", history); err != nil {
+		t.Fatal(err)
+	}
+
+	history, _ = memory.RetrieveHistory(ctx, "conv")
+	if got := texts(history); len(got) != 3 || got[0] != "two" || got[2] != "four" {
+		t.Errorf("history = %v, want [two three four]", got)
+	}
+
+	// other agents do not share the history
+	other, _ := p.ForAgent("other", 0)
+	if history, _ := other.RetrieveHistory(ctx, "conv"); len(history) != 0 {
+		t.Errorf("other agent history = %v, want empty", texts(history))
+	}
+
+	if err := memory.DeleteHistory(ctx, "conv"); err != nil {
+		t.Fatal(err)
+	}
+	if history, _ := memory.RetrieveHistory(ctx, "conv"); len(history) != 0 {
+		t.Errorf("history after delete = %v, want empty", texts(history))
+	}
+}
+
+func TestHistoryWithoutLimitKeepsNothing(t *testing.T) {
+	ctx := context.Background()
+	p := &HistoryProvider{}
+
+	// like pgmemory and sqlitememory, the limit is used as given
+	for _, limit := range []int{0, -1} {
+		memory, _ := p.ForAgent("agent", limit)
+
+		err := memory.StoreHistory(ctx, "conv", []*ai.Message{ai.NewUserTextMessage("hi"), ai.NewModelTextMessage("hello")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if history, _ := memory.RetrieveHistory(ctx, "conv"); len(history) != 0 {
+			t.Errorf("limit %d: history = %v, want empty", limit, texts(history))
+		}
+	}
+}
+
+func TestHistorySnapshot(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "history.json")
+
+	p := &HistoryProvider{}
+	memory, _ := p.ForAgent("agent", 10)
+	memory.StoreHistory(ctx, "conv", []*ai.Message{ai.NewUserTextMessage("hi"), ai.NewModelTextMessage("hello")})
+
+	if err := p.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := &HistoryProvider{}
+	if err := restored.Load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	memory, _ = restored.ForAgent("agent", 10)
+	history, _ := memory.RetrieveHistory(ctx, "conv")
+	if got := texts(history); len(got) != 2 || got[0] != "hi" || got[1] != "hello" {
+		t.Fatalf("restored history = %v, want [hi hello]", got)
+	}
+
+	// new messages do not reuse the restored IDs
+	memory.StoreHistory(ctx, "conv", []*ai.Message{ai.NewUserTextMessage("again")})
+	history, _ = memory.RetrieveHistory(ctx, "conv")
+	if id, _ := agens.GetStoredID(history[2]); id != "3" {
+		t.Errorf("stored ID = %q, want 3", id)
+	}
+
+	if err := (&HistoryProvider{}).Load(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("Load of a missing file: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package memknowledge
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func randomVectors(n int, dim int, seed int64) [][]float32 {
+	r := rand.New(rand.NewSource(seed))
+
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		vectors[i] = make([]float32, dim)
+		for j := range vectors[i] {
+			vectors[i][j] = r.Float32()*2 - 1
+		}
+	}
+	return vectors
+}
+
+// clusteredVectors returns vectors around random centers, closer to the
+// distribution of text embeddings than uniform vectors.
+func clusteredVectors(n int, dim int, clusters int, seed int64) [][]float32 {
+	var (
+		r       = rand.New(rand.NewSource(seed))
+		centers = randomVectors(clusters, dim, 0)
+	)
+
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		center := centers[r.Intn(clusters)]
+
+		vectors[i] = make([]float32, dim)
+		for j := range vectors[i] {
+			vectors[i][j] = center[j] + float32(r.NormFloat64()*0.3)
+		}
+	}
+	return vectors
+}
+
+// recall returns the fraction of the exact k nearest neighbors found by the index.
+func recall(exact index, approx index, queries [][]float32, k int) float64 {
+	var found, total int
+	for _, q := range queries {
+		want := make(map[int]struct{}, k)
+		for _, id := range exact.search(q, k) {
+			want[id] = struct{}{}
+		}
+
+		for _, id := range approx.search(q, k) {
+			if _, ok := want[id]; ok {
+				found++
+			}
+		}
+		total += len(want)
+	}
+	return float64(found) / float64(total)
+}
+
+// BenchmarkSearch compares the latency and the recall@10 of the flat and HNSW
+// indexes on clustered embeddings:
+//
+//	go test -bench Search -run ^$ ./extensions/memknowledge
+func BenchmarkSearch(b *testing.B) {
+	const (
+		dim = 128
+		k   = 10
+	)
+
+	queries := clusteredVectors(100, dim, 50, 2)
+
+	for _, n := range []int{1000, 10000} {
+		vectors := clusteredVectors(n, dim, 50, 1)
+
+		flat := newIndex(IndexFlat, Cosine, HNSWConfig{})
+		for _, v := range vectors {
+			flat.add(Cosine.prepare(v))
+		}
+
+		for _, typ := range []struct {
+			name  string
+			index index
+		}{
+			{"flat", flat},
+			{"hnsw", newIndex(IndexHNSW, Cosine, HNSWConfig{})},
+		} {
+			if typ.index != flat {
+				for _, v := range vectors {
+					typ.index.add(Cosine.prepare(v))
+				}
+			}
+
+			b.Run(fmt.Sprintf("%s/n=%d", typ.name, n), func(b *testing.B) {
+				for i := 0; b.Loop(); i++ {
+					typ.index.search(Cosine.prepare(queries[i%len(queries)]), k)
+				}
+				b.ReportMetric(recall(flat, typ.index, queries, k), "recall@10")
+			})
+		}
+	}
+}
+
+func BenchmarkHNSWInsert(b *testing.B) {
+	vectors := clusteredVectors(10000, 128, 50, 1)
+
+	index := newIndex(IndexHNSW, Cosine, HNSWConfig{})
+	for i := 0; b.Loop(); i++ {
+		index.add(Cosine.prepare(vectors[i%len(vectors)]))
+	}
+}
@@ -0,0 +1,414 @@
+package memknowledge
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"slices"
+)
+
+// Metric is the similarity used to rank the documents.
+type Metric int
+
+const (
+	// Cosine ranks by the cosine of the angle between the embeddings.
+	Cosine Metric = iota
+
+	// Dot ranks by inner product, like the <#> operator of pgvector.
+	Dot
+
+	// L2 ranks by Euclidean distance.
+	L2
+)
+
+// IndexType selects the index used to search the embeddings.
+type IndexType int
+
+const (
+	// IndexFlat compares the query with every embedding. It is exact, and fast
+	// enough for a few thousand documents.
+	IndexFlat IndexType = iota
+
+	// IndexHNSW searches a Hierarchical Navigable Small World graph. It is
+	// approximate, but its latency grows logarithmically with the documents.
+	IndexHNSW
+)
+
+const (
+	DefaultHNSWM              = 16
+	DefaultHNSWEfConstruction = 200
+	DefaultHNSWEfSearch       = 64
+)
+
+// HNSWConfig tunes the HNSW index. Zero values use the defaults.
+type HNSWConfig struct {
+	// M is the number of neighbors of a node per layer (twice as many on the
+	// bottom layer). Defaults to DefaultHNSWM.
+	M int
+
+	// EfConstruction is the size of the candidate list when inserting.
+	// Defaults to DefaultHNSWEfConstruction.
+	EfConstruction int
+
+	// EfSearch is the size of the candidate list when searching; higher
+	// values improve the recall at the cost of latency. Defaults to DefaultHNSWEfSearch.
+	EfSearch int
+
+	// Seed seeds the random levels of the nodes, so the graph built from the
+	// same embeddings is always the same.
+	Seed int64
+}
+
+// distance returns the function used by the indexes, lower meaning more
+// similar. Cosine embeddings are normalized on insert, so they use Dot.
+func (m Metric) distance() func(a, b []float32) float32 {
+	if m == L2 {
+		return squaredL2
+	}
+	return negativeDot
+}
+
+// prepare returns the vector stored in the index for an embedding.
+func (m Metric) prepare(v []float32) []float32 {
+	if m != Cosine {
+		return v
+	}
+
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	if norm == 0 {
+		return v
+	}
+
+	norm = math.Sqrt(norm)
+	normalized := make([]float32, len(v))
+	for i, x := range v {
+		normalized[i] = float32(float64(x) / norm)
+	}
+	return normalized
+}
+
+func negativeDot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return -sum
+}
+
+func squaredL2(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return sum
+}
+
+// index searches the k nearest vectors of a query, returning their ids (the
+// insertion order) from the nearest.
+type index interface {
+	add(v []float32)
+	search(query []float32, k int) []int
+}
+
+func newIndex(typ IndexType, metric Metric, cfg HNSWConfig) index {
+	if typ == IndexHNSW {
+		return newHNSWIndex(metric.distance(), cfg)
+	}
+	return &flatIndex{distance: metric.distance()}
+}
+
+type flatIndex struct {
+	distance func(a, b []float32) float32
+	vectors  [][]float32
+}
+
+func (f *flatIndex) add(v []float32) {
+	f.vectors = append(f.vectors, v)
+}
+
+func (f *flatIndex) search(query []float32, k int) []int {
+	results := make(candidates, 0, k+1)
+	for id, v := range f.vectors {
+		d := f.distance(query, v)
+		if len(results) < k {
+			heap.Push((*maxCandidates)(&results), candidate{id, d})
+		} else if d < results[0].distance {
+			results[0] = candidate{id, d}
+			heap.Fix((*maxCandidates)(&results), 0)
+		}
+	}
+	return results.sortedIDs()
+}
+
+type hnswNode struct {
+	vector []float32
+
+	// neighbors contains the neighbors of the node in each of its layers.
+	neighbors [][]int
+}
+
+type hnswIndex struct {
+	distance func(a, b []float32) float32
+	cfg      HNSWConfig
+	levelMul float64
+	rand     *rand.Rand
+
+	nodes      []hnswNode
+	entryPoint int
+	maxLevel   int
+}
+
+func newHNSWIndex(distance func(a, b []float32) float32, cfg HNSWConfig) *hnswIndex {
+	if cfg.M <= 1 {
+		cfg.M = DefaultHNSWM
+	}
+	if cfg.EfConstruction <= 0 {
+		cfg.EfConstruction = DefaultHNSWEfConstruction
+	}
+	if cfg.EfSearch <= 0 {
+		cfg.EfSearch = DefaultHNSWEfSearch
+	}
+
+	return &hnswIndex{
+		distance: distance,
+		cfg:      cfg,
+		levelMul: 1 / math.Log(float64(cfg.M)),
+		rand:     rand.New(rand.NewSource(cfg.Seed)),
+	}
+}
+
+func (h *hnswIndex) maxNeighbors(level int) int {
+	if level == 0 {
+		return 2 * h.cfg.M
+	}
+	return h.cfg.M
+}
+
+func (h *hnswIndex) add(v []float32) {
+	id := len(h.nodes)
+	level := int(-math.Log(1-h.rand.Float64()) * h.levelMul)
+
+	h.nodes = append(h.nodes, hnswNode{
+		vector:    v,
+		neighbors: make([][]int, level+1),
+	})
+
+	if id == 0 {
+		h.entryPoint, h.maxLevel = id, level
+		return
+	}
+
+	// Descend greedily through the layers above the node.
+	ep := h.entryPoint
+	for l := h.maxLevel; l > level; l-- {
+		ep = h.searchLayer(v, ep, 1, l)[0].id
+	}
+
+	for l := min(level, h.maxLevel); l >= 0; l-- {
+		found := h.searchLayer(v, ep, h.cfg.EfConstruction, l)
+		ep = found[0].id
+
+		neighbors := h.selectNeighbors(found, h.maxNeighbors(l))
+		h.nodes[id].neighbors[l] = neighbors
+
+		for _, n := range neighbors {
+			h.connect(n, id, l)
+		}
+	}
+
+	if level > h.maxLevel {
+		h.entryPoint, h.maxLevel = id, level
+	}
+}
+
+// connect adds a link from the node to the neighbor, selecting the links
+// again when the node has too many.
+func (h *hnswIndex) connect(node int, neighbor int, level int) {
+	links := append(h.nodes[node].neighbors[level], neighbor)
+
+	if limit := h.maxNeighbors(level); len(links) > limit {
+		v := h.nodes[node].vector
+
+		cands := make(candidates, 0, len(links))
+		for _, link := range links {
+			cands = append(cands, candidate{link, h.distance(v, h.nodes[link].vector)})
+		}
+		slices.SortFunc(cands, func(a, b candidate) int {
+			return compareDistance(a.distance, b.distance)
+		})
+
+		links = h.selectNeighbors(cands, limit)
+	}
+	h.nodes[node].neighbors[level] = links
+}
+
+// selectNeighbors selects up to n neighbors from the candidates, sorted from
+// the nearest, with the heuristic of the HNSW paper: a candidate nearer to an
+// already selected neighbor than to the node is skipped, so the links spread
+// in every direction. The skipped candidates fill the remaining links.
+func (h *hnswIndex) selectNeighbors(cands candidates, n int) []int {
+	if len(cands) <= n {
+		return cands.ids(n)
+	}
+
+	var (
+		selected = make([]int, 0, n)
+		skipped  []int
+	)
+	for _, c := range cands {
+		if len(selected) == n {
+			break
+		}
+
+		good := true
+		for _, s := range selected {
+			if h.distance(h.nodes[c.id].vector, h.nodes[s].vector) < c.distance {
+				good = false
+				break
+			}
+		}
+
+		if good {
+			selected = append(selected, c.id)
+		} else {
+			skipped = append(skipped, c.id)
+		}
+	}
+
+	for _, id := range skipped {
+		if len(selected) == n {
+			break
+		}
+		selected = append(selected, id)
+	}
+	return selected
+}
+
+func (h *hnswIndex) search(query []float32, k int) []int {
+	if len(h.nodes) == 0 {
+		return nil
+	}
+
+	ep := h.entryPoint
+	for l := h.maxLevel; l > 0; l-- {
+		ep = h.searchLayer(query, ep, 1, l)[0].id
+	}
+
+	found := h.searchLayer(query, ep, max(h.cfg.EfSearch, k), 0)
+	return found.ids(k)
+}
+
+// searchLayer returns the ef nearest nodes found in the layer starting from
+// the entry point, sorted from the nearest.
+func (h *hnswIndex) searchLayer(query []float32, ep int, ef int, level int) candidates {
+	var (
+		visited = make(bitset, (len(h.nodes)+63)/64)
+		first   = candidate{ep, h.distance(query, h.nodes[ep].vector)}
+		queue   = candidates{first}
+		results = candidates{first}
+	)
+	visited.set(ep)
+
+	for len(queue) > 0 {
+		c := heap.Pop((*minCandidates)(&queue)).(candidate)
+		if c.distance > results[0].distance {
+			break
+		}
+
+		for _, n := range h.nodes[c.id].neighbors[level] {
+			if visited.has(n) {
+				continue
+			}
+			visited.set(n)
+
+			d := h.distance(query, h.nodes[n].vector)
+			if (len(results) < ef) || (d < results[0].distance) {
+				heap.Push((*minCandidates)(&queue), candidate{n, d})
+				heap.Push((*maxCandidates)(&results), candidate{n, d})
+				if len(results) > ef {
+					heap.Pop((*maxCandidates)(&results))
+				}
+			}
+		}
+	}
+
+	slices.SortFunc(results, func(a, b candidate) int {
+		return compareDistance(a.distance, b.distance)
+	})
+	return results
+}
+
+type bitset []uint64
+
+func (b bitset) has(i int) bool {
+	return b[i/64]&(1<<(i%64)) != 0
+}
+
+func (b bitset) set(i int) {
+	b[i/64] |= 1 << (i % 64)
+}
+
+type candidate struct {
+	id       int
+	distance float32
+}
+
+type candidates []candidate
+
+// ids returns the ids of the first n candidates.
+func (c candidates) ids(n int) []int {
+	ids := make([]int, 0, min(n, len(c)))
+	for _, cand := range c[:min(n, len(c))] {
+		ids = append(ids, cand.id)
+	}
+	return ids
+}
+
+func (c candidates) sortedIDs() []int {
+	slices.SortFunc(c, func(a, b candidate) int {
+		return compareDistance(a.distance, b.distance)
+	})
+	return c.ids(len(c))
+}
+
+func compareDistance(a, b float32) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// minCandidates is a heap of candidates with the nearest on top.
+type minCandidates candidates
+
+func (h minCandidates) Len() int           { return len(h) }
+func (h minCandidates) Less(i, j int) bool { return h[i].distance < h[j].distance }
+func (h minCandidates) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *minCandidates) Push(x any)        { *h = append(*h, x.(candidate)) }
+func (h *minCandidates) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// maxCandidates is a heap of candidates with the farthest on top.
+type maxCandidates candidates
+
+func (h maxCandidates) Len() int           { return len(h) }
+func (h maxCandidates) Less(i, j int) bool { return h[i].distance > h[j].distance }
+func (h maxCandidates) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *maxCandidates) Push(x any)        { *h = append(*h, x.(candidate)) }
+func (h *maxCandidates) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
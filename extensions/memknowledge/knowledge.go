@@ -0,0 +1,523 @@
+// Package memknowledge implements a KnowledgeProvider that keeps the
+// documents and their embeddings in memory, searched with a flat or an HNSW
+// index. It needs no database, so it suits tests and small bots; the
+// knowledge can be saved to a file and loaded on start.
+package memknowledge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/core/api"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/gonzxlezs/agens"
+)
+
+const Provider = "memknowledge"
+
+const (
+	StatusKnowledgeSuccess = "success"
+
+	StatusKnowledgeNoResults = "no_results"
+)
+
+const labelKey = "label"
+
+var (
+	ErrKnowledgeProviderFailure = fmt.Errorf("memknowledge: knowledge provider failure")
+
+	ErrInvalidRetrieveOptions = errors.New("memknowledge: invalid or missing retrieval options")
+
+	ErrDimensionMismatch = errors.New("memknowledge: embedding dimension does not match the indexed embeddings")
+)
+
+var _ agens.KnowledgeProvider = &KnowledgeProvider{}
+var _ agens.KnowledgeMemory = &knowledgeMemory{}
+
+type (
+	KnowledgeQuery struct {
+		Query string `json:"query" jsonschema_description:"The specific search query or keywords to retrieve relevant information from the knowledge base. Should be clear and focused on the topic."`
+	}
+
+	DocumentResult struct {
+		Label   string `json:"label" jsonschema_description:"The category or source label of the retrieved document."`
+		Content string `json:"content" jsonschema_description:"The text content of the retrieved document."`
+	}
+
+	KnowledgeResponse struct {
+		Results []DocumentResult `json:"results" jsonschema_description:"List of relevant documents found."`
+		Count   int              `json:"count" jsonschema_description:"Number of documents retrieved. 0 if nothing was found."`
+		Status  string           `json:"status" jsonschema:"enum=success,enum=,description=The outcome of the retrieval operation."`
+	}
+)
+
+type RetrieveOptions struct {
+	AgentName string
+	Limit     int
+}
+
+type KnowledgeProviderConfig struct {
+	Name             string
+	Description      string
+	Embedder         ai.Embedder
+	EmbedderName     string
+	RetrieverOptions *ai.RetrieverOptions
+	EmbedderOptions  []ai.EmbedderOption
+
+	// Metric is the similarity used to rank the documents. Defaults to Cosine.
+	Metric Metric
+
+	// Index is the index used to search the embeddings. Defaults to IndexFlat.
+	Index IndexType
+
+	// HNSW tunes the index when Index is IndexHNSW.
+	HNSW HNSWConfig
+}
+
+func (cfg *KnowledgeProviderConfig) resolveEmbedderName() string {
+	if cfg.Embedder != nil {
+		return cfg.Embedder.Name()
+	}
+	return cfg.EmbedderName
+}
+
+func (cfg *KnowledgeProviderConfig) resolveEmbedderOptions(additionalOptions ...ai.EmbedderOption) []ai.EmbedderOption {
+	embedderOpts := make([]ai.EmbedderOption, 0, len(cfg.EmbedderOptions)+len(additionalOptions)+1)
+
+	embedderOpts = append(embedderOpts, cfg.EmbedderOptions...)
+	embedderOpts = append(embedderOpts, additionalOptions...)
+
+	if cfg.Embedder != nil {
+		embedderOpts = append(embedderOpts, ai.WithEmbedder(cfg.Embedder))
+	} else if cfg.EmbedderName != "" {
+		embedderOpts = append(embedderOpts, ai.WithEmbedderName(cfg.EmbedderName))
+	}
+
+	return embedderOpts
+}
+
+// entry is an indexed document.
+type entry struct {
+	Label       string    `json:"label"`
+	Content     string    `json:"content"`
+	ContentHash string    `json:"content_hash"`
+	Embedding   []float32 `json:"embedding"`
+}
+
+type collectionKey struct {
+	agentName    string
+	embedderName string
+}
+
+// collection holds the documents of an agent embedded with an embedder, like
+// the rows of a pgmemory table with the same agent_name and embedder_name.
+type collection struct {
+	entries []entry
+	hashes  map[string]struct{}
+	index   index
+}
+
+func (c *collection) key(label string, contentHash string) string {
+	return label + "\x00" + contentHash
+}
+
+type KnowledgeProvider struct {
+	g   *genkit.Genkit
+	cfg *KnowledgeProviderConfig
+
+	retriever ai.Retriever
+
+	mu          sync.RWMutex
+	collections map[collectionKey]*collection
+}
+
+func NewKnowledgeProvider(g *genkit.Genkit, cfg KnowledgeProviderConfig) (*KnowledgeProvider, error) {
+	p := &KnowledgeProvider{
+		g:           g,
+		cfg:         &cfg,
+		collections: make(map[collectionKey]*collection),
+	}
+	p.retriever = defineRetriever(g, p)
+	return p, nil
+}
+
+func (p *KnowledgeProvider) ForAgent(agentName string, limit int) (agens.KnowledgeMemory, error) {
+	return &knowledgeMemory{
+		provider:  p,
+		agentName: agentName,
+		limit:     limit,
+		asTool:    defineTool(p.g, p.retriever, p.cfg, agentName, limit),
+	}, nil
+}
+
+// newCollection builds a collection with its index from the entries.
+func (p *KnowledgeProvider) newCollection(entries []entry) *collection {
+	c := &collection{
+		hashes: make(map[string]struct{}, len(entries)),
+		index:  newIndex(p.cfg.Index, p.cfg.Metric, p.cfg.HNSW),
+	}
+	for _, e := range entries {
+		c.add(p.cfg.Metric, e)
+	}
+	return c
+}
+
+func (c *collection) add(metric Metric, e entry) {
+	c.entries = append(c.entries, e)
+	c.hashes[c.key(e.Label, e.ContentHash)] = struct{}{}
+	c.index.add(metric.prepare(e.Embedding))
+}
+
+func (p *KnowledgeProvider) deleteKnowledge(agentName string, label string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := collectionKey{agentName, p.cfg.resolveEmbedderName()}
+
+	c, ok := p.collections[key]
+	if !ok {
+		return
+	}
+
+	// The indexes do not support removals, so the collection is rebuilt.
+	kept := slices.DeleteFunc(slices.Clone(c.entries), func(e entry) bool {
+		return e.Label == label
+	})
+	if len(kept) < len(c.entries) {
+		p.collections[key] = p.newCollection(kept)
+	}
+}
+
+func (p *KnowledgeProvider) indexKnowledge(ctx context.Context, agentName string, label string, docs []*ai.Document) error {
+	var (
+		key           = collectionKey{agentName, p.cfg.resolveEmbedderName()}
+		docsToEmbed   []*ai.Document
+		hashesToEmbed []string
+	)
+
+	p.mu.RLock()
+	c := p.collections[key]
+	for _, doc := range docs {
+		content := documentToText(doc)
+		if content == "" {
+			continue
+		}
+
+		cHash := calculateHash(content)
+
+		if c != nil {
+			if _, exists := c.hashes[c.key(label, cHash)]; exists {
+				continue
+			}
+		}
+		if slices.Contains(hashesToEmbed, cHash) {
+			continue
+		}
+
+		docsToEmbed = append(docsToEmbed, doc)
+		hashesToEmbed = append(hashesToEmbed, cHash)
+	}
+	p.mu.RUnlock()
+
+	if len(docsToEmbed) == 0 {
+		return nil
+	}
+
+	res, err := genkit.Embed(
+		ctx,
+		p.g,
+		p.cfg.resolveEmbedderOptions(
+			ai.WithDocs(docsToEmbed...),
+		)...,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c, ok := p.collections[key]
+
+	// check every dimension first, so a mismatch leaves the collection unchanged
+	dimension := -1
+	if ok && (len(c.entries) > 0) {
+		dimension = len(c.entries[0].Embedding)
+	}
+	for _, emb := range res.Embeddings {
+		if dimension < 0 {
+			dimension = len(emb.Embedding)
+		}
+		if len(emb.Embedding) != dimension {
+			return ErrDimensionMismatch
+		}
+	}
+
+	if !ok {
+		c = p.newCollection(nil)
+		p.collections[key] = c
+	}
+
+	for i, emb := range res.Embeddings {
+		e := entry{
+			Label:       label,
+			Content:     documentToText(docsToEmbed[i]),
+			ContentHash: hashesToEmbed[i],
+			Embedding:   emb.Embedding,
+		}
+
+		if _, exists := c.hashes[c.key(e.Label, e.ContentHash)]; exists {
+			continue
+		}
+
+		c.add(p.cfg.Metric, e)
+	}
+
+	return nil
+}
+
+func (p *KnowledgeProvider) retrieveKnowledge(ctx context.Context, agentName string, query string, limit int) ([]*ai.Document, error) {
+	resp, err := genkit.Retrieve(
+		ctx, p.g,
+		ai.WithRetriever(p.retriever),
+		ai.WithConfig(&RetrieveOptions{
+			AgentName: agentName,
+			Limit:     limit,
+		}),
+		ai.WithTextDocs(query),
+	)
+	if err != nil {
+		return nil, errors.Join(ErrKnowledgeProviderFailure, err)
+	}
+	return resp.Documents, nil
+}
+
+func (p *KnowledgeProvider) search(agentName string, embedding []float32, limit int) ([]entry, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	c, ok := p.collections[collectionKey{agentName, p.cfg.resolveEmbedderName()}]
+	if !ok || (len(c.entries) == 0) {
+		return nil, nil
+	}
+	if len(embedding) != len(c.entries[0].Embedding) {
+		return nil, ErrDimensionMismatch
+	}
+
+	ids := c.index.search(p.cfg.Metric.prepare(embedding), limit)
+
+	entries := make([]entry, 0, len(ids))
+	for _, id := range ids {
+		entries = append(entries, c.entries[id])
+	}
+	return entries, nil
+}
+
+// snapshot is the JSON document written by Save. The indexes are rebuilt on Load.
+type snapshot struct {
+	Collections []snapshotCollection `json:"collections"`
+}
+
+type snapshotCollection struct {
+	AgentName    string  `json:"agent_name"`
+	EmbedderName string  `json:"embedder_name"`
+	Entries      []entry `json:"entries"`
+}
+
+// Save writes the indexed documents and embeddings of every agent to a JSON
+// file. The file is written to a temporary path first and renamed, so a crash
+// does not leave a truncated snapshot.
+func (p *KnowledgeProvider) Save(path string) error {
+	p.mu.RLock()
+	snap := snapshot{Collections: make([]snapshotCollection, 0, len(p.collections))}
+	for key, c := range p.collections {
+		snap.Collections = append(snap.Collections, snapshotCollection{
+			AgentName:    key.agentName,
+			EmbedderName: key.embedderName,
+			Entries:      c.entries,
+		})
+	}
+	slices.SortFunc(snap.Collections, func(a, b snapshotCollection) int {
+		return strings.Compare(a.AgentName+"\x00"+a.EmbedderName, b.AgentName+"\x00"+b.EmbedderName)
+	})
+	data, err := json.Marshal(snap)
+	p.mu.RUnlock()
+
+	if err != nil {
+		return fmt.Errorf("error serializing knowledge: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("error writing knowledge snapshot: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load replaces the knowledge with that of a JSON file written by Save and
+// rebuilds the indexes. A missing file is not an error, so Load can be called
+// on the first start.
+func (p *KnowledgeProvider) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error reading knowledge snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("error parsing knowledge snapshot: %w", err)
+	}
+
+	collections := make(map[collectionKey]*collection, len(snap.Collections))
+	for _, sc := range snap.Collections {
+		collections[collectionKey{sc.AgentName, sc.EmbedderName}] = p.newCollection(sc.Entries)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.collections = collections
+	return nil
+}
+
+type knowledgeMemory struct {
+	provider  *KnowledgeProvider
+	asTool    ai.Tool
+	agentName string
+	limit     int
+}
+
+func (k *knowledgeMemory) AsTool() ai.Tool {
+	return k.asTool
+}
+
+func (k *knowledgeMemory) DeleteKnowledge(_ context.Context, label string) error {
+	k.provider.deleteKnowledge(k.agentName, label)
+	return nil
+}
+
+func (k *knowledgeMemory) IndexKnowledge(ctx context.Context, label string, docs []*ai.Document) error {
+	return k.provider.indexKnowledge(ctx, k.agentName, label, docs)
+}
+
+func (k *knowledgeMemory) RetrieveKnowledge(ctx context.Context, query string) ([]*ai.Document, error) {
+	return k.provider.retrieveKnowledge(ctx, k.agentName, query, k.limit)
+}
+
+func calculateHash(content string) string {
+	h := sha256.New()
+	h.Write([]byte(content))
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func defineRetriever(g *genkit.Genkit, p *KnowledgeProvider) ai.Retriever {
+	cfg := p.cfg
+
+	f := func(ctx context.Context, req *ai.RetrieverRequest) (*ai.RetrieverResponse, error) {
+		opts, ok := req.Options.(*RetrieveOptions)
+		if !ok || opts == nil {
+			return nil, ErrInvalidRetrieveOptions
+		}
+
+		if opts.Limit <= 0 {
+			// Default limit if not specified or invalid
+			opts.Limit = 3
+		}
+
+		eres, err := genkit.Embed(
+			ctx,
+			g,
+			cfg.resolveEmbedderOptions(ai.WithDocs(req.Query))...,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		entries, err := p.search(opts.AgentName, eres.Embeddings[0].Embedding, opts.Limit)
+		if err != nil {
+			return nil, err
+		}
+
+		res := &ai.RetrieverResponse{}
+		for _, e := range entries {
+			res.Documents = append(
+				res.Documents,
+				ai.DocumentFromText(e.Content, map[string]any{
+					labelKey: e.Label,
+				}),
+			)
+		}
+
+		return res, nil
+	}
+
+	return genkit.DefineRetriever(g, api.NewName(Provider, cfg.Name), cfg.RetrieverOptions, f)
+}
+
+func defineTool(g *genkit.Genkit, retriever ai.Retriever, cfg *KnowledgeProviderConfig, agentName string, limit int) ai.Tool {
+	toolName := fmt.Sprintf("%s_%s_tool", agentName, cfg.Name)
+
+	f := func(ctx *ai.ToolContext, query KnowledgeQuery) (KnowledgeResponse, error) {
+		resp, err := genkit.Retrieve(
+			ctx, g,
+			ai.WithRetriever(retriever),
+			ai.WithConfig(&RetrieveOptions{
+				AgentName: agentName,
+				Limit:     limit,
+			}),
+			ai.WithTextDocs(query.Query),
+		)
+		if err != nil {
+			return KnowledgeResponse{}, errors.Join(ErrKnowledgeProviderFailure, err)
+		}
+
+		kResponse := KnowledgeResponse{
+			Count:  len(resp.Documents),
+			Status: StatusKnowledgeNoResults,
+		}
+
+		if kResponse.Count < 1 {
+			return kResponse, nil
+		}
+		kResponse.Status = StatusKnowledgeSuccess
+
+		for _, doc := range resp.Documents {
+			label, _ := doc.Metadata[labelKey].(string)
+			if label == "" {
+				label = "unlabeled"
+			}
+
+			kResponse.Results = append(
+				kResponse.Results,
+				DocumentResult{
+					Label:   label,
+					Content: documentToText(doc),
+				},
+			)
+		}
+		return kResponse, nil
+	}
+
+	return genkit.DefineTool(g, toolName, cfg.Description, f)
+}
+
+func documentToText(doc *ai.Document) string {
+	var b strings.Builder
+	for _, part := range doc.Content {
+		b.WriteString(part.Text)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
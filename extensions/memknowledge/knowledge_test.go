@@ -0,0 +1,177 @@
+package memknowledge
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// defineKeywordEmbedder defines an embedder with one dimension per keyword.
+func defineKeywordEmbedder(g *genkit.Genkit, keywords ...string) ai.Embedder {
+	return genkit.DefineEmbedder(g, "test/keywords", nil, func(_ context.Context, req *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+		resp := &ai.EmbedResponse{}
+		for _, doc := range req.Input {
+			text := strings.ToLower(documentToText(doc))
+
+			embedding := make([]float32, len(keywords))
+			for i, keyword := range keywords {
+				if strings.Contains(text, keyword) {
+					embedding[i] = 1
+				}
+			}
+			resp.Embeddings = append(resp.Embeddings, &ai.Embedding{Embedding: embedding})
+		}
+		return resp, nil
+	})
+}
+
+func TestKnowledgeProvider(t *testing.T) {
+	for _, typ := range []IndexType{IndexFlat, IndexHNSW} {
+		ctx := context.Background()
+		g := genkit.Init(ctx)
+
+		p, err := NewKnowledgeProvider(g, KnowledgeProviderConfig{
+			Name:     "faq",
+			Embedder: defineKeywordEmbedder(g, "shipping", "refund", "store"),
+			Index:    typ,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		memory, _ := p.ForAgent("agent", 1)
+
+		err = memory.IndexKnowledge(ctx, "faq", []*ai.Document{
+			ai.DocumentFromText("Shipping is free.", nil),
+			ai.DocumentFromText("Refunds take 5 days.", nil),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		results, err := memory.RetrieveKnowledge(ctx, "how long for a refund?")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || !strings.Contains(documentToText(results[0]), "Refunds") {
+			t.Fatalf("index %d: results = %v, want the refund document", typ, results)
+		}
+		if label := results[0].Metadata[labelKey]; label != "faq" {
+			t.Errorf("index %d: label = %v, want faq", typ, label)
+		}
+
+		// other agents do not share the knowledge
+		other, _ := p.ForAgent("other", 1)
+		if results, _ := other.RetrieveKnowledge(ctx, "refund"); len(results) != 0 {
+			t.Errorf("index %d: other agent got %d results, want 0", typ, len(results))
+		}
+
+		path := filepath.Join(t.TempDir(), "knowledge.json")
+		if err := p.Save(path); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := memory.DeleteKnowledge(ctx, "faq"); err != nil {
+			t.Fatal(err)
+		}
+		if results, _ := memory.RetrieveKnowledge(ctx, "refund"); len(results) != 0 {
+			t.Errorf("index %d: %d results after delete, want 0", typ, len(results))
+		}
+
+		if err := p.Load(path); err != nil {
+			t.Fatal(err)
+		}
+		if results, _ := memory.RetrieveKnowledge(ctx, "refund"); len(results) != 1 {
+			t.Errorf("index %d: %d results after load, want 1", typ, len(results))
+		}
+	}
+}
+
+func TestIndexKnowledgeDimensionMismatch(t *testing.T) {
+	ctx := context.Background()
+	g := genkit.Init(ctx)
+
+	// one dimension per word
+	embedder := genkit.DefineEmbedder(g, "test/words", nil, func(_ context.Context, req *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+		resp := &ai.EmbedResponse{}
+		for _, doc := range req.Input {
+			embedding := make([]float32, len(strings.Fields(documentToText(doc))))
+			embedding[0] = 1
+			resp.Embeddings = append(resp.Embeddings, &ai.Embedding{Embedding: embedding})
+		}
+		return resp, nil
+	})
+
+	p, err := NewKnowledgeProvider(g, KnowledgeProviderConfig{Name: "faq", Embedder: embedder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory, _ := p.ForAgent("agent", 10)
+
+	err = memory.IndexKnowledge(ctx, "faq", []*ai.Document{ai.DocumentFromText("Shipping is free.", nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the document with the right dimension is not indexed either
+	err = memory.IndexKnowledge(ctx, "faq", []*ai.Document{
+		ai.DocumentFromText("Refunds are free.", nil),
+		ai.DocumentFromText("The store opens daily.", nil),
+	})
+	if !errors.Is(err, ErrDimensionMismatch) {
+		t.Fatalf("err = %v, want %v", err, ErrDimensionMismatch)
+	}
+
+	results, err := memory.RetrieveKnowledge(ctx, "one two three")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Errorf("%d documents indexed, want 1", len(results))
+	}
+}
+
+func TestHNSWRecall(t *testing.T) {
+	vectors, queries := clusteredVectors(2000, 32, 20, 1), clusteredVectors(50, 32, 20, 2)
+
+	flat := newIndex(IndexFlat, L2, HNSWConfig{})
+	hnsw := newIndex(IndexHNSW, L2, HNSWConfig{})
+	for _, v := range vectors {
+		flat.add(v)
+		hnsw.add(v)
+	}
+
+	if r := recall(flat, hnsw, queries, 10); r < 0.9 {
+		t.Errorf("recall@10 = %.2f, want at least 0.9", r)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	vectors := [][]float32{{1, 0}, {10, 1}, {0, 1}}
+	query := []float32{1, 0.02}
+
+	tests := []struct {
+		metric Metric
+		want   int
+	}{
+		{Cosine, 0},
+		{Dot, 1},
+		{L2, 0},
+	}
+
+	for _, tt := range tests {
+		index := newIndex(IndexFlat, tt.metric, HNSWConfig{})
+		for _, v := range vectors {
+			index.add(tt.metric.prepare(v))
+		}
+
+		if got := index.search(tt.metric.prepare(query), 1); got[0] != tt.want {
+			t.Errorf("metric %d: nearest = %d, want %d", tt.metric, got[0], tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package memratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gonzxlezs/agens"
+)
+
+// DefaultPruneInterval is the default minimum time between two prunes of the idle buckets.
+const DefaultPruneInterval = time.Minute
+
+var _ agens.RateLimiter = &RateLimiter{}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   agens.RateLimit
+}
+
+// RateLimiter keeps the token buckets in memory, so the limits only hold
+// within a single process. Buckets that have refilled completely are pruned
+// from time to time.
+type RateLimiter struct {
+	PruneInterval time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+func (l *RateLimiter) Reserve(_ context.Context, key string, limit agens.RateLimit, maxDelay time.Duration) (time.Duration, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+
+	if l.buckets == nil {
+		l.buckets = make(map[string]*bucket)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(max(limit.Burst, 1)), updated: now}
+		l.buckets[key] = b
+	}
+
+	tokens, delay, allowed := limit.Take(b.tokens, now.Sub(b.updated), maxDelay)
+	b.tokens, b.updated, b.limit = tokens, now, limit
+
+	return delay, allowed, nil
+}
+
+func (l *RateLimiter) Refund(_ context.Context, key string, limit agens.RateLimit) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.buckets[key]; ok {
+		b.tokens = limit.Refund(b.tokens)
+	}
+	return nil
+}
+
+func (l *RateLimiter) prune(now time.Time) {
+	interval := l.PruneInterval
+	if interval <= 0 {
+		interval = DefaultPruneInterval
+	}
+
+	if now.Sub(l.lastPrune) < interval {
+		return
+	}
+	l.lastPrune = now
+
+	for key, b := range l.buckets {
+		// the bucket is full again, so forgetting it changes nothing
+		missing := float64(max(b.limit.Burst, 1)) - b.tokens
+		if now.Sub(b.updated) >= time.Duration(missing*float64(b.limit.Every)) {
+			delete(l.buckets, key)
+		}
+	}
+}
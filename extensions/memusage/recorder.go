@@ -0,0 +1,92 @@
+package memusage
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gonzxlezs/agens"
+)
+
+var _ agens.UsageStore = &Recorder{}
+
+// Recorder keeps the usage records in memory. Records older than Retention
+// are dropped; a zero Retention keeps them all.
+type Recorder struct {
+	Retention time.Duration
+
+	mu      sync.Mutex
+	records []agens.UsageRecord
+}
+
+func (r *Recorder) RecordUsage(_ context.Context, record agens.UsageRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.records = append(r.records, record)
+
+	if r.Retention > 0 {
+		cutoff := time.Now().Add(-r.Retention)
+		r.records = slices.DeleteFunc(r.records, func(record agens.UsageRecord) bool {
+			return record.Time.Before(cutoff)
+		})
+	}
+	return nil
+}
+
+// Records returns a copy of the records selected by the filter.
+func (r *Recorder) Records(filter agens.UsageFilter) []agens.UsageRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var records []agens.UsageRecord
+	for _, record := range r.records {
+		if filter.Match(record) {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func (r *Recorder) UsageByDay(_ context.Context, filter agens.UsageFilter) ([]agens.DailyUsage, error) {
+	totals := make(map[time.Time]*agens.UsageTotals)
+	for _, record := range r.Records(filter) {
+		day := record.Time.UTC().Truncate(24 * time.Hour)
+		if totals[day] == nil {
+			totals[day] = &agens.UsageTotals{}
+		}
+		totals[day].Add(record)
+	}
+
+	usage := make([]agens.DailyUsage, 0, len(totals))
+	for day, t := range totals {
+		usage = append(usage, agens.DailyUsage{Day: day, UsageTotals: *t})
+	}
+
+	slices.SortFunc(usage, func(a, b agens.DailyUsage) int {
+		return a.Day.Compare(b.Day)
+	})
+	return usage, nil
+}
+
+func (r *Recorder) UsageByUser(_ context.Context, filter agens.UsageFilter) ([]agens.UserUsage, error) {
+	totals := make(map[string]*agens.UsageTotals)
+	for _, record := range r.Records(filter) {
+		if totals[record.UserID] == nil {
+			totals[record.UserID] = &agens.UsageTotals{}
+		}
+		totals[record.UserID].Add(record)
+	}
+
+	usage := make([]agens.UserUsage, 0, len(totals))
+	for userID, t := range totals {
+		usage = append(usage, agens.UserUsage{UserID: userID, UsageTotals: *t})
+	}
+
+	slices.SortFunc(usage, func(a, b agens.UserUsage) int {
+		return strings.Compare(a.UserID, b.UserID)
+	})
+	return usage, nil
+}
@@ -0,0 +1,111 @@
+package pgmemory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gonzxlezs/agens"
+)
+
+// DefaultDeduplicationTTL is the default time a message is remembered.
+const DefaultDeduplicationTTL = 24 * time.Hour
+
+const (
+	// MarkSeenQuery inserts the key, or refreshes it if it has expired. No row
+	// is affected when the key was seen within the TTL.
+	MarkSeenQuery = `INSERT INTO processed_messages (key)
+	VALUES ($1)
+		ON CONFLICT (key)
+		DO UPDATE SET seen_at = NOW()
+		WHERE processed_messages.seen_at < NOW() - make_interval(secs => $2)`
+
+	ForgetSeenQuery = `DELETE FROM processed_messages WHERE key = $1`
+
+	PruneSeenQuery = `DELETE FROM processed_messages WHERE seen_at < NOW() - make_interval(secs => $1)`
+)
+
+var _ agens.MessageDeduplicator = &Deduplicator{}
+
+// Deduplicator remembers the seen keys in Postgres for TTL, so redelivered
+// messages are detected across replicas.
+type Deduplicator struct {
+	db  *sql.DB
+	ttl time.Duration
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+func NewDeduplicator(db *sql.DB, ttl time.Duration) (*Deduplicator, error) {
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	if err := runModuleMigration(db, "dedup", "migrations_dedup"); err != nil {
+		return nil, fmt.Errorf("dedup migrations failed: %w", err)
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultDeduplicationTTL
+	}
+
+	return &Deduplicator{db: db, ttl: ttl}, nil
+}
+
+func (d *Deduplicator) MarkSeen(ctx context.Context, key string) (bool, error) {
+	if d.db == nil {
+		return false, ErrDBNotInitialized
+	}
+
+	if err := d.prune(ctx); err != nil {
+		return false, err
+	}
+
+	res, err := d.db.ExecContext(ctx, MarkSeenQuery, key, d.ttl.Seconds())
+	if err != nil {
+		return false, fmt.Errorf("error marking message as seen: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 0, nil
+}
+
+func (d *Deduplicator) Forget(ctx context.Context, key string) error {
+	if d.db == nil {
+		return ErrDBNotInitialized
+	}
+
+	if _, err := d.db.ExecContext(ctx, ForgetSeenQuery, key); err != nil {
+		return fmt.Errorf("error forgetting seen message: %w", err)
+	}
+	return nil
+}
+
+func (d *Deduplicator) Close() error {
+	if d.db != nil {
+		return d.db.Close()
+	}
+	return nil
+}
+
+// prune deletes the expired keys, at most once per TTL.
+func (d *Deduplicator) prune(ctx context.Context) error {
+	d.mu.Lock()
+	if time.Since(d.lastPrune) < d.ttl {
+		d.mu.Unlock()
+		return nil
+	}
+	d.lastPrune = time.Now()
+	d.mu.Unlock()
+
+	if _, err := d.db.ExecContext(ctx, PruneSeenQuery, d.ttl.Seconds()); err != nil {
+		return fmt.Errorf("error pruning seen messages: %w", err)
+	}
+	return nil
+}
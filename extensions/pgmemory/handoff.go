@@ -0,0 +1,114 @@
+package pgmemory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/gonzxlezs/agens"
+)
+
+const (
+	IsPausedQuery = `SELECT EXISTS(
+        SELECT 1 FROM conversation_handoff
+            WHERE agent_name = $1
+            AND conversation_id = $2
+    )`
+
+	PauseQuery = `INSERT INTO conversation_handoff (
+	agent_name,
+	conversation_id
+	) VALUES ($1, $2)
+		ON CONFLICT (agent_name, conversation_id) DO NOTHING`
+
+	ResumeQuery = `DELETE FROM conversation_handoff WHERE agent_name = $1 AND conversation_id = $2`
+)
+
+var _ agens.HandoffProvider = &HandoffProvider{}
+var _ agens.HandoffMemory = &handoffMemory{}
+
+type HandoffProvider struct {
+	db *sql.DB
+}
+
+func NewHandoffProvider(db *sql.DB) (*HandoffProvider, error) {
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	if err := runModuleMigration(db, "handoff", "migrations_handoff"); err != nil {
+		return nil, fmt.Errorf("handoff migrations failed: %w", err)
+	}
+
+	return &HandoffProvider{db: db}, nil
+}
+
+func (p *HandoffProvider) ForAgent(agentName string) (agens.HandoffMemory, error) {
+	if p.db == nil {
+		return nil, ErrDBNotInitialized
+	}
+	return &handoffMemory{provider: p, agentName: agentName}, nil
+}
+
+func (p *HandoffProvider) Close() error {
+	if p.db != nil {
+		return p.db.Close()
+	}
+	return nil
+}
+
+func (p *HandoffProvider) isPaused(ctx context.Context, agentName string, conversationID string) (bool, error) {
+	if p.db == nil {
+		return false, ErrDBNotInitialized
+	}
+
+	var paused bool
+	err := p.db.QueryRowContext(ctx, IsPausedQuery, agentName, conversationID).Scan(&paused)
+	if err != nil {
+		return false, fmt.Errorf("error querying handoff: %w", err)
+	}
+	return paused, nil
+}
+
+func (p *HandoffProvider) pause(ctx context.Context, agentName string, conversationID string) error {
+	if p.db == nil {
+		return ErrDBNotInitialized
+	}
+
+	if _, err := p.db.ExecContext(ctx, PauseQuery, agentName, conversationID); err != nil {
+		return fmt.Errorf("error pausing conversation: %w", err)
+	}
+	return nil
+}
+
+func (p *HandoffProvider) resume(ctx context.Context, agentName string, conversationID string) error {
+	if p.db == nil {
+		return ErrDBNotInitialized
+	}
+
+	if _, err := p.db.ExecContext(ctx, ResumeQuery, agentName, conversationID); err != nil {
+		return fmt.Errorf("error resuming conversation: %w", err)
+	}
+	return nil
+}
+
+type handoffMemory struct {
+	provider  *HandoffProvider
+	agentName string
+}
+
+func (m *handoffMemory) IsPaused(ctx context.Context, conversationID string) (bool, error) {
+	return m.provider.isPaused(ctx, m.agentName, conversationID)
+}
+
+func (m *handoffMemory) Pause(ctx context.Context, conversationID string) error {
+	return m.provider.pause(ctx, m.agentName, conversationID)
+}
+
+func (m *handoffMemory) Resume(ctx context.Context, conversationID string) error {
+	return m.provider.resume(ctx, m.agentName, conversationID)
+}
+
+func (_ *handoffMemory) Close() error {
+	return nil
+}
@@ -36,6 +36,7 @@ var ErrDBNotInitialized = errors.New("pgmemory: database connection not initiali
 
 var _ agens.HistoryProvider = &HistoryProvider{}
 var _ agens.HistoryMemory = &historyMemory{}
+var _ agens.HistoryMessageDeleter = &historyMemory{}
 
 type HistoryProvider struct {
 	db *sql.DB
@@ -92,6 +93,40 @@ func (p *HistoryProvider) deleteHistory(ctx context.Context, agentName string, c
 	return nil
 }
 
+func (p *HistoryProvider) deleteMessages(ctx context.Context, agentName string, conversationID string, storedIDs []string) error {
+	if p.db == nil {
+		return ErrDBNotInitialized
+	}
+
+	if len(storedIDs) == 0 {
+		return nil
+	}
+
+	var (
+		placeholders []string
+		args         = []any{agentName, conversationID}
+	)
+	for _, storedID := range storedIDs {
+		id, err := strconv.ParseInt(storedID, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid stored ID %q: %w", storedID, err)
+		}
+
+		args = append(args, id)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+
+	stmt := fmt.Sprintf(
+		"DELETE FROM history WHERE agent_name = $1 AND conversation_id = $2 AND id IN (%s)",
+		strings.Join(placeholders, ", "),
+	)
+
+	if _, err := p.db.ExecContext(ctx, stmt, args...); err != nil {
+		return fmt.Errorf("error deleting messages: %w", err)
+	}
+	return nil
+}
+
 func (p *HistoryProvider) retrieveHistory(ctx context.Context, agentName string, conversationID string) ([]*ai.Message, error) {
 	if p.db == nil {
 		return nil, ErrDBNotInitialized
@@ -194,6 +229,10 @@ func (m *historyMemory) DeleteHistory(ctx context.Context, conversationID string
 	return m.provider.deleteHistory(ctx, m.agentName, conversationID)
 }
 
+func (m *historyMemory) DeleteMessages(ctx context.Context, conversationID string, storedIDs []string) error {
+	return m.provider.deleteMessages(ctx, m.agentName, conversationID, storedIDs)
+}
+
 func (m *historyMemory) RetrieveHistory(ctx context.Context, conversationID string) ([]*ai.Message, error) {
 	return m.provider.retrieveHistory(ctx, m.agentName, conversationID)
 }
@@ -164,6 +164,7 @@ func (p *KnowledgeProvider) ForAgent(agentName string, limit int) (agens.Knowled
 	return &knowledgeMemory{
 		provider:  p,
 		agentName: agentName,
+		limit:     limit,
 		asTool:    defineTool(p.g, p.retriever, p.cfg, agentName, limit),
 	}, nil
 }
@@ -245,6 +246,22 @@ func (p *KnowledgeProvider) indexKnowledge(ctx context.Context, agentName string
 	return nil
 }
 
+func (p *KnowledgeProvider) retrieveKnowledge(ctx context.Context, agentName string, query string, limit int) ([]*ai.Document, error) {
+	resp, err := genkit.Retrieve(
+		ctx, p.g,
+		ai.WithRetriever(p.retriever),
+		ai.WithConfig(&RetrieveOptions{
+			AgentName: agentName,
+			Limit:     limit,
+		}),
+		ai.WithTextDocs(query),
+	)
+	if err != nil {
+		return nil, errors.Join(ErrKnowledgeProviderFailure, err)
+	}
+	return resp.Documents, nil
+}
+
 func (p *KnowledgeProvider) isIndexed(ctx context.Context, agentName string, label string, content_hash string) (bool, error) {
 	if p.db == nil {
 		return false, ErrDBNotInitialized
@@ -265,6 +282,7 @@ type knowledgeMemory struct {
 	provider  *KnowledgeProvider
 	asTool    ai.Tool
 	agentName string
+	limit     int
 }
 
 func (k *knowledgeMemory) AsTool() ai.Tool {
@@ -279,6 +297,10 @@ func (k *knowledgeMemory) IndexKnowledge(ctx context.Context, label string, docs
 	return k.provider.indexKnowledge(ctx, k.agentName, label, docs)
 }
 
+func (k *knowledgeMemory) RetrieveKnowledge(ctx context.Context, query string) ([]*ai.Document, error) {
+	return k.provider.retrieveKnowledge(ctx, k.agentName, query, k.limit)
+}
+
 func calculateHash(content string) string {
 	h := sha256.New()
 	h.Write([]byte(content))
@@ -0,0 +1,109 @@
+package pgmemory
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+
+	"github.com/gonzxlezs/agens"
+)
+
+const (
+	AdvisoryLockQuery = `SELECT pg_advisory_lock(hashtextextended($1, 0))`
+
+	TryAdvisoryLockQuery = `SELECT pg_try_advisory_lock(hashtextextended($1, 0))`
+
+	AdvisoryUnlockQuery = `SELECT pg_advisory_unlock(hashtextextended($1, 0))`
+)
+
+var _ agens.ConversationLocker = &ConversationLocker{}
+
+// ConversationLocker serializes the runs of a conversation across instances
+// with Postgres session advisory locks. Each held lock keeps a dedicated
+// connection of the pool until it is released.
+type ConversationLocker struct {
+	db *sql.DB
+}
+
+func NewConversationLocker(db *sql.DB) (*ConversationLocker, error) {
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+	return &ConversationLocker{db: db}, nil
+}
+
+func (l *ConversationLocker) Lock(ctx context.Context, key string) (func(), error) {
+	conn, err := l.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.ExecContext(ctx, AdvisoryLockQuery, key); err != nil {
+		discardConn(conn)
+		return nil, fmt.Errorf("error acquiring advisory lock: %w", err)
+	}
+	return unlockFunc(conn, key), nil
+}
+
+func (l *ConversationLocker) TryLock(ctx context.Context, key string) (func(), bool, error) {
+	conn, err := l.conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var ok bool
+	if err := conn.QueryRowContext(ctx, TryAdvisoryLockQuery, key).Scan(&ok); err != nil {
+		discardConn(conn)
+		return nil, false, fmt.Errorf("error acquiring advisory lock: %w", err)
+	}
+
+	if !ok {
+		conn.Close()
+		return nil, false, nil
+	}
+	return unlockFunc(conn, key), true, nil
+}
+
+func (l *ConversationLocker) Close() error {
+	if l.db != nil {
+		return l.db.Close()
+	}
+	return nil
+}
+
+func (l *ConversationLocker) conn(ctx context.Context) (*sql.Conn, error) {
+	if l.db == nil {
+		return nil, ErrDBNotInitialized
+	}
+
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting connection: %w", err)
+	}
+	return conn, nil
+}
+
+func unlockFunc(conn *sql.Conn, key string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			// the run context may already be done, the lock must be released anyway
+			if _, err := conn.ExecContext(context.Background(), AdvisoryUnlockQuery, key); err != nil {
+				discardConn(conn)
+				return
+			}
+			conn.Close()
+		})
+	}
+}
+
+// discardConn closes the connection without returning it to the pool. The
+// session may hold the advisory lock (e.g. the context was cancelled while the
+// lock was being granted), and a session lock is only released when its
+// connection is closed.
+func discardConn(conn *sql.Conn) {
+	conn.Raw(func(any) error { return driver.ErrBadConn })
+	conn.Close()
+}
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_processed_messages_seen_at;
+
+DROP TABLE IF EXISTS processed_messages;
\ No newline at end of file
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS processed_messages (
+  key TEXT PRIMARY KEY,
+  seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_messages_seen_at ON processed_messages (seen_at ASC);
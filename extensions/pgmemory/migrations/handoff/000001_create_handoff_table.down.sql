@@ -0,0 +1 @@
+DROP TABLE IF EXISTS conversation_handoff;
\ No newline at end of file
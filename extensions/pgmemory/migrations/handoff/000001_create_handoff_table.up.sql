@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS conversation_handoff (
+  agent_name TEXT NOT NULL,
+  conversation_id TEXT NOT NULL,
+  paused_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (agent_name, conversation_id)
+);
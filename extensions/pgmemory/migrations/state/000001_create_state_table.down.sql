@@ -0,0 +1 @@
+DROP TABLE IF EXISTS conversation_state;
\ No newline at end of file
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS conversation_state (
+  agent_name TEXT NOT NULL,
+  conversation_id TEXT NOT NULL,
+  state JSONB NOT NULL DEFAULT '{}'::jsonb,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (agent_name, conversation_id)
+);
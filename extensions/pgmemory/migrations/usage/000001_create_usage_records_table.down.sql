@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_usage_records_user_id;
+
+DROP INDEX IF EXISTS idx_usage_records_agent_created_at;
+
+DROP TABLE IF EXISTS usage_records;
\ No newline at end of file
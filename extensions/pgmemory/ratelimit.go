@@ -0,0 +1,100 @@
+package pgmemory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/gonzxlezs/agens"
+)
+
+const (
+	InsertRateLimitBucketQuery = `INSERT INTO rate_limit_buckets (key, tokens)
+	VALUES ($1, $2)
+		ON CONFLICT (key) DO NOTHING`
+
+	SelectRateLimitBucketQuery = `SELECT tokens, EXTRACT(EPOCH FROM (clock_timestamp() - updated_at))
+    FROM rate_limit_buckets
+    WHERE key = $1
+    FOR UPDATE`
+
+	UpdateRateLimitBucketQuery = `UPDATE rate_limit_buckets
+    SET tokens = $2, updated_at = clock_timestamp()
+    WHERE key = $1`
+
+	RefundRateLimitBucketQuery = `UPDATE rate_limit_buckets
+    SET tokens = LEAST(tokens + 1, $2)
+    WHERE key = $1`
+)
+
+var _ agens.RateLimiter = &RateLimiter{}
+
+// RateLimiter keeps the token buckets in Postgres, so the limits hold across
+// replicas. The database clock is used to refill the buckets.
+type RateLimiter struct {
+	db *sql.DB
+}
+
+func NewRateLimiter(db *sql.DB) (*RateLimiter, error) {
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	if err := runModuleMigration(db, "ratelimit", "migrations_ratelimit"); err != nil {
+		return nil, fmt.Errorf("rate limit migrations failed: %w", err)
+	}
+
+	return &RateLimiter{db: db}, nil
+}
+
+func (l *RateLimiter) Reserve(ctx context.Context, key string, limit agens.RateLimit, maxDelay time.Duration) (time.Duration, bool, error) {
+	if l.db == nil {
+		return 0, false, ErrDBNotInitialized
+	}
+
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, InsertRateLimitBucketQuery, key, float64(max(limit.Burst, 1))); err != nil {
+		return 0, false, fmt.Errorf("error inserting rate limit bucket: %w", err)
+	}
+
+	var tokens, elapsed float64
+	err = tx.QueryRowContext(ctx, SelectRateLimitBucketQuery, key).Scan(&tokens, &elapsed)
+	if err != nil {
+		return 0, false, fmt.Errorf("error querying rate limit bucket: %w", err)
+	}
+
+	tokens, delay, allowed := limit.Take(tokens, time.Duration(elapsed*float64(time.Second)), maxDelay)
+
+	if _, err := tx.ExecContext(ctx, UpdateRateLimitBucketQuery, key, tokens); err != nil {
+		return 0, false, fmt.Errorf("error updating rate limit bucket: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, false, err
+	}
+	return delay, allowed, nil
+}
+
+func (l *RateLimiter) Refund(ctx context.Context, key string, limit agens.RateLimit) error {
+	if l.db == nil {
+		return ErrDBNotInitialized
+	}
+
+	if _, err := l.db.ExecContext(ctx, RefundRateLimitBucketQuery, key, float64(max(limit.Burst, 1))); err != nil {
+		return fmt.Errorf("error refunding rate limit bucket: %w", err)
+	}
+	return nil
+}
+
+func (l *RateLimiter) Close() error {
+	if l.db != nil {
+		return l.db.Close()
+	}
+	return nil
+}
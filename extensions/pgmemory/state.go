@@ -0,0 +1,136 @@
+package pgmemory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gonzxlezs/agens"
+)
+
+const (
+	GetStateQuery = `SELECT state
+    FROM conversation_state
+    WHERE agent_name = $1
+		AND conversation_id = $2`
+
+	SetStateQuery = `INSERT INTO conversation_state (
+	agent_name,
+	conversation_id,
+	state
+	) VALUES ($1, $2, jsonb_build_object($3::text, $4::jsonb))
+		ON CONFLICT (agent_name, conversation_id)
+		DO UPDATE SET
+			state = conversation_state.state || EXCLUDED.state,
+			updated_at = NOW()`
+
+	DeleteStateQuery = `UPDATE conversation_state
+    SET state = state - $3::text, updated_at = NOW()
+    WHERE agent_name = $1
+		AND conversation_id = $2`
+)
+
+var _ agens.StateProvider = &StateProvider{}
+var _ agens.StateMemory = &stateMemory{}
+
+type StateProvider struct {
+	db *sql.DB
+}
+
+func NewStateProvider(db *sql.DB) (*StateProvider, error) {
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	if err := runModuleMigration(db, "state", "migrations_state"); err != nil {
+		return nil, fmt.Errorf("state migrations failed: %w", err)
+	}
+
+	return &StateProvider{db: db}, nil
+}
+
+func (p *StateProvider) ForAgent(agentName string) (agens.StateMemory, error) {
+	if p.db == nil {
+		return nil, ErrDBNotInitialized
+	}
+	return &stateMemory{provider: p, agentName: agentName}, nil
+}
+
+func (p *StateProvider) Close() error {
+	if p.db != nil {
+		return p.db.Close()
+	}
+	return nil
+}
+
+func (p *StateProvider) getState(ctx context.Context, agentName string, conversationID string) (map[string]any, error) {
+	if p.db == nil {
+		return nil, ErrDBNotInitialized
+	}
+
+	var stateJSON []byte
+	err := p.db.QueryRowContext(ctx, GetStateQuery, agentName, conversationID).Scan(&stateJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return map[string]any{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error querying state: %w", err)
+	}
+
+	state := map[string]any{}
+	if err := json.Unmarshal(stateJSON, &state); err != nil {
+		return nil, fmt.Errorf("error unmarshaling state: %w", err)
+	}
+	return state, nil
+}
+
+func (p *StateProvider) setState(ctx context.Context, agentName string, conversationID string, key string, value any) error {
+	if p.db == nil {
+		return ErrDBNotInitialized
+	}
+
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("error serializing state value: %w", err)
+	}
+
+	_, err = p.db.ExecContext(ctx, SetStateQuery, agentName, conversationID, key, string(valueJSON))
+	if err != nil {
+		return fmt.Errorf("error setting state: %w", err)
+	}
+	return nil
+}
+
+func (p *StateProvider) deleteState(ctx context.Context, agentName string, conversationID string, key string) error {
+	if p.db == nil {
+		return ErrDBNotInitialized
+	}
+
+	_, err := p.db.ExecContext(ctx, DeleteStateQuery, agentName, conversationID, key)
+	if err != nil {
+		return fmt.Errorf("error deleting state: %w", err)
+	}
+	return nil
+}
+
+type stateMemory struct {
+	provider  *StateProvider
+	agentName string
+}
+
+func (m *stateMemory) GetState(ctx context.Context, conversationID string) (map[string]any, error) {
+	return m.provider.getState(ctx, m.agentName, conversationID)
+}
+
+func (m *stateMemory) SetState(ctx context.Context, conversationID string, key string, value any) error {
+	return m.provider.setState(ctx, m.agentName, conversationID, key, value)
+}
+
+func (m *stateMemory) DeleteState(ctx context.Context, conversationID string, key string) error {
+	return m.provider.deleteState(ctx, m.agentName, conversationID, key)
+}
+
+func (_ *stateMemory) Close() error {
+	return nil
+}
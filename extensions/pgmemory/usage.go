@@ -0,0 +1,182 @@
+package pgmemory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/gonzxlezs/agens"
+)
+
+const (
+	InsertUsageRecordQuery = `INSERT INTO usage_records (
+	agent_name,
+	conversation_id,
+	user_id,
+	model_name,
+	input_tokens,
+	output_tokens,
+	total_tokens,
+	tool_calls,
+	latency_ms,
+	cost,
+	created_at
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+	usageTotalsColumns = `COUNT(*), COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0),
+	COALESCE(SUM(total_tokens), 0), COALESCE(SUM(tool_calls), 0), COALESCE(SUM(cost), 0)`
+
+	usageFilterClause = `WHERE ($1 = '' OR agent_name = $1)
+		AND ($2 = '' OR conversation_id = $2)
+		AND ($3 = '' OR user_id = $3)
+		AND ($4::timestamptz IS NULL OR created_at >= $4)
+		AND ($5::timestamptz IS NULL OR created_at < $5)`
+
+	UsageByDayQuery = `SELECT date_trunc('day', created_at AT TIME ZONE 'UTC') AS day, ` + usageTotalsColumns + `
+    FROM usage_records
+    ` + usageFilterClause + `
+    GROUP BY day
+    ORDER BY day ASC`
+
+	UsageByUserQuery = `SELECT user_id, ` + usageTotalsColumns + `
+    FROM usage_records
+    ` + usageFilterClause + `
+    GROUP BY user_id
+    ORDER BY user_id ASC`
+)
+
+var _ agens.UsageStore = &UsageRecorder{}
+
+// UsageRecorder keeps the usage records in Postgres.
+type UsageRecorder struct {
+	db *sql.DB
+}
+
+func NewUsageRecorder(db *sql.DB) (*UsageRecorder, error) {
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	if err := runModuleMigration(db, "usage", "migrations_usage"); err != nil {
+		return nil, fmt.Errorf("usage migrations failed: %w", err)
+	}
+
+	return &UsageRecorder{db: db}, nil
+}
+
+func (r *UsageRecorder) RecordUsage(ctx context.Context, record agens.UsageRecord) error {
+	if r.db == nil {
+		return ErrDBNotInitialized
+	}
+
+	createdAt := record.Time
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	_, err := r.db.ExecContext(ctx, InsertUsageRecordQuery,
+		record.AgentName,
+		record.ConversationID,
+		record.UserID,
+		record.ModelName,
+		record.InputTokens,
+		record.OutputTokens,
+		record.TotalTokens,
+		record.ToolCalls,
+		record.Latency.Milliseconds(),
+		record.Cost,
+		createdAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error inserting usage record: %w", err)
+	}
+	return nil
+}
+
+func (r *UsageRecorder) UsageByDay(ctx context.Context, filter agens.UsageFilter) ([]agens.DailyUsage, error) {
+	if r.db == nil {
+		return nil, ErrDBNotInitialized
+	}
+
+	rows, err := r.db.QueryContext(ctx, UsageByDayQuery, usageFilterArgs(filter)...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying usage by day: %w", err)
+	}
+	defer rows.Close()
+
+	var usage []agens.DailyUsage
+	for rows.Next() {
+		var (
+			day    time.Time
+			totals agens.UsageTotals
+		)
+
+		if err := rows.Scan(append([]any{&day}, usageTotalsDest(&totals)...)...); err != nil {
+			return nil, fmt.Errorf("error scanning usage by day: %w", err)
+		}
+
+		usage = append(usage, agens.DailyUsage{
+			Day:         time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC),
+			UsageTotals: totals,
+		})
+	}
+	return usage, rows.Err()
+}
+
+func (r *UsageRecorder) UsageByUser(ctx context.Context, filter agens.UsageFilter) ([]agens.UserUsage, error) {
+	if r.db == nil {
+		return nil, ErrDBNotInitialized
+	}
+
+	rows, err := r.db.QueryContext(ctx, UsageByUserQuery, usageFilterArgs(filter)...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying usage by user: %w", err)
+	}
+	defer rows.Close()
+
+	var usage []agens.UserUsage
+	for rows.Next() {
+		var (
+			userID string
+			totals agens.UsageTotals
+		)
+
+		if err := rows.Scan(append([]any{&userID}, usageTotalsDest(&totals)...)...); err != nil {
+			return nil, fmt.Errorf("error scanning usage by user: %w", err)
+		}
+
+		usage = append(usage, agens.UserUsage{UserID: userID, UsageTotals: totals})
+	}
+	return usage, rows.Err()
+}
+
+func (r *UsageRecorder) Close() error {
+	if r.db != nil {
+		return r.db.Close()
+	}
+	return nil
+}
+
+func usageFilterArgs(filter agens.UsageFilter) []any {
+	var from, to any
+	if !filter.From.IsZero() {
+		from = filter.From
+	}
+	if !filter.To.IsZero() {
+		to = filter.To
+	}
+
+	return []any{filter.AgentName, filter.ConversationID, filter.UserID, from, to}
+}
+
+func usageTotalsDest(totals *agens.UsageTotals) []any {
+	return []any{
+		&totals.Runs,
+		&totals.InputTokens,
+		&totals.OutputTokens,
+		&totals.TotalTokens,
+		&totals.ToolCalls,
+		&totals.Cost,
+	}
+}
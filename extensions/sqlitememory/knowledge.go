@@ -0,0 +1,459 @@
+package sqlitememory
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/core/api"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/gonzxlezs/agens"
+)
+
+const Provider = "sqlitememory"
+
+const (
+	DeleteByLabelQuery = `DELETE FROM knowledge_embeddings WHERE agent_name = ? AND embedder_name = ? AND label = ?`
+
+	IndexKnowledgeQuery = `INSERT INTO knowledge_embeddings (
+	agent_name,
+	embedder_name,
+	label,
+	content,
+	content_hash,
+	embedding
+	) VALUES (?, ?, ?, ?, ?, ?)`
+
+	IsIndexedQuery = `SELECT EXISTS(
+        SELECT 1 FROM knowledge_embeddings
+            WHERE agent_name = ?
+            AND embedder_name = ?
+            AND label = ?
+            AND content_hash = ?
+    )`
+
+	// RetrieveKnowledgeQuery selects every candidate of the agent; they are
+	// ranked in Go by inner product, like the <#> operator of pgvector.
+	RetrieveKnowledgeQuery = `SELECT label, content, embedding
+    FROM knowledge_embeddings
+    WHERE agent_name = ?
+      AND embedder_name = ?`
+)
+
+const (
+	StatusKnowledgeSuccess = "success"
+
+	StatusKnowledgeNoResults = "no_results"
+)
+
+const labelKey = "label"
+
+var (
+	ErrKnowledgeProviderFailure = fmt.Errorf("sqlitememory: knowledge provider failure")
+
+	ErrInvalidRetrieveOptions = errors.New("sqlitememory: invalid or missing retrieval options")
+)
+
+var _ agens.KnowledgeProvider = &KnowledgeProvider{}
+var _ agens.KnowledgeMemory = &knowledgeMemory{}
+
+type (
+	KnowledgeQuery struct {
+		Query string `json:"query" jsonschema_description:"The specific search query or keywords to retrieve relevant information from the knowledge base. Should be clear and focused on the topic."`
+	}
+
+	DocumentResult struct {
+		Label   string `json:"label" jsonschema_description:"The category or source label of the retrieved document."`
+		Content string `json:"content" jsonschema_description:"The text content of the retrieved document."`
+	}
+
+	KnowledgeResponse struct {
+		Results []DocumentResult `json:"results" jsonschema_description:"List of relevant documents found."`
+		Count   int              `json:"count" jsonschema_description:"Number of documents retrieved. 0 if nothing was found."`
+		Status  string           `json:"status" jsonschema:"enum=success,enum=,description=The outcome of the retrieval operation."`
+	}
+)
+
+type RetrieveOptions struct {
+	AgentName string
+	Limit     int
+}
+
+type KnowledgeProviderConfig struct {
+	Name             string
+	Description      string
+	Embedder         ai.Embedder
+	EmbedderName     string
+	RetrieverOptions *ai.RetrieverOptions
+	EmbedderOptions  []ai.EmbedderOption
+}
+
+func (cfg *KnowledgeProviderConfig) resolveEmbedderName() string {
+	if cfg.Embedder != nil {
+		return cfg.Embedder.Name()
+	}
+	return cfg.EmbedderName
+}
+
+func (cfg *KnowledgeProviderConfig) resolveEmbedderOptions(additionalOptions ...ai.EmbedderOption) []ai.EmbedderOption {
+	embedderOpts := make([]ai.EmbedderOption, 0, len(cfg.EmbedderOptions)+len(additionalOptions)+1)
+
+	embedderOpts = append(embedderOpts, cfg.EmbedderOptions...)
+	embedderOpts = append(embedderOpts, additionalOptions...)
+
+	if cfg.Embedder != nil {
+		embedderOpts = append(embedderOpts, ai.WithEmbedder(cfg.Embedder))
+	} else if cfg.EmbedderName != "" {
+		embedderOpts = append(embedderOpts, ai.WithEmbedderName(cfg.EmbedderName))
+	}
+
+	return embedderOpts
+}
+
+// KnowledgeProvider stores the embeddings in SQLite and searches them by
+// brute force, which is fast enough for the few thousand documents of a
+// typical agent.
+type KnowledgeProvider struct {
+	g   *genkit.Genkit
+	db  *sql.DB
+	cfg *KnowledgeProviderConfig
+
+	retriever ai.Retriever
+}
+
+func NewKnowledgeProvider(g *genkit.Genkit, db *sql.DB, cfg KnowledgeProviderConfig) (*KnowledgeProvider, error) {
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	if err := runModuleMigration(db, "knowledge", "migrations_knowledge"); err != nil {
+		return nil, fmt.Errorf("knowledge migrations failed: %w", err)
+	}
+
+	retriever := defineRetriever(g, db, &cfg)
+
+	return &KnowledgeProvider{
+		g:         g,
+		db:        db,
+		cfg:       &cfg,
+		retriever: retriever,
+	}, nil
+}
+
+func (p *KnowledgeProvider) ForAgent(agentName string, limit int) (agens.KnowledgeMemory, error) {
+	return &knowledgeMemory{
+		provider:  p,
+		agentName: agentName,
+		limit:     limit,
+		asTool:    defineTool(p.g, p.retriever, p.cfg, agentName, limit),
+	}, nil
+}
+
+func (p *KnowledgeProvider) deleteKnowledge(ctx context.Context, agentName string, label string) error {
+	if p.db == nil {
+		return ErrDBNotInitialized
+	}
+
+	_, err := p.db.ExecContext(ctx, DeleteByLabelQuery, agentName, p.cfg.resolveEmbedderName(), label)
+	if err != nil {
+		return fmt.Errorf("error deleting knowledge: %w", err)
+	}
+	return nil
+}
+
+func (p *KnowledgeProvider) indexKnowledge(ctx context.Context, agentName string, label string, docs []*ai.Document) error {
+	if p.db == nil {
+		return ErrDBNotInitialized
+	}
+
+	var (
+		docsToEmbed   []*ai.Document
+		hashesToEmbed []string
+	)
+
+	for _, doc := range docs {
+		content := documentToText(doc)
+		if content == "" {
+			continue
+		}
+
+		cHash := calculateHash(content)
+
+		exists, err := p.isIndexed(ctx, agentName, label, cHash)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			docsToEmbed = append(docsToEmbed, doc)
+			hashesToEmbed = append(hashesToEmbed, cHash)
+		}
+	}
+
+	if len(docsToEmbed) == 0 {
+		return nil
+	}
+
+	res, err := genkit.Embed(
+		ctx,
+		p.g,
+		p.cfg.resolveEmbedderOptions(
+			ai.WithDocs(docsToEmbed...),
+		)...,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	embedderName := p.cfg.resolveEmbedderName()
+
+	for i, emb := range res.Embeddings {
+		content := documentToText(docsToEmbed[i])
+		currentHash := hashesToEmbed[i]
+		embedding := encodeEmbedding(emb.Embedding)
+
+		_, err := tx.ExecContext(ctx, IndexKnowledgeQuery, agentName, embedderName, label, content, currentHash, embedding)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (p *KnowledgeProvider) retrieveKnowledge(ctx context.Context, agentName string, query string, limit int) ([]*ai.Document, error) {
+	resp, err := genkit.Retrieve(
+		ctx, p.g,
+		ai.WithRetriever(p.retriever),
+		ai.WithConfig(&RetrieveOptions{
+			AgentName: agentName,
+			Limit:     limit,
+		}),
+		ai.WithTextDocs(query),
+	)
+	if err != nil {
+		return nil, errors.Join(ErrKnowledgeProviderFailure, err)
+	}
+	return resp.Documents, nil
+}
+
+func (p *KnowledgeProvider) isIndexed(ctx context.Context, agentName string, label string, content_hash string) (bool, error) {
+	if p.db == nil {
+		return false, ErrDBNotInitialized
+	}
+
+	var exists bool
+	err := p.db.QueryRowContext(ctx, IsIndexedQuery, agentName, p.cfg.resolveEmbedderName(), label, content_hash).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("database error: %v", err)
+	}
+	return exists, nil
+}
+
+type knowledgeMemory struct {
+	provider  *KnowledgeProvider
+	asTool    ai.Tool
+	agentName string
+	limit     int
+}
+
+func (k *knowledgeMemory) AsTool() ai.Tool {
+	return k.asTool
+}
+
+func (k *knowledgeMemory) DeleteKnowledge(ctx context.Context, label string) error {
+	return k.provider.deleteKnowledge(ctx, k.agentName, label)
+}
+
+func (k *knowledgeMemory) IndexKnowledge(ctx context.Context, label string, docs []*ai.Document) error {
+	return k.provider.indexKnowledge(ctx, k.agentName, label, docs)
+}
+
+func (k *knowledgeMemory) RetrieveKnowledge(ctx context.Context, query string) ([]*ai.Document, error) {
+	return k.provider.retrieveKnowledge(ctx, k.agentName, query, k.limit)
+}
+
+func calculateHash(content string) string {
+	h := sha256.New()
+	h.Write([]byte(content))
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// encodeEmbedding encodes the embedding as little-endian float32 values.
+func encodeEmbedding(embedding []float32) []byte {
+	b := make([]byte, 4*len(embedding))
+	for i, v := range embedding {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(v))
+	}
+	return b
+}
+
+// innerProduct returns the inner product of the query and an encoded
+// embedding. ok is false if their dimensions differ.
+func innerProduct(query []float32, encoded []byte) (score float64, ok bool) {
+	if len(encoded) != 4*len(query) {
+		return 0, false
+	}
+
+	for i, q := range query {
+		v := math.Float32frombits(binary.LittleEndian.Uint32(encoded[4*i:]))
+		score += float64(q) * float64(v)
+	}
+	return score, true
+}
+
+func defineRetriever(g *genkit.Genkit, db *sql.DB, cfg *KnowledgeProviderConfig) ai.Retriever {
+	f := func(ctx context.Context, req *ai.RetrieverRequest) (*ai.RetrieverResponse, error) {
+		opts, ok := req.Options.(*RetrieveOptions)
+		if !ok || opts == nil {
+			return nil, ErrInvalidRetrieveOptions
+		}
+
+		if opts.Limit <= 0 {
+			// Default limit if not specified or invalid
+			opts.Limit = 3
+		}
+
+		eres, err := genkit.Embed(
+			ctx,
+			g,
+			cfg.resolveEmbedderOptions(ai.WithDocs(req.Query))...,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rows, err := db.QueryContext(
+			ctx,
+			RetrieveKnowledgeQuery,
+			opts.AgentName,
+			cfg.resolveEmbedderName(),
+		)
+
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		type match struct {
+			label   string
+			content string
+			score   float64
+		}
+
+		var (
+			queryEmbedding = eres.Embeddings[0].Embedding
+			matches        []match
+		)
+		for rows.Next() {
+			var (
+				m         match
+				embedding []byte
+			)
+			if err := rows.Scan(&m.label, &m.content, &embedding); err != nil {
+				return nil, err
+			}
+
+			// Embeddings of another dimension cannot be compared.
+			if m.score, ok = innerProduct(queryEmbedding, embedding); ok {
+				matches = append(matches, m)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		slices.SortStableFunc(matches, func(a, b match) int {
+			return cmp.Compare(b.score, a.score)
+		})
+		if len(matches) > opts.Limit {
+			matches = matches[:opts.Limit]
+		}
+
+		res := &ai.RetrieverResponse{}
+		for _, m := range matches {
+			res.Documents = append(
+				res.Documents,
+				ai.DocumentFromText(m.content, map[string]any{
+					labelKey: m.label,
+				}),
+			)
+		}
+
+		return res, nil
+	}
+
+	return genkit.DefineRetriever(g, api.NewName(Provider, cfg.Name), cfg.RetrieverOptions, f)
+}
+
+func defineTool(g *genkit.Genkit, retriever ai.Retriever, cfg *KnowledgeProviderConfig, agentName string, limit int) ai.Tool {
+	toolName := fmt.Sprintf("%s_%s_tool", agentName, cfg.Name)
+
+	f := func(ctx *ai.ToolContext, query KnowledgeQuery) (KnowledgeResponse, error) {
+		resp, err := genkit.Retrieve(
+			ctx, g,
+			ai.WithRetriever(retriever),
+			ai.WithConfig(&RetrieveOptions{
+				AgentName: agentName,
+				Limit:     limit,
+			}),
+			ai.WithTextDocs(query.Query),
+		)
+		if err != nil {
+			return KnowledgeResponse{}, errors.Join(ErrKnowledgeProviderFailure, err)
+		}
+
+		kResponse := KnowledgeResponse{
+			Count:  len(resp.Documents),
+			Status: StatusKnowledgeNoResults,
+		}
+
+		if kResponse.Count < 1 {
+			return kResponse, nil
+		}
+		kResponse.Status = StatusKnowledgeSuccess
+
+		for _, doc := range resp.Documents {
+			label, _ := doc.Metadata[labelKey].(string)
+			if label == "" {
+				label = "unlabeled"
+			}
+
+			kResponse.Results = append(
+				kResponse.Results,
+				DocumentResult{
+					Label:   label,
+					Content: documentToText(doc),
+				},
+			)
+		}
+		return kResponse, nil
+	}
+
+	return genkit.DefineTool(g, toolName, cfg.Description, f)
+}
+
+func documentToText(doc *ai.Document) string {
+	var b strings.Builder
+	for _, part := range doc.Content {
+		b.WriteString(part.Text)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS enforce_message_limit;
+
+DROP TABLE IF EXISTS history_agent_limits;
+
+DROP INDEX IF EXISTS idx_history_agent_context;
+
+DROP TABLE IF EXISTS history;
@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS history (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  agent_name TEXT NOT NULL,
+  conversation_id TEXT NOT NULL,
+  message TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_history_agent_context ON history (agent_name, conversation_id);
+
+CREATE TABLE IF NOT EXISTS history_agent_limits (
+  agent_name TEXT PRIMARY KEY,
+  max_msgs_conversation INTEGER NOT NULL
+);
+
+-- enforce_message_limit keeps the last max_msgs_conversation messages of the
+-- conversation, like the limit_messages_per_conversation trigger of pgmemory.
+-- The ids grow with the insertion order, so they are used instead of created_at.
+CREATE TRIGGER IF NOT EXISTS enforce_message_limit
+AFTER INSERT ON history FOR EACH ROW
+BEGIN
+DELETE FROM history
+WHERE id IN (
+        SELECT id
+        FROM history
+        WHERE agent_name = NEW.agent_name
+            AND conversation_id = NEW.conversation_id
+        ORDER BY id DESC -- Order by newest messages first
+        LIMIT -1 OFFSET COALESCE(
+            (
+                SELECT max_msgs_conversation
+                FROM history_agent_limits
+                WHERE agent_name = NEW.agent_name
+            ),
+            10
+        ) -- Skip the messages within the limit
+    );
+END;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_knowledge_lookup;
+
+DROP INDEX IF EXISTS idx_knowledge_agent_model_label;
+
+DROP TABLE IF EXISTS knowledge_embeddings;
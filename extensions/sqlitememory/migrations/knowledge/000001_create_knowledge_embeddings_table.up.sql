@@ -0,0 +1,18 @@
+-- The embeddings are stored as little-endian float32 blobs and searched by
+-- brute force, so a single table serves every dimension.
+CREATE TABLE IF NOT EXISTS knowledge_embeddings (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  agent_name TEXT NOT NULL,
+  embedder_name TEXT NOT NULL,
+  label TEXT NOT NULL,
+  content TEXT NOT NULL,
+  content_hash TEXT NOT NULL,
+  embedding BLOB NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_knowledge_agent_model_label
+  ON knowledge_embeddings (agent_name, embedder_name, label);
+
+CREATE INDEX IF NOT EXISTS idx_knowledge_lookup
+  ON knowledge_embeddings (agent_name, embedder_name, content_hash);
@@ -0,0 +1,165 @@
+package sqlitememory
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/gonzxlezs/agens"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "agens.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestHistoryLimitAndStoredIDs(t *testing.T) {
+	ctx := context.Background()
+
+	p, err := NewHistoryProvider(openDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memory, err := p.ForAgent("agent", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = memory.StoreHistory(ctx, "conv", []*ai.Message{
+		ai.NewSystemTextMessage("system"),
+		ai.NewUserTextMessage("one"),
+		ai.NewModelTextMessage("two"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := memory.RetrieveHistory(ctx, "conv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("stored %d messages, want 2", len(history))
+	}
+	if id, _ := agens.GetStoredID(history[0]); id == "" {
+		t.Error("the retrieved message has no stored ID")
+	}
+
+	// the retrieved messages are skipped and the oldest ones trimmed
+	history = append(history, ai.NewUserTextMessage("three"), ai.NewModelTextMessage("four"))
+	if err := memory.StoreHistory(ctx, "conv", history); err != nil {
+		t.Fatal(err)
+	}
+
+	history, _ = memory.RetrieveHistory(ctx, "conv")
+	var texts []string
+	for _, msg := range history {
+		texts = append(texts, msg.Text())
+	}
+	if strings.Join(texts, " ") != "two three four" {
+		t.Errorf("history = %v, want [two three four]", texts)
+	}
+
+	// single messages are deleted by their stored IDs
+	threeID, _ := agens.GetStoredID(history[1])
+	if err := memory.(agens.HistoryMessageDeleter).DeleteMessages(ctx, "conv", []string{threeID}); err != nil {
+		t.Fatal(err)
+	}
+	if history, _ := memory.RetrieveHistory(ctx, "conv"); len(history) != 2 || history[1].Text() != "four" {
+		t.Errorf("%d messages after deleting %q, want [two four]", len(history), threeID)
+	}
+
+	if err := memory.DeleteHistory(ctx, "conv"); err != nil {
+		t.Fatal(err)
+	}
+	if history, _ := memory.RetrieveHistory(ctx, "conv"); len(history) != 0 {
+		t.Errorf("%d messages after delete, want 0", len(history))
+	}
+}
+
+// defineKeywordEmbedder defines an embedder with one dimension per keyword.
+func defineKeywordEmbedder(g *genkit.Genkit, keywords ...string) (ai.Embedder, *int) {
+	var embedded int
+	embedder := genkit.DefineEmbedder(g, "test/keywords", nil, func(_ context.Context, req *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+		resp := &ai.EmbedResponse{}
+		for _, doc := range req.Input {
+			text := strings.ToLower(documentToText(doc))
+
+			embedding := make([]float32, len(keywords))
+			for i, keyword := range keywords {
+				if strings.Contains(text, keyword) {
+					embedding[i] = 1
+				}
+			}
+
+			embedded++
+			resp.Embeddings = append(resp.Embeddings, &ai.Embedding{Embedding: embedding})
+		}
+		return resp, nil
+	})
+	return embedder, &embedded
+}
+
+func TestKnowledgeIndexAndRetrieve(t *testing.T) {
+	ctx := context.Background()
+	g := genkit.Init(ctx)
+	embedder, embedded := defineKeywordEmbedder(g, "shipping", "refund", "store")
+
+	p, err := NewKnowledgeProvider(g, openDB(t), KnowledgeProviderConfig{
+		Name:     "faq",
+		Embedder: embedder,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memory, err := p.ForAgent("agent", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := []*ai.Document{
+		ai.DocumentFromText("Shipping is free.", nil),
+		ai.DocumentFromText("Refunds take 5 days.", nil),
+	}
+	if err := memory.IndexKnowledge(ctx, "faq", docs); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same contents are not embedded again
+	if err := memory.IndexKnowledge(ctx, "faq", docs); err != nil {
+		t.Fatal(err)
+	}
+	if *embedded != 2 {
+		t.Errorf("embedded %d documents, want 2", *embedded)
+	}
+
+	results, err := memory.RetrieveKnowledge(ctx, "how long for a refund?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !strings.Contains(documentToText(results[0]), "Refunds") {
+		t.Fatalf("results = %v, want the refund document", results)
+	}
+	if label := results[0].Metadata[labelKey]; label != "faq" {
+		t.Errorf("label = %v, want faq", label)
+	}
+
+	if err := memory.DeleteKnowledge(ctx, "faq"); err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := memory.RetrieveKnowledge(ctx, "refund"); len(results) != 0 {
+		t.Errorf("%d results after delete, want 0", len(results))
+	}
+}
@@ -0,0 +1,222 @@
+package summarymemory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gonzxlezs/agens"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+const (
+	// SummaryKey is the key used in message metadata to mark the summary message.
+	SummaryKey = "summary"
+
+	// SummaryPrefix is prepended to the text of the summary message.
+	SummaryPrefix = "Summary of the earlier conversation:\n"
+
+	DefaultKeepMessages = 4
+
+	DefaultInstructions = `You condense conversations between a user and an AI assistant.
+Write a concise summary of the conversation below, keeping every fact, decision,
+name, number and open question that may be needed to continue it.
+If the conversation starts with a previous summary, merge it into the new one.`
+)
+
+var (
+	ErrInvalidThreshold = errors.New("summarymemory: threshold must be greater than the number of kept messages")
+
+	// ErrDeleteMessagesNotSupported is returned when the wrapped memory does not
+	// implement agens.HistoryMessageDeleter.
+	ErrDeleteMessagesNotSupported = errors.New("summarymemory: wrapped history memory cannot delete messages")
+)
+
+var _ agens.HistoryProvider = &HistoryProvider{}
+var _ agens.HistoryMemory = &historyMemory{}
+
+type Config struct {
+	// Model is the AI model used to summarize the conversation.
+	// If specified, it takes precedence over ModelName.
+	Model ai.ModelArg
+
+	// ModelName is the name of the AI model used to summarize the conversation.
+	// It is used only if Model is not defined (nil).
+	ModelName string
+
+	// Threshold is the number of stored messages above which the older ones are
+	// condensed into a summary. It should be lower than the message limit of
+	// the wrapped provider, so messages are summarized before being trimmed.
+	Threshold int
+
+	// KeepMessages is the number of most recent messages kept verbatim after
+	// summarizing. Defaults to DefaultKeepMessages.
+	KeepMessages int
+
+	// Instructions is the system message given to the summarization model.
+	// Defaults to DefaultInstructions.
+	Instructions string
+}
+
+// HistoryProvider wraps another agens.HistoryProvider (e.g. pgmemory) and
+// condenses old messages into a persisted summary message once the history
+// of a conversation exceeds the configured threshold. The memories of the
+// wrapped provider must implement agens.HistoryMessageDeleter.
+type HistoryProvider struct {
+	g    *genkit.Genkit
+	base agens.HistoryProvider
+	cfg  *Config
+}
+
+func NewHistoryProvider(g *genkit.Genkit, base agens.HistoryProvider, cfg Config) (*HistoryProvider, error) {
+	if cfg.KeepMessages <= 0 {
+		cfg.KeepMessages = DefaultKeepMessages
+	}
+
+	if cfg.Instructions == "" {
+		cfg.Instructions = DefaultInstructions
+	}
+
+	if cfg.Threshold <= cfg.KeepMessages {
+		return nil, ErrInvalidThreshold
+	}
+
+	return &HistoryProvider{g: g, base: base, cfg: &cfg}, nil
+}
+
+func (p *HistoryProvider) ForAgent(agentName string, maxMessages int) (agens.HistoryMemory, error) {
+	base, err := p.base.ForAgent(agentName, maxMessages)
+	if err != nil {
+		return nil, err
+	}
+	deleter, ok := base.(agens.HistoryMessageDeleter)
+	if !ok {
+		return nil, ErrDeleteMessagesNotSupported
+	}
+	return &historyMemory{provider: p, base: base, deleter: deleter}, nil
+}
+
+func (p *HistoryProvider) summarize(ctx context.Context, messages []*ai.Message) (string, error) {
+	var b strings.Builder
+	for _, msg := range messages {
+		text := msg.Text()
+		if text == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "%s: %s\n", msg.Role, text)
+	}
+
+	opts := []ai.GenerateOption{
+		ai.WithSystem("%s", p.cfg.Instructions),
+		ai.WithPrompt("%s", b.String()),
+	}
+
+	if p.cfg.Model != nil {
+		opts = append(opts, ai.WithModel(p.cfg.Model))
+	} else if p.cfg.ModelName != "" {
+		opts = append(opts, ai.WithModelName(p.cfg.ModelName))
+	}
+
+	return genkit.GenerateText(ctx, p.g, opts...)
+}
+
+type historyMemory struct {
+	provider *HistoryProvider
+	base     agens.HistoryMemory
+	deleter  agens.HistoryMessageDeleter
+}
+
+func (m *historyMemory) DeleteHistory(ctx context.Context, conversationID string) error {
+	return m.base.DeleteHistory(ctx, conversationID)
+}
+
+// RetrieveHistory returns the history of the wrapped memory with the summary
+// message, if any, placed first.
+func (m *historyMemory) RetrieveHistory(ctx context.Context, conversationID string) ([]*ai.Message, error) {
+	history, err := m.base.RetrieveHistory(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, msg := range history {
+		if IsSummary(msg) {
+			if i > 0 {
+				copy(history[1:i+1], history[:i])
+				history[0] = msg
+			}
+			break
+		}
+	}
+	return history, nil
+}
+
+// StoreHistory stores the messages in the wrapped memory and, if the history
+// exceeds the threshold, replaces the older messages with a summary. The
+// summary is stored before the summarized messages are deleted, so a failure
+// never loses history, and only those are deleted, so the messages stored
+// meanwhile are kept.
+func (m *historyMemory) StoreHistory(ctx context.Context, conversationID string, messages []*ai.Message) error {
+	if err := m.base.StoreHistory(ctx, conversationID, messages); err != nil {
+		return err
+	}
+
+	history, err := m.RetrieveHistory(ctx, conversationID)
+	if err != nil {
+		return err
+	}
+
+	if len(history) <= m.provider.cfg.Threshold {
+		return nil
+	}
+
+	// keep the most recent messages, without separating tool responses from their requests
+	split := len(history) - m.provider.cfg.KeepMessages
+	for (split > 0) && (history[split].Role == ai.RoleTool) {
+		split--
+	}
+	if split <= 0 {
+		return nil
+	}
+
+	summary, err := m.provider.summarize(ctx, history[:split])
+	if err != nil {
+		return fmt.Errorf("summarymemory: error summarizing history: %w", err)
+	}
+
+	if err := m.base.StoreHistory(ctx, conversationID, []*ai.Message{NewSummaryMessage(summary)}); err != nil {
+		return err
+	}
+
+	storedIDs := make([]string, 0, split)
+	for _, msg := range history[:split] {
+		if storedID, _ := agens.GetStoredID(msg); storedID != "" {
+			storedIDs = append(storedIDs, storedID)
+		}
+	}
+	return m.deleter.DeleteMessages(ctx, conversationID, storedIDs)
+}
+
+func (m *historyMemory) Close() error {
+	return m.base.Close()
+}
+
+// NewSummaryMessage creates a summary message marked with SummaryKey.
+func NewSummaryMessage(summary string) *ai.Message {
+	return ai.NewMessage(
+		ai.RoleUser,
+		map[string]any{SummaryKey: true},
+		ai.NewTextPart(SummaryPrefix+summary),
+	)
+}
+
+// IsSummary reports whether the message is a summary message.
+func IsSummary(msg *ai.Message) bool {
+	if (msg == nil) || (msg.Metadata == nil) {
+		return false
+	}
+	v, _ := msg.Metadata[SummaryKey].(bool)
+	return v
+}
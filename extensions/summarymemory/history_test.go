@@ -0,0 +1,237 @@
+package summarymemory_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/gonzxlezs/agens"
+	"github.com/gonzxlezs/agens/agenstest"
+	"github.com/gonzxlezs/agens/extensions/summarymemory"
+)
+
+const conversationID = "chat"
+
+func newMemory(t *testing.T, base agens.HistoryProvider, threshold int, keep int) (agens.HistoryMemory, *agenstest.FakeModel) {
+	t.Helper()
+
+	g := genkit.Init(context.Background())
+	model := agenstest.DefineFakeModel(g, "")
+
+	provider, err := summarymemory.NewHistoryProvider(g, base, summarymemory.Config{
+		Model:        model,
+		Threshold:    threshold,
+		KeepMessages: keep,
+	})
+	if err != nil {
+		t.Fatalf("NewHistoryProvider: %v", err)
+	}
+
+	memory, err := provider.ForAgent("tester", 0)
+	if err != nil {
+		t.Fatalf("ForAgent: %v", err)
+	}
+	return memory, model
+}
+
+func texts(messages []*ai.Message) []string {
+	texts := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		texts = append(texts, msg.Text())
+	}
+	return texts
+}
+
+func conversation(texts ...string) []*ai.Message {
+	messages := make([]*ai.Message, 0, len(texts))
+	for i, text := range texts {
+		role := ai.RoleUser
+		if i%2 == 1 {
+			role = ai.RoleModel
+		}
+		messages = append(messages, ai.NewMessage(role, nil, ai.NewTextPart(text)))
+	}
+	return messages
+}
+
+func TestStoreHistoryBelowThreshold(t *testing.T) {
+	base := &agenstest.HistoryMemory{}
+	memory, model := newMemory(t, base, 4, 2)
+
+	err := memory.StoreHistory(context.Background(), conversationID, conversation("u1", "m1", "u2", "m2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(model.Requests()); n != 0 {
+		t.Errorf("summarized %d times, want 0", n)
+	}
+	if got := texts(base.Messages(conversationID)); !slices.Equal(got, []string{"u1", "m1", "u2", "m2"}) {
+		t.Errorf("stored %q", got)
+	}
+}
+
+func TestStoreHistorySummarizesAboveThreshold(t *testing.T) {
+	base := &agenstest.HistoryMemory{}
+	memory, model := newMemory(t, base, 4, 2)
+	model.Reply("the summary")
+
+	err := memory.StoreHistory(context.Background(), conversationID, conversation("u1", "m1", "u2", "m2", "u3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the prompt has the summarized messages but not the kept ones
+	prompt := model.LastRequest().Messages
+	text := prompt[len(prompt)-1].Text()
+	if !strings.Contains(text, "user: u1") || !strings.Contains(text, "user: u2") || strings.Contains(text, "m2") {
+		t.Errorf("summarized %q, want u1 to u2", text)
+	}
+
+	history, err := memory.RetrieveHistory(context.Background(), conversationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{summarymemory.SummaryPrefix + "the summary", "m2", "u3"}
+	if got := texts(history); !slices.Equal(got, want) {
+		t.Errorf("history = %q, want %q", got, want)
+	}
+	if !summarymemory.IsSummary(history[0]) {
+		t.Error("the first message is not marked as a summary")
+	}
+}
+
+func TestStoreHistoryKeepsToolResponsesWithRequests(t *testing.T) {
+	base := &agenstest.HistoryMemory{}
+	memory, model := newMemory(t, base, 4, 3)
+	model.Reply("the summary")
+
+	messages := []*ai.Message{
+		ai.NewUserTextMessage("u1"),
+		ai.NewMessage(ai.RoleModel, nil, ai.NewToolRequestPart(&ai.ToolRequest{Name: "weather"})),
+		ai.NewMessage(ai.RoleTool, nil, ai.NewToolResponsePart(&ai.ToolResponse{Name: "weather", Output: "sunny"})),
+		ai.NewModelTextMessage("m2"),
+		ai.NewUserTextMessage("u2"),
+	}
+	if err := memory.StoreHistory(context.Background(), conversationID, messages); err != nil {
+		t.Fatal(err)
+	}
+
+	// the split falls on the tool response, so it moves back to its request
+	history, err := memory.RetrieveHistory(context.Background(), conversationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ai.Role{ai.RoleUser, ai.RoleModel, ai.RoleTool, ai.RoleModel, ai.RoleUser}
+	got := make([]ai.Role, 0, len(history))
+	for _, msg := range history {
+		got = append(got, msg.Role)
+	}
+	if !slices.Equal(got, want) || !summarymemory.IsSummary(history[0]) {
+		t.Errorf("history roles = %v, want the summary and %v", got, want[1:])
+	}
+}
+
+func TestStoreHistoryStoresSummaryFirst(t *testing.T) {
+	base := &agenstest.HistoryMemory{}
+	memory, model := newMemory(t, base, 4, 2)
+	model.Reply("the summary")
+
+	err := memory.StoreHistory(context.Background(), conversationID, conversation("u1", "m1", "u2", "m2", "u3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var methods []string
+	for _, call := range base.Calls() {
+		methods = append(methods, call.Method)
+	}
+	want := []string{"StoreHistory", "RetrieveHistory", "StoreHistory", "DeleteMessages"}
+	if !slices.Equal(methods, want) {
+		t.Errorf("calls = %v, want %v", methods, want)
+	}
+
+	// the kept messages are not stored again
+	for _, msg := range base.Messages(conversationID) {
+		id, _ := agens.GetStoredID(msg)
+		if (msg.Text() == "m2" && id != "4") || (msg.Text() == "u3" && id != "5") {
+			t.Errorf("message %q has stored ID %q", msg.Text(), id)
+		}
+	}
+}
+
+// failingSummaryMemory fails to store the summary messages.
+type failingSummaryMemory struct {
+	*agenstest.HistoryMemory
+}
+
+var errStore = errors.New("store failed")
+
+func (m *failingSummaryMemory) ForAgent(string, int) (agens.HistoryMemory, error) {
+	return m, nil
+}
+
+func (m *failingSummaryMemory) StoreHistory(ctx context.Context, conversationID string, messages []*ai.Message) error {
+	if slices.ContainsFunc(messages, summarymemory.IsSummary) {
+		return errStore
+	}
+	return m.HistoryMemory.StoreHistory(ctx, conversationID, messages)
+}
+
+func TestStoreHistoryKeepsHistoryOnFailure(t *testing.T) {
+	t.Run("summary store", func(t *testing.T) {
+		base := &failingSummaryMemory{&agenstest.HistoryMemory{}}
+		memory, model := newMemory(t, base, 4, 2)
+		model.Reply("the summary")
+
+		err := memory.StoreHistory(context.Background(), conversationID, conversation("u1", "m1", "u2", "m2", "u3"))
+		if !errors.Is(err, errStore) {
+			t.Errorf("err = %v, want %v", err, errStore)
+		}
+		if n := len(base.Messages(conversationID)); n != 5 {
+			t.Errorf("stored %d messages, want 5", n)
+		}
+	})
+
+	t.Run("summarization", func(t *testing.T) {
+		base := &agenstest.HistoryMemory{}
+		memory, model := newMemory(t, base, 4, 2)
+		model.Fail(errors.New("unavailable"))
+
+		err := memory.StoreHistory(context.Background(), conversationID, conversation("u1", "m1", "u2", "m2", "u3"))
+		if err == nil {
+			t.Error("expected an error")
+		}
+		if n := len(base.Messages(conversationID)); n != 5 {
+			t.Errorf("stored %d messages, want 5", n)
+		}
+	})
+}
+
+// plainMemory hides the DeleteMessages method of the wrapped memory.
+type plainMemory struct {
+	agens.HistoryMemory
+}
+
+func (m plainMemory) ForAgent(string, int) (agens.HistoryMemory, error) {
+	return m, nil
+}
+
+func TestForAgentRequiresMessageDeleter(t *testing.T) {
+	g := genkit.Init(context.Background())
+
+	provider, err := summarymemory.NewHistoryProvider(g, plainMemory{&agenstest.HistoryMemory{}}, summarymemory.Config{Threshold: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := provider.ForAgent("tester", 0); !errors.Is(err, summarymemory.ErrDeleteMessagesNotSupported) {
+		t.Errorf("err = %v, want %v", err, summarymemory.ErrDeleteMessagesNotSupported)
+	}
+}
@@ -0,0 +1,107 @@
+package timedbatcher
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+func TestTimedBatcherSingleMessage(t *testing.T) {
+	b := &TimedBatcher{Duration: 10 * time.Millisecond}
+
+	msg := ai.NewUserTextMessage("hi")
+	batch, err := b.Add("conversation", msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(batch) != 1) || (batch[0] != msg) {
+		t.Fatalf("batch = %v, want the message", batch)
+	}
+}
+
+func TestTimedBatcherGroupsMessages(t *testing.T) {
+	b := &TimedBatcher{Duration: 200 * time.Millisecond}
+
+	var (
+		wg    sync.WaitGroup
+		batch []*ai.Message
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		batch, _ = b.Add("conversation", ai.NewUserTextMessage("one"))
+	}()
+
+	// wait for the first message to open the batch
+	waitForChannel(t, b, "conversation")
+
+	for _, text := range []string{"two", "three"} {
+		rest, err := b.Add("conversation", ai.NewUserTextMessage(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rest != nil {
+			t.Fatalf("Add(%q) returned a batch, want nil", text)
+		}
+	}
+
+	wg.Wait()
+
+	var texts []string
+	for _, msg := range batch {
+		texts = append(texts, msg.Text())
+	}
+	if (len(texts) != 3) || (texts[0] != "one") || (texts[1] != "two") || (texts[2] != "three") {
+		t.Errorf("batch = %v, want [one two three]", texts)
+	}
+
+	// the next message starts a new batch
+	batch, _ = b.Add("conversation", ai.NewUserTextMessage("four"))
+	if (len(batch) != 1) || (batch[0].Text() != "four") {
+		t.Errorf("new batch = %v, want [four]", batch)
+	}
+}
+
+func TestTimedBatcherSeparatesConversations(t *testing.T) {
+	b := &TimedBatcher{Duration: 20 * time.Millisecond}
+
+	var (
+		wg      sync.WaitGroup
+		batches = make([][]*ai.Message, 2)
+	)
+
+	for i, id := range []string{"a", "b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			batches[i], _ = b.Add(id, ai.NewUserTextMessage(id))
+		}()
+	}
+	wg.Wait()
+
+	for i, id := range []string{"a", "b"} {
+		if (len(batches[i]) != 1) || (batches[i][0].Text() != id) {
+			t.Errorf("batch of %s = %v, want [%s]", id, batches[i], id)
+		}
+	}
+}
+
+func waitForChannel(t *testing.T, b *TimedBatcher, conversationID string) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		b.mu.Lock()
+		_, ok := b.channels[conversationID]
+		b.mu.Unlock()
+
+		if ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("the batch was not opened")
+}
@@ -2,8 +2,11 @@ package agens
 
 import (
 	"context"
+	"text/template"
+	"time"
 
 	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/core"
 	"github.com/firebase/genkit/go/genkit"
 )
 
@@ -13,45 +16,178 @@ const (
 	RetrieveHistoryStep = "retrieveHistory"
 
 	StoreHistoryStep = "storeHistory"
+
+	GenerateStep = "generate"
 )
 
-func baseFlow(g *genkit.Genkit, cfg *AgentConfig, historyMemory HistoryMemory) func(ctx context.Context, msg *ai.Message) (*ai.ModelResponse, error) {
+func baseFlow(g *genkit.Genkit, agent *Agent, systemPrompt *template.Template) core.StreamingFunc[*ai.Message, *ai.ModelResponse, *ai.ModelResponseChunk] {
+	var (
+		cfg             = agent.config
+		historyMemory   = agent.historyMemory
+		knowledgeMemory = agent.knowledgeMemory
+		handoffMemory   = agent.handoffMemory
+		lock            = agent.conversationLock
+		metrics         = agent.metrics
+	)
+
 	// base options
-	baseOpts := make([]ai.GenerateOption, 0, len(cfg.AdditionalOptions)+3)
+	baseOpts := make([]ai.GenerateOption, 0, len(cfg.AdditionalOptions)+1)
 	baseOpts = append(baseOpts, cfg.AdditionalOptions...)
 
-	baseOpts = append(baseOpts, ai.WithSystem(cfg.SystemMessage()))
-
-	if cfg.Model != nil {
-		baseOpts = append(baseOpts, ai.WithModel(cfg.Model))
-	} else if cfg.ModelName != "" {
-		baseOpts = append(baseOpts, ai.WithModelName(cfg.ModelName))
+	var systemMessage string
+	if systemPrompt == nil {
+		systemMessage = cfg.SystemMessage()
 	}
 
+	// models
+	models := resolveModels(cfg)
+
 	if len(cfg.Tools) > 0 {
 		baseOpts = append(baseOpts, ai.WithTools(cfg.Tools...))
 	}
 
-	return func(ctx context.Context, msg *ai.Message) (*ai.ModelResponse, error) {
+	run := func(ctx context.Context, msg *ai.Message, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+		streaming := isStreaming(ctx)
+
 		// conversation id
-		conversationID, err := cfg.GetConversationID(msg)
+		conversationID, err := resolveConversationID(ctx, cfg, msg)
 		if err != nil {
 			return EmptyModelResponse(), err
 		}
+		ctx = withRun(ctx, conversationID, msg)
+
+		state := &FlowState{
+			AgentName:      cfg.Name,
+			Message:        msg,
+			ConversationID: conversationID,
+		}
+
+		// runs a step and records its duration
+		step := func(name string, fn func() error) (*ai.ModelResponse, error) {
+			started := time.Now()
+			defer func() { metrics.recordStep(ctx, state, name, time.Since(started)) }()
+
+			return runStep(ctx, cfg.Middlewares, name, state, fn)
+		}
 
 		// message batch
-		batch, err := messageBatchStep(ctx, cfg.Batcher, conversationID, msg)
-		if err != nil {
-			return EmptyModelResponse(), err
+		resp, err := step(MessageBatchStep, func() (err error) {
+			state.Batch, err = messageBatchStep(ctx, cfg.Batcher, state.ConversationID, state.Message)
+			return err
+		})
+		if (resp != nil) || (err != nil) {
+			return shortCircuit(resp, err)
 		}
-		if len(batch) == 0 {
+		if len(state.Batch) == 0 {
 			return DelegatedModelResponse(), nil
 		}
 
+		// rate limit, before the lock so that delayed runs do not hold it
+		resp, err = step(RateLimitStep, func() error {
+			allowed, err := rateLimitStep(ctx, cfg.RateLimit, cfg.Name, state.ConversationID, state.Message)
+			if (err == nil) && !allowed {
+				state.Response = rateLimitedModelResponse(cfg.RateLimit)
+			}
+			return err
+		})
+		if (resp != nil) || (err != nil) {
+			return shortCircuit(resp, err)
+		}
+		if state.Response != nil {
+			return state.Response, nil
+		}
+
+		// conversation lock
+		var unlock func()
+		resp, err = step(ConversationLockStep, func() (err error) {
+			unlock, state.Batch, err = lock.acquire(ctx, cfg.Name+":"+state.ConversationID, state.Batch)
+			return err
+		})
+		if unlock != nil {
+			defer unlock()
+		}
+		if (resp != nil) || (err != nil) {
+			return shortCircuit(resp, err)
+		}
+		if unlock == nil {
+			if len(state.Batch) == 0 {
+				return mergedModelResponse(), nil
+			}
+			return busyModelResponse(cfg.BusyReply), nil
+		}
+		metrics.recordBatch(ctx, state)
+
+		// store history
+		finish := func() (*ai.ModelResponse, error) {
+			resp, err := step(StoreHistoryStep, func() error {
+				return storeHistoryStep(ctx, historyMemory, state.ConversationID, state.Response.History())
+			})
+			if (resp != nil) || (err != nil) {
+				return shortCircuit(resp, err)
+			}
+			return state.Response, nil
+		}
+
+		// handoff
+		resp, err = step(HandoffStep, func() error {
+			paused, err := handoffStep(ctx, handoffMemory, state.ConversationID)
+			if paused {
+				state.Response = pausedModelResponse(state.Batch)
+			}
+			return err
+		})
+		if (resp != nil) || (err != nil) {
+			return shortCircuit(resp, err)
+		}
+		if state.Response != nil {
+			return finish()
+		}
+
+		// input guards
+		resp, err = step(InputGuardStep, func() error {
+			decision, err := inputGuardStep(ctx, cfg.InputGuards, state.Batch)
+			switch decision.Action {
+			case GuardBlock:
+				state.Response = blockedModelResponse(decision, state.Batch, state.Batch)
+			case GuardRewrite:
+				state.Batch = decision.Messages
+			}
+			return err
+		})
+		if (resp != nil) || (err != nil) {
+			return shortCircuit(resp, err)
+		}
+		if state.Response != nil {
+			return finish()
+		}
+
 		// history
-		history, err := retrieveHistoryStep(ctx, historyMemory, conversationID)
-		if err != nil {
-			return EmptyModelResponse(), err
+		resp, err = step(RetrieveHistoryStep, func() (err error) {
+			state.History, err = retrieveHistoryStep(ctx, cfg, historyMemory, state.ConversationID)
+			return err
+		})
+		if (resp != nil) || (err != nil) {
+			return shortCircuit(resp, err)
+		}
+		metrics.recordHistory(ctx, state)
+
+		// tool approval
+		var restarts []*ai.Part
+		if pending := pendingApproval(state.History); pending != nil {
+			approved, ok := toolApprovalDecision(state.Batch)
+			if !ok {
+				return approvalReminderModelResponse(cfg.ApprovalReminder), nil
+			}
+			restarts = approvalRestarts(pending, approved)
+		}
+
+		// knowledge
+		resp, err = step(RetrieveKnowledgeStep, func() (err error) {
+			state.Knowledge, err = retrieveKnowledgeStep(ctx, cfg, knowledgeMemory, state.Batch)
+			return err
+		})
+		if (resp != nil) || (err != nil) {
+			return shortCircuit(resp, err)
 		}
 
 		// output option
@@ -60,30 +196,130 @@ func baseFlow(g *genkit.Genkit, cfg *AgentConfig, historyMemory HistoryMemory) f
 			return EmptyModelResponse(), err
 		}
 
-		// options
-		opts := make([]ai.GenerateOption, len(baseOpts), len(baseOpts)+2)
-		copy(opts, baseOpts)
+		// generate
+		var held []*ai.ModelResponseChunk
+		resp, err = step(GenerateStep, func() (err error) {
+			// options
+			opts := make([]ai.GenerateOption, len(baseOpts), len(baseOpts)+len(state.GenerateOptions)+5)
+			copy(opts, baseOpts)
+
+			// system
+			system := systemMessage
+			if systemPrompt != nil {
+				system, err = renderSystemPrompt(ctx, systemPrompt, cfg, state.ConversationID, state.Message)
+				if err != nil {
+					return err
+				}
+			}
+
+			if knowledge := knowledgeContext(state.Knowledge); knowledge != "" {
+				system += "\n" + knowledge
+			}
+			opts = append(opts, ai.WithSystem("%s", system))
+
+			messages := append(state.History, state.Batch...)
+			if len(restarts) > 0 {
+				// the batch only answers the pending approval: resume from the interrupted message
+				messages = state.History
+				opts = append(opts, ai.WithToolRestarts(restarts...))
+			}
+			opts = append(opts, ai.WithMessages(messages...))
 
-		opts = append(
-			opts,
-			ai.WithMessages(append(history, batch...)...), /* messages */
-		)
+			if outputOpt != nil {
+				opts = append(opts, outputOpt)
+			}
 
-		if outputOpt != nil {
-			opts = append(opts, outputOpt)
+			if streaming {
+				streamCb := cb
+				if len(cfg.OutputGuards) > 0 {
+					// hold the chunks, so nothing reaches the user before the output guards pass
+					streamCb = func(_ context.Context, chunk *ai.ModelResponseChunk) error {
+						held = append(held, chunk)
+						return nil
+					}
+				}
+				opts = append(opts, ai.WithStreaming(streamCb))
+			}
+
+			opts = append(opts, state.GenerateOptions...)
+
+			started := time.Now()
+			state.Response, err = generateWithFallback(ctx, g, cfg.RetryPolicy, models, opts)
+			if err != nil {
+				return err
+			}
+
+			if state.Response.Request == nil {
+				// interrupted again while resuming: the model was not called
+				state.Response.Request = &ai.ModelRequest{}
+			}
+
+			state.Usage = newUsageRecord(cfg, state, len(messages), time.Since(started))
+			return nil
+		})
+		if (resp != nil) || (err != nil) {
+			return shortCircuit(resp, err)
 		}
 
-		// generate
-		resp, err := genkit.Generate(ctx, g, opts...)
-		if err != nil {
-			return EmptyModelResponse(), err
+		// usage
+		var usageErr error
+		resp, err = step(RecordUsageStep, func() error {
+			usageErr = recordUsageStep(ctx, cfg.UsageRecorder, state.Usage)
+			return nil
+		})
+		if (resp != nil) || (err != nil) {
+			return shortCircuit(resp, err)
 		}
 
-		// store history
-		err = storeHistoryStep(ctx, historyMemory, conversationID, resp.History())
+		// output guards
+		var guardAction GuardAction
+		resp, err = step(OutputGuardStep, func() error {
+			decision, err := outputGuardStep(ctx, cfg.OutputGuards, state.Response)
+			guardAction = decision.Action
+			switch decision.Action {
+			case GuardBlock:
+				var request []*ai.Message
+				if state.Response.Request != nil {
+					request = state.Response.Request.Messages
+				}
+				state.Response = blockedModelResponse(decision, request, nil)
+			case GuardRewrite:
+				state.Response = decision.Response
+			}
+			return err
+		})
+		if (resp != nil) || (err != nil) {
+			return shortCircuit(resp, err)
+		}
+
+		if streaming && (len(cfg.OutputGuards) > 0) {
+			if err := releaseChunks(ctx, cb, guardAction, held, state.Response); err != nil {
+				return EmptyModelResponse(), err
+			}
+		}
 
+		resp, err = finish()
+		if (usageErr != nil) && (resp != nil) && (resp.Message != nil) {
+			// reported after the history is stored, so it is not persisted
+			setMetadata(resp.Message, UsageErrorKey, usageErr.Error())
+		}
 		return resp, err
 	}
+
+	return func(ctx context.Context, msg *ai.Message, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+		started := time.Now()
+		resp, err := run(ctx, msg, cb)
+
+		metrics.recordRun(ctx, cfg.Name, msg, resp, err, time.Since(started))
+		return resp, err
+	}
+}
+
+func resolveConversationID(ctx context.Context, cfg *AgentConfig, msg *ai.Message) (string, error) {
+	if conversationID, ok := forcedConversationID(ctx); ok {
+		return conversationID, nil
+	}
+	return cfg.GetConversationID(msg)
 }
 
 func messageBatchStep(ctx context.Context, batcher MessageBatcher, conversationID string, msg *ai.Message) ([]*ai.Message, error) {
@@ -100,13 +336,19 @@ func messageBatchStep(ctx context.Context, batcher MessageBatcher, conversationI
 	})
 }
 
-func retrieveHistoryStep(ctx context.Context, historyMemory HistoryMemory, conversationID string) ([]*ai.Message, error) {
+func retrieveHistoryStep(ctx context.Context, cfg *AgentConfig, historyMemory HistoryMemory, conversationID string) ([]*ai.Message, error) {
 	if historyMemory == nil {
 		return nil, nil
 	}
 
 	return genkit.Run(ctx, RetrieveHistoryStep, func() ([]*ai.Message, error) {
-		return historyMemory.RetrieveHistory(ctx, conversationID)
+		history, err := historyMemory.RetrieveHistory(ctx, conversationID)
+		if err != nil {
+			return nil, err
+		}
+
+		history = withoutGuardBlocked(history)
+		return trimHistoryToBudget(history, cfg.MaxHistoryTokens, cfg.TokenEstimator), nil
 	})
 }
 
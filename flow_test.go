@@ -0,0 +1,574 @@
+package agens_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/gonzxlezs/agens"
+	"github.com/gonzxlezs/agens/agenstest"
+	"github.com/gonzxlezs/agens/extensions/memusage"
+)
+
+const (
+	testConversationID = "agenstest:chat"
+	testChannelID      = "chat"
+	testUserID         = "user"
+)
+
+type testEnv struct {
+	g       *genkit.Genkit
+	model   *agenstest.FakeModel
+	history *agenstest.HistoryMemory
+	trigger *agenstest.Trigger
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	g := genkit.Init(context.Background())
+	return &testEnv{
+		g:       g,
+		model:   agenstest.DefineFakeModel(g, ""),
+		history: &agenstest.HistoryMemory{},
+		trigger: agenstest.NewTrigger(""),
+	}
+}
+
+// newAgent creates an agent with the fake model and history, registered in the fake trigger.
+func (env *testEnv) newAgent(t *testing.T, cfg agens.AgentConfig) *agens.Agent {
+	t.Helper()
+
+	if cfg.Name == "" {
+		cfg.Name = "tester"
+	}
+	if cfg.Model == nil {
+		cfg.Model = env.model
+	}
+	if cfg.HistoryProvider == nil {
+		cfg.HistoryProvider = env.history
+	}
+
+	agent, err := agens.NewAgent(env.g, cfg)
+	if err != nil {
+		t.Fatalf("NewAgent: %v", err)
+	}
+
+	if err := env.trigger.RegisterAgent(agent); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+	return agent
+}
+
+func (env *testEnv) send(t *testing.T, text string) *ai.ModelResponse {
+	t.Helper()
+
+	resp, err := env.trigger.SendText(context.Background(), testChannelID, testUserID, text)
+	if err != nil {
+		t.Fatalf("send %q: %v", text, err)
+	}
+	return resp
+}
+
+func roles(messages []*ai.Message) []ai.Role {
+	roles := make([]ai.Role, 0, len(messages))
+	for _, msg := range messages {
+		roles = append(roles, msg.Role)
+	}
+	return roles
+}
+
+func equalRoles(a []ai.Role, b ...ai.Role) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFlowGeneratesAndStoresHistory(t *testing.T) {
+	env := newTestEnv(t)
+	env.newAgent(t, agens.AgentConfig{
+		Description:  "a test agent",
+		Instructions: []string{"Answer briefly."},
+	})
+
+	env.model.Reply("Hello!").Expect(
+		agenstest.SystemContains("tester", "a test agent", "Answer briefly."),
+		agenstest.LastMessageIs(ai.RoleUser, "Hi"),
+	)
+
+	resp := env.send(t, "Hi")
+	if got := resp.Text(); got != "Hello!" {
+		t.Errorf("response text = %q, want %q", got, "Hello!")
+	}
+
+	stored := env.history.Messages(testConversationID)
+	if !equalRoles(roles(stored), ai.RoleUser, ai.RoleModel) {
+		t.Errorf("stored roles = %v, want [user model]", roles(stored))
+	}
+	if env.history.AgentName() != "tester" {
+		t.Errorf("history agent name = %q, want %q", env.history.AgentName(), "tester")
+	}
+}
+
+func TestFlowSendsHistory(t *testing.T) {
+	env := newTestEnv(t)
+	env.newAgent(t, agens.AgentConfig{})
+
+	env.model.Reply("first")
+	env.send(t, "one")
+
+	// system, user, model, user
+	env.model.Reply("second").Expect(agenstest.MessageCount(4))
+	env.send(t, "two")
+
+	if n := len(env.history.Messages(testConversationID)); n != 4 {
+		t.Errorf("stored %d messages, want 4", n)
+	}
+}
+
+func TestFlowRunsTools(t *testing.T) {
+	env := newTestEnv(t)
+
+	var calls int
+	tool := genkit.DefineTool(env.g, "get_weather", "Gets the weather of a city.",
+		func(_ *ai.ToolContext, input struct{ City string }) (string, error) {
+			calls++
+			return "sunny in " + input.City, nil
+		},
+	)
+
+	env.newAgent(t, agens.AgentConfig{Tools: []ai.ToolRef{tool}})
+
+	env.model.
+		CallTool("get_weather", map[string]any{"City": "Lima"}).
+		Expect(agenstest.HasTool("get_weather")).
+		Reply("It is sunny.").
+		ExpectLastMessage(ai.RoleTool, "sunny in Lima")
+
+	resp := env.send(t, "How is the weather in Lima?")
+	if resp.Text() != "It is sunny." {
+		t.Errorf("response text = %q", resp.Text())
+	}
+	if calls != 1 {
+		t.Errorf("tool called %d times, want 1", calls)
+	}
+	if env.model.Remaining() != 0 {
+		t.Errorf("%d scripted responses left", env.model.Remaining())
+	}
+
+	stored := env.history.Messages(testConversationID)
+	if !equalRoles(roles(stored), ai.RoleUser, ai.RoleModel, ai.RoleTool, ai.RoleModel) {
+		t.Errorf("stored roles = %v, want [user model tool model]", roles(stored))
+	}
+}
+
+func TestFlowMiddlewareShortCircuit(t *testing.T) {
+	env := newTestEnv(t)
+
+	canned := &ai.ModelResponse{Message: ai.NewModelTextMessage("canned")}
+	env.newAgent(t, agens.AgentConfig{
+		Middlewares: []agens.Middleware{
+			agens.StepHooks{
+				BeforeStep: map[string]agens.StepHook{
+					agens.GenerateStep: func(context.Context, *agens.FlowState) (*ai.ModelResponse, error) {
+						return canned, nil
+					},
+				},
+			},
+		},
+	})
+
+	resp := env.send(t, "Hi")
+	if resp != canned {
+		t.Errorf("response = %v, want the canned response", resp)
+	}
+	if len(env.model.Requests()) != 0 {
+		t.Error("the model was called")
+	}
+	if n := len(env.history.Messages(testConversationID)); n != 0 {
+		t.Errorf("stored %d messages, want 0", n)
+	}
+}
+
+func TestFlowInputGuardBlocks(t *testing.T) {
+	env := newTestEnv(t)
+	env.newAgent(t, agens.AgentConfig{
+		InputGuards: []agens.InputGuard{
+			&agens.BlocklistGuard{Keywords: []string{"forbidden"}, Reply: "blocked"},
+		},
+	})
+
+	resp := env.send(t, "something forbidden")
+	if resp.FinishReason != ai.FinishReasonBlocked || resp.Text() != "blocked" {
+		t.Errorf("response = %q (%s), want the blocked reply", resp.Text(), resp.FinishReason)
+	}
+	if len(env.model.Requests()) != 0 {
+		t.Error("the model was called")
+	}
+}
+
+// rewriteGuard rewrites the input and output with its messages and response.
+type rewriteGuard struct {
+	messages []*ai.Message
+	response *ai.ModelResponse
+}
+
+func (g rewriteGuard) CheckInput(ctx context.Context, batch []*ai.Message) (agens.GuardDecision, error) {
+	return agens.GuardDecision{Action: agens.GuardRewrite, Messages: g.messages}, nil
+}
+
+func (g rewriteGuard) CheckOutput(ctx context.Context, resp *ai.ModelResponse) (agens.GuardDecision, error) {
+	return agens.GuardDecision{Action: agens.GuardRewrite, Response: g.response}, nil
+}
+
+func TestFlowInputGuardRejectsEmptyRewrite(t *testing.T) {
+	env := newTestEnv(t)
+	env.newAgent(t, agens.AgentConfig{
+		InputGuards: []agens.InputGuard{rewriteGuard{}},
+	})
+
+	_, err := env.trigger.SendText(context.Background(), testChannelID, testUserID, "Hi")
+	if !errors.Is(err, agens.ErrEmptyInputRewrite) {
+		t.Errorf("err = %v, want %v", err, agens.ErrEmptyInputRewrite)
+	}
+	if len(env.model.Requests()) != 0 {
+		t.Error("the model was called")
+	}
+}
+
+func TestFlowOutputGuardRejectsEmptyRewrite(t *testing.T) {
+	env := newTestEnv(t)
+	env.newAgent(t, agens.AgentConfig{
+		OutputGuards: []agens.OutputGuard{rewriteGuard{}},
+	})
+	env.model.Reply("Hello")
+
+	_, err := env.trigger.SendText(context.Background(), testChannelID, testUserID, "Hi")
+	if !errors.Is(err, agens.ErrEmptyOutputRewrite) {
+		t.Errorf("err = %v, want %v", err, agens.ErrEmptyOutputRewrite)
+	}
+	if n := len(env.history.Messages(testConversationID)); n != 0 {
+		t.Errorf("stored %d messages, want 0", n)
+	}
+}
+
+func TestFlowOutputGuardRewrite(t *testing.T) {
+	env := newTestEnv(t)
+	env.newAgent(t, agens.AgentConfig{
+		OutputGuards: []agens.OutputGuard{rewriteGuard{
+			response: &ai.ModelResponse{Message: ai.NewModelTextMessage("Rewritten")},
+		}},
+	})
+	env.model.Reply("Hello")
+
+	resp := env.send(t, "Hi")
+	if resp.Text() != "Rewritten" {
+		t.Errorf("response text = %q, want %q", resp.Text(), "Rewritten")
+	}
+
+	if stored := roles(env.history.Messages(testConversationID)); !equalRoles(stored, ai.RoleUser, ai.RoleModel) {
+		t.Errorf("stored roles = %v, want [user model]", stored)
+	}
+}
+
+func TestFlowOutputGuardHoldsStream(t *testing.T) {
+	env := newTestEnv(t)
+	agent := env.newAgent(t, agens.AgentConfig{
+		OutputGuards: []agens.OutputGuard{
+			&agens.BlocklistGuard{Keywords: []string{"secret"}, Reply: "blocked"},
+		},
+	})
+
+	stream := func(text string) ([]string, *ai.ModelResponse) {
+		t.Helper()
+
+		msg := ai.NewUserTextMessage(text)
+		agens.SetSource(msg, agenstest.DefaultTriggerName)
+		agens.SetChannelID(msg, testChannelID)
+		agens.SetUserID(msg, testUserID)
+
+		var chunks []string
+		resp, err := agent.RunStream(context.Background(), msg, func(_ context.Context, chunk *ai.ModelResponseChunk) error {
+			chunks = append(chunks, chunk.Text())
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chunks, resp
+	}
+
+	env.model.Reply("The secret is 42.")
+	chunks, resp := stream("Tell me the secret")
+	if len(chunks) != 0 {
+		t.Errorf("streamed %q before the guard blocked it", chunks)
+	}
+	if resp.Text() != "blocked" {
+		t.Errorf("response text = %q, want the blocked reply", resp.Text())
+	}
+
+	// allowed responses are streamed once the guards pass
+	env.model.Reply("Hello!")
+	if chunks, _ := stream("Hi"); (len(chunks) != 1) || (chunks[0] != "Hello!") {
+		t.Errorf("streamed %q, want the response", chunks)
+	}
+}
+
+func TestFlowFallsBackToNextModel(t *testing.T) {
+	env := newTestEnv(t)
+	fallback := agenstest.DefineFakeModel(env.g, "agenstest/fallback")
+
+	env.newAgent(t, agens.AgentConfig{
+		FallbackModels: []ai.ModelArg{fallback},
+		RetryPolicy: &agens.RetryPolicy{
+			MaxAttempts: 2,
+			Backoff:     1,
+		},
+	})
+
+	env.model.Fail(errors.New("unavailable")).Fail(errors.New("unavailable"))
+	fallback.Reply("from fallback")
+
+	resp := env.send(t, "Hi")
+	if resp.Text() != "from fallback" {
+		t.Errorf("response text = %q", resp.Text())
+	}
+	if name, _ := agens.GetModelName(resp.Message); name != "agenstest/fallback" {
+		t.Errorf("model name = %q, want %q", name, "agenstest/fallback")
+	}
+	if n := len(env.model.Requests()); n != 2 {
+		t.Errorf("primary model called %d times, want 2", n)
+	}
+}
+
+func TestFlowInjectsKnowledge(t *testing.T) {
+	env := newTestEnv(t)
+	knowledge := &agenstest.KnowledgeMemory{}
+
+	env.newAgent(t, agens.AgentConfig{
+		KnowledgeProvider: knowledge,
+		KnowledgeMode:     agens.KnowledgeModeInject,
+	})
+
+	err := knowledge.IndexKnowledge(context.Background(), "faq", []*ai.Document{
+		ai.DocumentFromText("The store opens at 9am.", nil),
+		ai.DocumentFromText("Shipping is free.", nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.model.Reply("At 9am.").Expect(agenstest.SystemContains(agens.DefaultKnowledgeContextPreface, "opens at 9am"))
+	env.send(t, "When does the store open?")
+
+	calls := knowledge.Calls()
+	if last := calls[len(calls)-1]; last.Method != "RetrieveKnowledge" {
+		t.Errorf("last knowledge call = %s, want RetrieveKnowledge", last.Method)
+	}
+}
+
+func TestFlowKnowledgeQueryFunc(t *testing.T) {
+	env := newTestEnv(t)
+	knowledge := &agenstest.KnowledgeMemory{}
+
+	// the platform message is JSON, of which only the text is the query
+	env.newAgent(t, agens.AgentConfig{
+		KnowledgeProvider: knowledge,
+		KnowledgeMode:     agens.KnowledgeModeInject,
+		KnowledgeQueryFunc: func(batch []*ai.Message) string {
+			var msg struct {
+				Text string `json:"text"`
+			}
+			if err := json.Unmarshal([]byte(batch[0].Text()), &msg); err != nil {
+				t.Error(err)
+			}
+			return msg.Text
+		},
+	})
+
+	env.model.Reply("At 9am.")
+	env.send(t, `{"chat": {"id": 1}, "text": "When does the store open?"}`)
+
+	calls := knowledge.Calls()
+	if last := calls[len(calls)-1]; last.Key != "When does the store open?" {
+		t.Errorf("knowledge query = %q, want the text of the message", last.Key)
+	}
+}
+
+func TestFlowToolApproval(t *testing.T) {
+	env := newTestEnv(t)
+
+	var refunded []string
+	refund := genkit.DefineTool(env.g, "refund", "Refunds an order.",
+		agens.RequireApproval(func(_ *ai.ToolContext, input struct{ Order string }) (string, error) {
+			refunded = append(refunded, input.Order)
+			return "refunded " + input.Order, nil
+		}),
+	)
+
+	env.newAgent(t, agens.AgentConfig{Tools: []ai.ToolRef{refund}})
+
+	// the call is interrupted until it is approved
+	env.model.CallTool("refund", map[string]any{"Order": "A1"})
+
+	resp := env.send(t, "Refund order A1")
+	if resp.FinishReason != ai.FinishReasonInterrupted {
+		t.Fatalf("finish reason = %s, want interrupted", resp.FinishReason)
+	}
+	if pending := agens.PendingToolApprovals(resp); len(pending) != 1 || pending[0].Name != "refund" {
+		t.Fatalf("pending approvals = %v", pending)
+	}
+	if len(refunded) != 0 {
+		t.Fatal("the tool ran before the approval")
+	}
+
+	// other messages get a reminder
+	resp = env.send(t, "what?")
+	if resp.FinishMessage != agens.ApprovalPendingMessage {
+		t.Errorf("finish message = %q, want the approval reminder", resp.FinishMessage)
+	}
+
+	// the approval resumes the generation
+	env.model.Reply("Done.").ExpectLastMessage(ai.RoleTool, "refunded A1")
+
+	resp = env.send(t, "yes")
+	if resp.Text() != "Done." {
+		t.Errorf("response text = %q", resp.Text())
+	}
+	if len(refunded) != 1 {
+		t.Errorf("tool ran %d times, want 1", len(refunded))
+	}
+
+	stored := env.history.Messages(testConversationID)
+	if !equalRoles(roles(stored), ai.RoleUser, ai.RoleModel, ai.RoleTool, ai.RoleModel) {
+		t.Errorf("stored roles = %v, want [user model tool model]", roles(stored))
+	}
+}
+
+func TestFlowToolRejection(t *testing.T) {
+	env := newTestEnv(t)
+
+	var ran bool
+	refund := genkit.DefineTool(env.g, "refund", "Refunds an order.",
+		agens.RequireApproval(func(_ *ai.ToolContext, input struct{ Order string }) (string, error) {
+			ran = true
+			return "", nil
+		}),
+	)
+
+	env.newAgent(t, agens.AgentConfig{Tools: []ai.ToolRef{refund}})
+
+	env.model.CallTool("refund", map[string]any{"Order": "A1"})
+	env.send(t, "Refund order A1")
+
+	env.model.Reply("Cancelled.").ExpectLastMessage(ai.RoleTool, agens.DefaultToolRejectedMessage)
+
+	msg := agens.SetToolApproval(ai.NewUserTextMessage("button"), false)
+	agens.SetChannelID(msg, testChannelID)
+	if _, err := env.trigger.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if ran {
+		t.Error("the rejected tool ran")
+	}
+}
+
+func TestFlowRecordsUsage(t *testing.T) {
+	env := newTestEnv(t)
+	recorder := &memusage.Recorder{}
+
+	env.newAgent(t, agens.AgentConfig{
+		UsageRecorder: recorder,
+		PriceTable: agens.PriceTable{
+			agenstest.DefaultFakeModelName: {InputPerMillion: 1e6, OutputPerMillion: 2e6},
+		},
+	})
+
+	env.model.Enqueue(&agenstest.FakeResponse{
+		Message: ai.NewModelTextMessage("Hello!"),
+		Usage:   &ai.GenerationUsage{InputTokens: 3, OutputTokens: 2, TotalTokens: 5},
+	})
+	env.send(t, "Hi")
+
+	records := recorder.Records(agens.UsageFilter{UserID: testUserID})
+	if len(records) != 1 {
+		t.Fatalf("recorded %d runs, want 1", len(records))
+	}
+
+	record := records[0]
+	if record.ConversationID != testConversationID || record.ModelName != agenstest.DefaultFakeModelName {
+		t.Errorf("record = %+v", record)
+	}
+	if record.TotalTokens != 5 || record.Cost != 7 {
+		t.Errorf("tokens = %d, cost = %v, want 5 and 7", record.TotalTokens, record.Cost)
+	}
+}
+
+// failingRecorder fails to record the usage.
+type failingRecorder struct{}
+
+func (failingRecorder) RecordUsage(context.Context, agens.UsageRecord) error {
+	return errors.New("recorder unavailable")
+}
+
+func TestFlowUsageRecorderErrorDoesNotFailRun(t *testing.T) {
+	env := newTestEnv(t)
+	env.newAgent(t, agens.AgentConfig{UsageRecorder: failingRecorder{}})
+	env.model.Reply("Hello!")
+
+	resp := env.send(t, "Hi")
+	if resp.Text() != "Hello!" {
+		t.Errorf("response text = %q", resp.Text())
+	}
+	if reason, _ := resp.Message.Metadata[agens.UsageErrorKey].(string); reason != "recorder unavailable" {
+		t.Errorf("usage error = %q, want the recorder error", reason)
+	}
+
+	stored := env.history.Messages(testConversationID)
+	if !equalRoles(roles(stored), ai.RoleUser, ai.RoleModel) {
+		t.Fatalf("stored roles = %v, want [user model]", roles(stored))
+	}
+	if _, ok := stored[1].Metadata[agens.UsageErrorKey]; ok {
+		t.Error("the usage error was stored in the history")
+	}
+}
+
+func TestFlowRecordsToolCallsOnResume(t *testing.T) {
+	env := newTestEnv(t)
+	recorder := &memusage.Recorder{}
+
+	refund := genkit.DefineTool(env.g, "refund", "Refunds an order.",
+		agens.RequireApproval(func(_ *ai.ToolContext, input struct{ Order string }) (string, error) {
+			return "refunded " + input.Order, nil
+		}),
+	)
+
+	env.newAgent(t, agens.AgentConfig{
+		Tools:         []ai.ToolRef{refund},
+		UsageRecorder: recorder,
+	})
+
+	env.model.CallTool("refund", map[string]any{"Order": "A1"})
+	env.send(t, "Refund order A1")
+
+	// the resumed generation does not count the approved call again
+	env.model.Reply("Done.")
+	env.send(t, "yes")
+
+	records := recorder.Records(agens.UsageFilter{UserID: testUserID})
+	if len(records) != 2 {
+		t.Fatalf("recorded %d runs, want 2", len(records))
+	}
+	if records[0].ToolCalls != 1 || records[1].ToolCalls != 0 {
+		t.Errorf("tool calls = %d and %d, want 1 and 0", records[0].ToolCalls, records[1].ToolCalls)
+	}
+}
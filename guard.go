@@ -0,0 +1,386 @@
+package agens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+const (
+	InputGuardStep = "inputGuard"
+
+	OutputGuardStep = "outputGuard"
+)
+
+const (
+	// GuardBlockedKey is the key used in message metadata to mark the messages
+	// of a turn blocked by a guard. Its value is the reason of the block.
+	// Marked messages are kept in the history but are not sent to the model.
+	GuardBlockedKey = "guard_blocked"
+
+	// DefaultGuardReply is the canned reply used by the built-in guards when no reply is configured.
+	DefaultGuardReply = "I'm sorry, but I can't help with that request."
+
+	// DefaultGuardReason is the reason recorded when a blocking decision does not provide one.
+	DefaultGuardReason = "blocked"
+
+	// DefaultClassifierGuardInstructions is the system message used by ClassifierGuard.
+	// It receives the guard policy as its only argument.
+	DefaultClassifierGuardInstructions = `You are a content moderator.
+Decide whether the following content is allowed according to this policy:
+%s`
+)
+
+var (
+	// ErrEmptyInputRewrite is returned when an input guard rewrites the batch without messages.
+	ErrEmptyInputRewrite = errors.New("input guard rewrite has no messages")
+
+	// ErrEmptyOutputRewrite is returned when an output guard rewrites the response with a nil one.
+	ErrEmptyOutputRewrite = errors.New("output guard rewrite has no response")
+)
+
+// GuardAction is the outcome of a guard check.
+type GuardAction int
+
+const (
+	// GuardAllow lets the content through unchanged.
+	GuardAllow GuardAction = iota
+
+	// GuardBlock stops the turn and answers with the decision's canned reply.
+	GuardBlock
+
+	// GuardRewrite replaces the content with the decision's Messages (input
+	// guards) or Response (output guards).
+	GuardRewrite
+)
+
+// GuardDecision is the result of a guard check.
+type GuardDecision struct {
+	// Action is the outcome of the check.
+	Action GuardAction
+
+	// Reply is the canned reply returned to the user when Action is GuardBlock.
+	Reply string
+
+	// Reason is an optional explanation of the decision, recorded in the
+	// history marker (GuardBlockedKey) of blocked turns.
+	Reason string
+
+	// Messages replaces the incoming batch when an input guard rewrites it.
+	Messages []*ai.Message
+
+	// Response replaces the model response when an output guard rewrites it.
+	Response *ai.ModelResponse
+}
+
+// InputGuard checks the incoming batch of messages before generation.
+type InputGuard interface {
+	CheckInput(ctx context.Context, batch []*ai.Message) (GuardDecision, error)
+}
+
+// OutputGuard checks the model response before it is stored and returned.
+type OutputGuard interface {
+	CheckOutput(ctx context.Context, resp *ai.ModelResponse) (GuardDecision, error)
+}
+
+// IsGuardBlocked reports whether the message was marked as part of a turn blocked by a guard.
+func IsGuardBlocked(msg *ai.Message) bool {
+	_, ok, _ := getMetadata(msg, GuardBlockedKey)
+	return ok
+}
+
+func inputGuardStep(ctx context.Context, guards []InputGuard, batch []*ai.Message) (GuardDecision, error) {
+	if len(guards) == 0 {
+		return GuardDecision{}, nil
+	}
+
+	return genkit.Run(ctx, InputGuardStep, func() (GuardDecision, error) {
+		rewritten := false
+		for _, guard := range guards {
+			decision, err := guard.CheckInput(ctx, batch)
+			if err != nil {
+				return GuardDecision{}, err
+			}
+
+			switch decision.Action {
+			case GuardBlock:
+				return decision, nil
+			case GuardRewrite:
+				if len(decision.Messages) == 0 {
+					return GuardDecision{}, ErrEmptyInputRewrite
+				}
+				batch, rewritten = decision.Messages, true
+			}
+		}
+
+		if rewritten {
+			return GuardDecision{Action: GuardRewrite, Messages: batch}, nil
+		}
+		return GuardDecision{}, nil
+	})
+}
+
+func outputGuardStep(ctx context.Context, guards []OutputGuard, resp *ai.ModelResponse) (GuardDecision, error) {
+	if len(guards) == 0 {
+		return GuardDecision{}, nil
+	}
+
+	return genkit.Run(ctx, OutputGuardStep, func() (GuardDecision, error) {
+		rewritten := false
+		for _, guard := range guards {
+			decision, err := guard.CheckOutput(ctx, resp)
+			if err != nil {
+				return GuardDecision{}, err
+			}
+
+			switch decision.Action {
+			case GuardBlock:
+				return decision, nil
+			case GuardRewrite:
+				if decision.Response == nil {
+					return GuardDecision{}, ErrEmptyOutputRewrite
+				}
+				if decision.Response.Request == nil {
+					// the history of the turn is built from the request
+					decision.Response.Request = resp.Request
+				}
+				resp, rewritten = decision.Response, true
+			}
+		}
+
+		if rewritten {
+			return GuardDecision{Action: GuardRewrite, Response: resp}, nil
+		}
+		return GuardDecision{}, nil
+	})
+}
+
+// releaseChunks streams the chunks held while the output guards ran: as they
+// were if the response was allowed, as a single chunk if it was rewritten and
+// not at all if it was blocked.
+func releaseChunks(ctx context.Context, cb ai.ModelStreamCallback, action GuardAction, held []*ai.ModelResponseChunk, resp *ai.ModelResponse) error {
+	switch action {
+	case GuardAllow:
+		for _, chunk := range held {
+			if err := cb(ctx, chunk); err != nil {
+				return err
+			}
+		}
+	case GuardRewrite:
+		if resp.Message != nil {
+			return cb(ctx, &ai.ModelResponseChunk{Role: ai.RoleModel, Content: resp.Message.Content})
+		}
+	}
+	return nil
+}
+
+// blockedModelResponse builds the response of a blocked turn, whose history is
+// the request messages followed by the canned reply. The canned reply and the
+// marked messages are flagged with GuardBlockedKey.
+func blockedModelResponse(decision GuardDecision, request []*ai.Message, marked []*ai.Message) *ai.ModelResponse {
+	reason := decision.Reason
+	if reason == "" {
+		reason = DefaultGuardReason
+	}
+
+	for _, msg := range marked {
+		setMetadata(msg, GuardBlockedKey, reason)
+	}
+
+	reply := ai.NewModelTextMessage(decision.Reply)
+	setMetadata(reply, GuardBlockedKey, reason)
+
+	return &ai.ModelResponse{
+		FinishReason:  ai.FinishReasonBlocked,
+		FinishMessage: reason,
+		Message:       reply,
+		Request:       &ai.ModelRequest{Messages: request},
+	}
+}
+
+func withoutGuardBlocked(messages []*ai.Message) []*ai.Message {
+	filtered := make([]*ai.Message, 0, len(messages))
+	for _, msg := range messages {
+		if !IsGuardBlocked(msg) {
+			filtered = append(filtered, msg)
+		}
+	}
+	return filtered
+}
+
+func messagesText(messages []*ai.Message) string {
+	texts := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		texts = append(texts, msg.Text())
+	}
+	return strings.Join(texts, "\n")
+}
+
+func responseText(resp *ai.ModelResponse) string {
+	if (resp == nil) || (resp.Message == nil) {
+		return ""
+	}
+	return resp.Text()
+}
+
+func guardReply(reply string) string {
+	if reply == "" {
+		return DefaultGuardReply
+	}
+	return reply
+}
+
+var (
+	_ InputGuard  = &BlocklistGuard{}
+	_ OutputGuard = &BlocklistGuard{}
+	_ InputGuard  = &MaxInputLengthGuard{}
+	_ InputGuard  = &ClassifierGuard{}
+	_ OutputGuard = &ClassifierGuard{}
+)
+
+// BlocklistGuard blocks content that matches any of the configured regular
+// expressions or contains any of the configured keywords (case-insensitive).
+// It can be used both as an input and as an output guard.
+type BlocklistGuard struct {
+	// Patterns are regular expressions that block the content when matched.
+	Patterns []*regexp.Regexp
+
+	// Keywords are words or phrases that block the content when found.
+	Keywords []string
+
+	// Reply is the canned reply. Defaults to DefaultGuardReply.
+	Reply string
+}
+
+// CheckInput checks the text of the incoming batch.
+func (guard *BlocklistGuard) CheckInput(_ context.Context, batch []*ai.Message) (GuardDecision, error) {
+	return guard.check(messagesText(batch)), nil
+}
+
+// CheckOutput checks the text of the model response.
+func (guard *BlocklistGuard) CheckOutput(_ context.Context, resp *ai.ModelResponse) (GuardDecision, error) {
+	return guard.check(responseText(resp)), nil
+}
+
+func (guard *BlocklistGuard) check(text string) GuardDecision {
+	for _, pattern := range guard.Patterns {
+		if pattern.MatchString(text) {
+			return GuardDecision{
+				Action: GuardBlock,
+				Reply:  guardReply(guard.Reply),
+				Reason: fmt.Sprintf("blocklist pattern %q", pattern.String()),
+			}
+		}
+	}
+
+	lower := strings.ToLower(text)
+	for _, keyword := range guard.Keywords {
+		if strings.Contains(lower, strings.ToLower(keyword)) {
+			return GuardDecision{
+				Action: GuardBlock,
+				Reply:  guardReply(guard.Reply),
+				Reason: fmt.Sprintf("blocklist keyword %q", keyword),
+			}
+		}
+	}
+
+	return GuardDecision{}
+}
+
+// MaxInputLengthGuard blocks incoming batches whose text exceeds MaxLength characters.
+type MaxInputLengthGuard struct {
+	// MaxLength is the maximum number of characters (runes) allowed.
+	// Zero or negative values disable the guard.
+	MaxLength int
+
+	// Reply is the canned reply. Defaults to DefaultGuardReply.
+	Reply string
+}
+
+// CheckInput checks the length of the incoming batch.
+func (guard *MaxInputLengthGuard) CheckInput(_ context.Context, batch []*ai.Message) (GuardDecision, error) {
+	if guard.MaxLength <= 0 {
+		return GuardDecision{}, nil
+	}
+
+	length := len([]rune(messagesText(batch)))
+	if length <= guard.MaxLength {
+		return GuardDecision{}, nil
+	}
+
+	return GuardDecision{
+		Action: GuardBlock,
+		Reply:  guardReply(guard.Reply),
+		Reason: fmt.Sprintf("input length %d exceeds %d", length, guard.MaxLength),
+	}, nil
+}
+
+// GuardVerdict is the structured output requested from the model used by ClassifierGuard.
+type GuardVerdict struct {
+	Allowed bool   `json:"allowed" jsonschema_description:"True if the content complies with the policy."`
+	Reason  string `json:"reason,omitempty" jsonschema_description:"Short explanation when the content is not allowed."`
+}
+
+// ClassifierGuard asks an LLM whether the content complies with a policy.
+// It can be used both as an input and as an output guard.
+type ClassifierGuard struct {
+	// Genkit is the Genkit instance used to classify the content.
+	Genkit *genkit.Genkit
+
+	// Model is the AI model used to classify the content.
+	// If specified, it takes precedence over ModelName.
+	Model ai.ModelArg
+
+	// ModelName is the name of the AI model used to classify the content.
+	// It is used only if Model is not defined (nil).
+	ModelName string
+
+	// Policy describes in natural language what content is allowed or not.
+	Policy string
+
+	// Reply is the canned reply. Defaults to DefaultGuardReply.
+	Reply string
+}
+
+// CheckInput classifies the text of the incoming batch.
+func (guard *ClassifierGuard) CheckInput(ctx context.Context, batch []*ai.Message) (GuardDecision, error) {
+	return guard.check(ctx, messagesText(batch))
+}
+
+// CheckOutput classifies the text of the model response.
+func (guard *ClassifierGuard) CheckOutput(ctx context.Context, resp *ai.ModelResponse) (GuardDecision, error) {
+	return guard.check(ctx, responseText(resp))
+}
+
+func (guard *ClassifierGuard) check(ctx context.Context, text string) (GuardDecision, error) {
+	opts := []ai.GenerateOption{
+		ai.WithSystem(DefaultClassifierGuardInstructions, guard.Policy),
+		ai.WithMessages(ai.NewUserTextMessage(text)),
+	}
+
+	if guard.Model != nil {
+		opts = append(opts, ai.WithModel(guard.Model))
+	} else if guard.ModelName != "" {
+		opts = append(opts, ai.WithModelName(guard.ModelName))
+	}
+
+	verdict, _, err := genkit.GenerateData[GuardVerdict](ctx, guard.Genkit, opts...)
+	if err != nil {
+		return GuardDecision{}, err
+	}
+
+	if verdict.Allowed {
+		return GuardDecision{}, nil
+	}
+
+	return GuardDecision{
+		Action: GuardBlock,
+		Reply:  guardReply(guard.Reply),
+		Reason: verdict.Reason,
+	}, nil
+}
@@ -0,0 +1,139 @@
+package agens
+
+import (
+	"context"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+const HandoffStep = "handoff"
+
+const (
+	// RequestHumanToolName is the name of the built-in tool the model can call
+	// to escalate the conversation to a human operator.
+	RequestHumanToolName = "request_human"
+
+	// HandoffMessage is the finish message of the delegated responses returned
+	// while a conversation is paused for a human operator.
+	HandoffMessage = "conversation handled by a human operator"
+)
+
+// Statuses returned by the request human tool.
+const (
+	StatusHandoffSuccess = "success"
+)
+
+// HandoffProvider defines an interface for providing handoff memory instances
+// tailored for specific agents.
+type HandoffProvider interface {
+	// ForAgent initializes or retrieves a HandoffMemory implementation for the specified agentName.
+	ForAgent(agentName string) (HandoffMemory, error)
+}
+
+// HandoffMemory persists which conversations are paused because a human
+// operator has taken them over.
+type HandoffMemory interface {
+	// IsPaused reports whether the conversation is paused.
+	IsPaused(ctx context.Context, conversationID string) (bool, error)
+
+	// Pause marks the conversation as paused.
+	Pause(ctx context.Context, conversationID string) error
+
+	// Resume removes the paused mark of the conversation.
+	Resume(ctx context.Context, conversationID string) error
+
+	// Close performs any necessary cleanup, such as closing database connections.
+	Close() error
+}
+
+// HandoffRequest describes an escalation requested by the model through the request human tool.
+type HandoffRequest struct {
+	// AgentName is the name of the agent that escalated the conversation.
+	AgentName string
+
+	// ConversationID is the identifier of the paused conversation.
+	ConversationID string
+
+	// Reason is the explanation given by the model.
+	Reason string
+
+	// Message is the incoming message of the run that escalated the conversation.
+	Message *ai.Message
+}
+
+// HandoffNotifier is called when the model escalates a conversation, so an
+// operator channel can be notified.
+type HandoffNotifier func(ctx context.Context, req HandoffRequest) error
+
+type (
+	// RequestHumanInput is the input schema of the request human tool.
+	RequestHumanInput struct {
+		Reason string `json:"reason" jsonschema_description:"Short explanation of why a human operator is needed."`
+	}
+
+	// RequestHumanOutput is the output schema of the request human tool.
+	RequestHumanOutput struct {
+		Status string `json:"status" jsonschema:"enum=success,description=The outcome of the operation."`
+	}
+)
+
+// IsPausedResponse reports whether resp was returned because the conversation
+// is paused for a human operator.
+func IsPausedResponse(resp *ai.ModelResponse) bool {
+	return (resp != nil) && (resp.FinishReason == FinishReasonDelegated) && (resp.FinishMessage == HandoffMessage)
+}
+
+// RequestHumanTool returns the tool that lets the model pause the conversation
+// being run and hand it over to a human operator. The notifier, if not nil, is
+// called before the conversation is paused.
+func RequestHumanTool(agentName string, handoffMemory HandoffMemory, notifier HandoffNotifier) ai.Tool {
+	f := func(ctx *ai.ToolContext, input RequestHumanInput) (RequestHumanOutput, error) {
+		conversationID := GetRunConversationID(ctx)
+		if conversationID == "" {
+			return RequestHumanOutput{}, ErrNoRunConversation
+		}
+
+		if notifier != nil {
+			err := notifier(ctx, HandoffRequest{
+				AgentName:      agentName,
+				ConversationID: conversationID,
+				Reason:         input.Reason,
+				Message:        GetRunMessage(ctx),
+			})
+			if err != nil {
+				return RequestHumanOutput{}, err
+			}
+		}
+
+		if err := handoffMemory.Pause(ctx, conversationID); err != nil {
+			return RequestHumanOutput{}, err
+		}
+		return RequestHumanOutput{Status: StatusHandoffSuccess}, nil
+	}
+
+	return ai.NewTool(
+		RequestHumanToolName,
+		"Hands the conversation over to a human operator. Use it when the user asks for a person or when you cannot help them. After calling it, tell the user that an operator will reply soon.",
+		f,
+	)
+}
+
+// pausedModelResponse builds the delegated response of a paused conversation,
+// whose history is the incoming batch so it is still stored.
+func pausedModelResponse(batch []*ai.Message) *ai.ModelResponse {
+	resp := DelegatedModelResponse()
+	resp.FinishMessage = HandoffMessage
+	resp.Request = &ai.ModelRequest{Messages: batch}
+	return resp
+}
+
+func handoffStep(ctx context.Context, handoffMemory HandoffMemory, conversationID string) (bool, error) {
+	if handoffMemory == nil {
+		return false, nil
+	}
+
+	return genkit.Run(ctx, HandoffStep, func() (bool, error) {
+		return handoffMemory.IsPaused(ctx, conversationID)
+	})
+}
@@ -30,3 +30,11 @@ type HistoryMemory interface {
 	// Close performs any necessary cleanup, such as closing database connections.
 	Close() error
 }
+
+// HistoryMessageDeleter is implemented by the HistoryMemory implementations
+// that can delete single messages of a conversation.
+type HistoryMessageDeleter interface {
+	// DeleteMessages removes the messages with the given stored IDs (see
+	// StoredIDKey) from the history of a conversation. Unknown IDs are ignored.
+	DeleteMessages(ctx context.Context, conversationID string, storedIDs []string) error
+}
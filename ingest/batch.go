@@ -0,0 +1,97 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// DefaultBatchDocuments is the default maximum number of documents indexed at once.
+const DefaultBatchDocuments = 32
+
+// Indexer indexes documents under a label. It is implemented by *agens.Agent
+// and by the agens.KnowledgeMemory implementations.
+type Indexer interface {
+	IndexKnowledge(ctx context.Context, label string, docs []*ai.Document) error
+}
+
+// BatchOptions limits the documents indexed at once, so each IndexKnowledge
+// call fits in a single request to the embedder.
+type BatchOptions struct {
+	// MaxDocuments is the maximum number of documents of a batch. Defaults to DefaultBatchDocuments.
+	MaxDocuments int
+
+	// MaxTokens is the maximum number of tokens of a batch, estimated with
+	// EstimateTokens. A document bigger than MaxTokens is indexed alone.
+	// Zero means no limit.
+	MaxTokens int
+}
+
+// Batches groups the documents, in order, into batches within the limits.
+func (opts BatchOptions) Batches(docs []*ai.Document) [][]*ai.Document {
+	maxDocs := opts.MaxDocuments
+	if maxDocs <= 0 {
+		maxDocs = DefaultBatchDocuments
+	}
+
+	var (
+		batches [][]*ai.Document
+		batch   []*ai.Document
+		tokens  int
+	)
+	for _, doc := range docs {
+		docTokens := EstimateTokens(documentText(doc))
+
+		full := len(batch) == maxDocs
+		if (opts.MaxTokens > 0) && (tokens+docTokens > opts.MaxTokens) {
+			full = true
+		}
+		if full && (len(batch) > 0) {
+			batches = append(batches, batch)
+			batch, tokens = nil, 0
+		}
+
+		batch = append(batch, doc)
+		tokens += docTokens
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// IndexBatches indexes the documents under the label in batches. It stops at
+// the first error; the batches before it stay indexed, and the memories skip
+// them when indexed again.
+func IndexBatches(ctx context.Context, indexer Indexer, label string, docs []*ai.Document, opts BatchOptions) error {
+	batches := opts.Batches(docs)
+	for i, batch := range batches {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := indexer.IndexKnowledge(ctx, label, batch); err != nil {
+			return fmt.Errorf("error indexing batch %d of %d: %w", i+1, len(batches), err)
+		}
+	}
+	return nil
+}
+
+// Pipeline splits documents into chunks and indexes them in batches.
+type Pipeline struct {
+	// Splitter splits the documents. Defaults to a RecursiveSplitter.
+	Splitter Splitter
+
+	// Batch limits the chunks indexed at once.
+	Batch BatchOptions
+}
+
+// Ingest splits the documents and indexes their chunks under the label.
+func (p Pipeline) Ingest(ctx context.Context, indexer Indexer, label string, docs ...*ai.Document) error {
+	splitter := p.Splitter
+	if splitter == nil {
+		splitter = &RecursiveSplitter{}
+	}
+	return IndexBatches(ctx, indexer, label, SplitDocuments(splitter, docs...), p.Batch)
+}
@@ -0,0 +1,184 @@
+// Package ingest prepares documents for Agent.IndexKnowledge: it splits them
+// into chunks small enough to embed, carrying their source, position and
+// headings as metadata, and indexes the chunks in batches the embedder accepts.
+//
+//	pipeline := ingest.Pipeline{Splitter: &ingest.MarkdownSplitter{IncludeHeadings: true}}
+//	err := pipeline.Ingest(ctx, agent, "manual", ingest.NewDocument("manual.md", text))
+package ingest
+
+import (
+	"maps"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/gonzxlezs/agens"
+)
+
+const (
+	// SourceKey is the key used in the document metadata to store where the
+	// document comes from, e.g. a file name or a URL. Chunks keep the source
+	// of their document.
+	SourceKey = "source"
+
+	// ChunkIndexKey is the key used in the chunk metadata to store its
+	// position among the chunks of the document, starting at 0.
+	ChunkIndexKey = "chunk_index"
+
+	// ChunkCountKey is the key used in the chunk metadata to store the number
+	// of chunks of the document.
+	ChunkCountKey = "chunk_count"
+
+	// StartOffsetKey and EndOffsetKey are the keys used in the chunk metadata
+	// to store the byte offsets of the chunk in the text of the document.
+	StartOffsetKey = "start_offset"
+	EndOffsetKey   = "end_offset"
+
+	// HeadingsKey is the key used in the chunk metadata to store the Markdown
+	// headings of the section of the chunk, from the outermost, as a []string.
+	HeadingsKey = "headings"
+)
+
+// Chunk is a piece of a text.
+type Chunk struct {
+	// Text is the text of the chunk, without leading and trailing spaces.
+	Text string
+
+	// Start and End are the byte offsets of Text in the split text. With
+	// MarkdownSplitter.IncludeHeadings, they exclude the headings prefix.
+	Start int
+	End   int
+
+	// Headings are the Markdown headings of the section of the chunk, if any.
+	Headings []string
+}
+
+// Splitter splits a text into chunks, in order.
+type Splitter interface {
+	Split(text string) []Chunk
+}
+
+// SplitterFunc adapts a function to the Splitter interface.
+type SplitterFunc func(text string) []Chunk
+
+func (f SplitterFunc) Split(text string) []Chunk {
+	return f(text)
+}
+
+// NewDocument creates a text document with its source in the metadata.
+func NewDocument(source string, text string) *ai.Document {
+	return ai.DocumentFromText(text, map[string]any{SourceKey: source})
+}
+
+// SplitDocuments splits the text of each document and returns a document per
+// chunk. The chunks keep the metadata of their document (including its
+// source), plus their index, count, offsets and headings.
+func SplitDocuments(splitter Splitter, docs ...*ai.Document) []*ai.Document {
+	var chunkDocs []*ai.Document
+	for _, doc := range docs {
+		chunks := splitter.Split(documentText(doc))
+
+		for i, chunk := range chunks {
+			metadata := maps.Clone(doc.Metadata)
+			if metadata == nil {
+				metadata = make(map[string]any)
+			}
+
+			metadata[ChunkIndexKey] = i
+			metadata[ChunkCountKey] = len(chunks)
+			metadata[StartOffsetKey] = chunk.Start
+			metadata[EndOffsetKey] = chunk.End
+			if len(chunk.Headings) > 0 {
+				metadata[HeadingsKey] = chunk.Headings
+			}
+
+			chunkDocs = append(chunkDocs, ai.DocumentFromText(chunk.Text, metadata))
+		}
+	}
+	return chunkDocs
+}
+
+// EstimateTokens roughly estimates the tokens of a text like
+// agens.DefaultTokenEstimator: its characters divided by agens.DefaultCharsPerToken.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + agens.DefaultCharsPerToken - 1) / agens.DefaultCharsPerToken
+}
+
+func documentText(doc *ai.Document) string {
+	var b strings.Builder
+	for _, part := range doc.Content {
+		if part.IsText() {
+			b.WriteString(part.Text)
+		}
+	}
+	return b.String()
+}
+
+// span is a range of byte offsets of a text.
+type span struct {
+	start int
+	end   int
+}
+
+// merge groups consecutive spans into chunks weighing at most size, except
+// for single spans heavier than size. Each chunk but the first starts with
+// the last spans of the previous one weighing at most overlap.
+func merge(spans []span, weight func(span) int, size int, overlap int) []span {
+	if overlap >= size {
+		overlap = 0
+	}
+
+	var merged []span
+	for i := 0; i < len(spans); {
+		j, total := i, 0
+		for (j < len(spans)) && ((j == i) || (total+weight(spans[j]) <= size)) {
+			total += weight(spans[j])
+			j++
+		}
+		merged = append(merged, span{spans[i].start, spans[j-1].end})
+
+		if j == len(spans) {
+			break
+		}
+
+		// Step back over the overlapping spans, always moving forward.
+		next, kept := j, 0
+		for (next > i+1) && (kept+weight(spans[next-1]) <= overlap) {
+			kept += weight(spans[next-1])
+			next--
+		}
+		i = next
+	}
+	return merged
+}
+
+// chunks returns the chunks of the text for the spans, trimming their spaces
+// and dropping the empty ones.
+func chunks(text string, spans []span, headings []string) []Chunk {
+	var result []Chunk
+	for _, s := range spans {
+		start, end := s.start, s.end
+
+		raw := text[start:end]
+		trimmed := strings.TrimLeftFunc(raw, unicode.IsSpace)
+		start += len(raw) - len(trimmed)
+		end = start + len(strings.TrimRightFunc(trimmed, unicode.IsSpace))
+
+		if start < end {
+			result = append(result, Chunk{
+				Text:     text[start:end],
+				Start:    start,
+				End:      end,
+				Headings: headings,
+			})
+		}
+	}
+	return result
+}
+
+func runeWeight(text string) func(span) int {
+	return func(s span) int {
+		return utf8.RuneCountInString(text[s.start:s.end])
+	}
+}
@@ -0,0 +1,174 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/gonzxlezs/agens/agenstest"
+)
+
+func texts(chunks []Chunk) []string {
+	var texts []string
+	for _, c := range chunks {
+		texts = append(texts, c.Text)
+	}
+	return texts
+}
+
+// checkOffsets asserts that the offsets of the chunks point to their text.
+func checkOffsets(t *testing.T, text string, chunks []Chunk) {
+	t.Helper()
+
+	for _, c := range chunks {
+		if text[c.Start:c.End] != c.Text {
+			t.Errorf("text[%d:%d] = %q, want %q", c.Start, c.End, text[c.Start:c.End], c.Text)
+		}
+	}
+}
+
+func TestTokenSplitter(t *testing.T) {
+	// every word is a token
+	text := "a b c d e f g"
+
+	chunks := (&TokenSplitter{ChunkTokens: 3, OverlapTokens: 1}).Split(text)
+	want := []string{"a b c", "c d e", "e f g"}
+	if got := texts(chunks); !slices.Equal(got, want) {
+		t.Errorf("chunks = %q, want %q", got, want)
+	}
+	checkOffsets(t, text, chunks)
+}
+
+func TestRecursiveSplitter(t *testing.T) {
+	text := "First paragraph. It is short.\n\nSecond paragraph is a bit longer than the first one.\n\nThird."
+
+	chunks := (&RecursiveSplitter{ChunkSize: 40}).Split(text)
+	want := []string{
+		"First paragraph. It is short.",
+		"Second paragraph is a bit longer than",
+		"the first one.",
+		"Third.",
+	}
+	if got := texts(chunks); !slices.Equal(got, want) {
+		t.Errorf("chunks = %q, want %q", got, want)
+	}
+	checkOffsets(t, text, chunks)
+
+	for _, c := range (&RecursiveSplitter{ChunkSize: 4}).Split("abcdefghij") {
+		if len(c.Text) > 4 {
+			t.Errorf("chunk %q longer than 4 characters", c.Text)
+		}
+	}
+}
+
+func TestSentenceSplitter(t *testing.T) {
+	text := `Hello there. How are you? I am "fine." Thanks`
+
+	chunks := (&SentenceSplitter{ChunkSize: 26}).Split(text)
+	want := []string{"Hello there. How are you?", `I am "fine." Thanks`}
+	if got := texts(chunks); !slices.Equal(got, want) {
+		t.Errorf("chunks = %q, want %q", got, want)
+	}
+	checkOffsets(t, text, chunks)
+}
+
+func TestMarkdownSplitter(t *testing.T) {
+	text := "Intro.\n\n# Guide\n\n## Install\n\nRun it.\n\n```sh\n# not a heading\n```\n\n## Use\n\nCall it.\n\n# FAQ\nNone.\n"
+
+	chunks := (&MarkdownSplitter{}).Split(text)
+	want := [][]string{nil, {"Guide", "Install"}, {"Guide", "Use"}, {"FAQ"}}
+	if len(chunks) != len(want) {
+		t.Fatalf("chunks = %q, want %d", texts(chunks), len(want))
+	}
+	for i, c := range chunks {
+		if !slices.Equal(c.Headings, want[i]) {
+			t.Errorf("chunk %d headings = %q, want %q", i, c.Headings, want[i])
+		}
+	}
+	if !strings.Contains(chunks[1].Text, "# not a heading") {
+		t.Errorf("the code block was split: %q", chunks[1].Text)
+	}
+	checkOffsets(t, text, chunks)
+
+	text = "# Guide\n## FAQ\nOne. Two.\n# Notes\nNone."
+	chunks = (&MarkdownSplitter{
+		Splitter:        &SentenceSplitter{ChunkSize: 5},
+		IncludeHeadings: true,
+	}).Split(text)
+	if got := texts(chunks); !slices.Equal(got, []string{"Guide > FAQ\n\nOne.", "Guide > FAQ\n\nTwo.", "Notes\n\nNone."}) {
+		t.Errorf("chunks = %q", got)
+	}
+
+	// the offsets refer to the text without the prefix
+	for _, c := range chunks {
+		if prefix := strings.Join(c.Headings, " > ") + "\n\n"; prefix+text[c.Start:c.End] != c.Text {
+			t.Errorf("text[%d:%d] = %q, want %q without the prefix", c.Start, c.End, text[c.Start:c.End], c.Text)
+		}
+	}
+}
+
+func TestSplitDocuments(t *testing.T) {
+	doc := NewDocument("notes.txt", "One. Two.")
+	doc.Metadata["author"] = "me"
+
+	docs := SplitDocuments(&SentenceSplitter{ChunkSize: 4}, doc)
+	if len(docs) != 2 {
+		t.Fatalf("got %d documents, want 2", len(docs))
+	}
+
+	metadata := docs[1].Metadata
+	if metadata[SourceKey] != "notes.txt" || metadata["author"] != "me" {
+		t.Errorf("the document metadata was not kept: %v", metadata)
+	}
+	if metadata[ChunkIndexKey] != 1 || metadata[ChunkCountKey] != 2 || metadata[StartOffsetKey] != 5 {
+		t.Errorf("chunk metadata = %v", metadata)
+	}
+	if _, ok := doc.Metadata[ChunkIndexKey]; ok {
+		t.Error("the metadata of the source document was changed")
+	}
+}
+
+func TestBatches(t *testing.T) {
+	docs := []*ai.Document{
+		ai.DocumentFromText(strings.Repeat("a", 40), nil), // 10 tokens
+		ai.DocumentFromText(strings.Repeat("b", 40), nil),
+		ai.DocumentFromText(strings.Repeat("c", 80), nil), // 20 tokens
+		ai.DocumentFromText("d", nil),
+	}
+
+	var sizes []int
+	for _, batch := range (BatchOptions{MaxDocuments: 3, MaxTokens: 20}).Batches(docs) {
+		sizes = append(sizes, len(batch))
+	}
+	if !slices.Equal(sizes, []int{2, 1, 1}) {
+		t.Errorf("batch sizes = %v, want [2 1 1]", sizes)
+	}
+}
+
+func TestPipelineIngest(t *testing.T) {
+	ctx := context.Background()
+	knowledge := &agenstest.KnowledgeMemory{}
+
+	pipeline := Pipeline{
+		Splitter: &SentenceSplitter{ChunkSize: 1},
+		Batch:    BatchOptions{MaxDocuments: 2},
+	}
+	if err := pipeline.Ingest(ctx, knowledge, "faq", NewDocument("faq", "One. Two. Three.")); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := knowledge.Calls(); len(calls) != 2 {
+		t.Errorf("IndexKnowledge called %d times, want 2", len(calls))
+	}
+	if docs, _ := knowledge.RetrieveKnowledge(ctx, "three"); len(docs) != 1 {
+		t.Errorf("retrieved %d documents, want 1", len(docs))
+	}
+
+	knowledge.Err = errors.New("unavailable")
+	if err := pipeline.Ingest(ctx, knowledge, "faq", NewDocument("faq", "Four.")); !errors.Is(err, knowledge.Err) {
+		t.Errorf("error = %v, want %v", err, knowledge.Err)
+	}
+}
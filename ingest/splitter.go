@@ -0,0 +1,369 @@
+package ingest
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultChunkTokens is the default size of the chunks of TokenSplitter.
+	DefaultChunkTokens = 256
+
+	// DefaultChunkSize is the default size, in characters, of the chunks of
+	// RecursiveSplitter and SentenceSplitter.
+	DefaultChunkSize = 1000
+)
+
+// DefaultSeparators are the separators tried by RecursiveSplitter: paragraphs,
+// lines, sentences, words and, as a last resort, characters.
+var DefaultSeparators = []string{"\n\n", "\n", ". ", " ", ""}
+
+var (
+	_ Splitter = &TokenSplitter{}
+	_ Splitter = &RecursiveSplitter{}
+	_ Splitter = &SentenceSplitter{}
+	_ Splitter = &MarkdownSplitter{}
+)
+
+// TokenSplitter splits a text into chunks of a fixed number of tokens, that
+// overlap so a sentence cut between two chunks is complete in one of them.
+// Tokens are estimated like EstimateTokens, word by word, so chunks never cut
+// a word.
+type TokenSplitter struct {
+	// ChunkTokens is the maximum number of tokens of a chunk. Defaults to DefaultChunkTokens.
+	ChunkTokens int
+
+	// OverlapTokens is the number of tokens at the end of a chunk repeated at
+	// the start of the next one. It must be lower than ChunkTokens.
+	OverlapTokens int
+}
+
+func (s *TokenSplitter) Split(text string) []Chunk {
+	size := s.ChunkTokens
+	if size <= 0 {
+		size = DefaultChunkTokens
+	}
+
+	weight := func(w span) int {
+		return EstimateTokens(text[w.start:w.end])
+	}
+	return chunks(text, merge(wordSpans(text), weight, size, s.OverlapTokens), nil)
+}
+
+// wordSpans returns the spans of the words of the text.
+func wordSpans(text string) []span {
+	var (
+		spans []span
+		start = -1
+	)
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				spans = append(spans, span{start, i})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, span{start, len(text)})
+	}
+	return spans
+}
+
+// RecursiveSplitter splits a text by the first separator found in it and
+// merges the consecutive pieces into chunks of up to ChunkSize characters;
+// the pieces still too long are split the same way by the next separators.
+// It keeps paragraphs, then lines, then sentences together as long as they fit.
+type RecursiveSplitter struct {
+	// ChunkSize is the maximum number of characters of a chunk. Defaults to DefaultChunkSize.
+	ChunkSize int
+
+	// ChunkOverlap is the maximum number of characters at the end of a chunk
+	// repeated at the start of the next one. It must be lower than ChunkSize.
+	ChunkOverlap int
+
+	// Separators are tried in order. An empty separator splits between
+	// characters. Defaults to DefaultSeparators.
+	Separators []string
+}
+
+func (s *RecursiveSplitter) Split(text string) []Chunk {
+	size := s.ChunkSize
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+
+	separators := s.Separators
+	if len(separators) == 0 {
+		separators = DefaultSeparators
+	}
+
+	return chunks(text, s.split(text, span{0, len(text)}, separators, size), nil)
+}
+
+// split splits the span of the text into chunks of up to size characters.
+// The separators stay at the end of the pieces.
+func (s *RecursiveSplitter) split(text string, sp span, separators []string, size int) []span {
+	weight := runeWeight(text)
+	if weight(sp) <= size {
+		return []span{sp}
+	}
+
+	for i, sep := range separators {
+		if sep == "" {
+			return splitRunes(text, sp, size)
+		}
+		if !strings.Contains(text[sp.start:sp.end], sep) {
+			continue
+		}
+
+		var result, fitting []span
+		for pos := sp.start; pos < sp.end; {
+			end := sp.end
+			if idx := strings.Index(text[pos:sp.end], sep); idx >= 0 {
+				end = pos + idx + len(sep)
+			}
+
+			piece := span{pos, end}
+			if weight(piece) <= size {
+				fitting = append(fitting, piece)
+			} else {
+				result = append(result, merge(fitting, weight, size, s.ChunkOverlap)...)
+				result = append(result, s.split(text, piece, separators[i+1:], size)...)
+				fitting = nil
+			}
+			pos = end
+		}
+		return append(result, merge(fitting, weight, size, s.ChunkOverlap)...)
+	}
+
+	// No separator left: the piece is kept whole.
+	return []span{sp}
+}
+
+// splitRunes splits the span of the text into pieces of size characters.
+func splitRunes(text string, s span, size int) []span {
+	var (
+		pieces []span
+		start  = s.start
+		n      = 0
+	)
+	for i := range text[s.start:s.end] {
+		if n == size {
+			pieces = append(pieces, span{start, s.start + i})
+			start, n = s.start+i, 0
+		}
+		n++
+	}
+	return append(pieces, span{start, s.end})
+}
+
+// SentenceSplitter splits a text into sentences and groups the consecutive
+// ones into chunks of up to ChunkSize characters. A sentence longer than
+// ChunkSize is a chunk on its own. Sentences end with '.', '!' or '?'
+// followed by a space, or with a blank line.
+type SentenceSplitter struct {
+	// ChunkSize is the maximum number of characters of a chunk. Defaults to DefaultChunkSize.
+	ChunkSize int
+
+	// ChunkOverlap is the maximum number of characters of the last sentences
+	// of a chunk repeated at the start of the next one. It must be lower than ChunkSize.
+	ChunkOverlap int
+}
+
+func (s *SentenceSplitter) Split(text string) []Chunk {
+	size := s.ChunkSize
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	return chunks(text, merge(sentenceSpans(text), runeWeight(text), size, s.ChunkOverlap), nil)
+}
+
+// sentenceSpans returns the spans of the sentences of the text, each with the
+// spaces that follow it.
+func sentenceSpans(text string) []span {
+	var (
+		spans []span
+		start = 0
+	)
+	for i := 0; i < len(text); {
+		r, width := utf8.DecodeRuneInString(text[i:])
+		next := i + width
+
+		end := -1
+		switch {
+		case (r == '.') || (r == '!') || (r == '?'):
+			// Closing quotes and brackets belong to the sentence.
+			for (next < len(text)) && strings.ContainsRune(`"')]`, rune(text[next])) {
+				next++
+			}
+			if (next == len(text)) || isSpaceAt(text, next) {
+				end = next
+			}
+		case strings.HasPrefix(text[i:], "\n\n"):
+			end = i
+		}
+
+		if end >= 0 {
+			// The following spaces belong to the sentence.
+			for (end < len(text)) && isSpaceAt(text, end) {
+				_, width := utf8.DecodeRuneInString(text[end:])
+				end += width
+			}
+			if end > start {
+				spans = append(spans, span{start, end})
+			}
+			start, next = end, max(next, end)
+		}
+		i = next
+	}
+	if start < len(text) {
+		spans = append(spans, span{start, len(text)})
+	}
+	return spans
+}
+
+func isSpaceAt(text string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(text[i:])
+	return unicode.IsSpace(r)
+}
+
+// MarkdownSplitter splits a Markdown text into sections at its headings, so
+// chunks never mix sections, and sets the headings of each chunk. Headings
+// inside fenced code blocks are ignored.
+type MarkdownSplitter struct {
+	// MaxHeadingLevel is the deepest heading level that starts a section;
+	// deeper headings stay in the text of their section. Defaults to 6.
+	MaxHeadingLevel int
+
+	// Splitter splits the sections further, e.g. a RecursiveSplitter for
+	// long sections. If nil, each section is a chunk.
+	Splitter Splitter
+
+	// IncludeHeadings prepends the headings of the chunk, separated by " > ",
+	// to its text, in place of the heading line of the section. The memories
+	// only store the text, so this keeps the context of the chunks that do not
+	// start with their heading. The offsets of the chunks refer to the text
+	// without the prefix.
+	IncludeHeadings bool
+}
+
+func (s *MarkdownSplitter) Split(text string) []Chunk {
+	maxLevel := s.MaxHeadingLevel
+	if (maxLevel <= 0) || (maxLevel > 6) {
+		maxLevel = 6
+	}
+
+	var (
+		result   []Chunk
+		headings []string
+		levels   []int
+		start    = 0
+		body     = false
+		fence    = ""
+	)
+
+	flush := func(end int) {
+		if body {
+			result = append(result, s.splitSection(text, span{start, end}, headings)...)
+		}
+	}
+
+	for pos := 0; pos < len(text); {
+		lineEnd := strings.IndexByte(text[pos:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(text)
+		} else {
+			lineEnd += pos + 1
+		}
+		line := strings.TrimRight(text[pos:lineEnd], "\r\n")
+
+		trimmed := strings.TrimLeft(line, " ")
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			body = true
+
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+			body = true
+
+		default:
+			level, title := parseHeading(line)
+			if (level > 0) && (level <= maxLevel) {
+				flush(pos)
+
+				// Close the sections of the same or deeper levels.
+				for (len(levels) > 0) && (levels[len(levels)-1] >= level) {
+					levels = levels[:len(levels)-1]
+					headings = headings[:len(headings)-1]
+				}
+				levels = append(levels, level)
+				headings = append(headings[:len(headings):len(headings)], title)
+
+				start, body = pos, false
+				if s.IncludeHeadings {
+					// the headings prefix replaces the heading line
+					start = lineEnd
+				}
+			} else if strings.TrimSpace(line) != "" {
+				body = true
+			}
+		}
+
+		pos = lineEnd
+	}
+	flush(len(text))
+
+	return result
+}
+
+// parseHeading returns the level and the title of an ATX heading line, or 0
+// if the line is not a heading.
+func parseHeading(line string) (level int, title string) {
+	if len(line)-len(strings.TrimLeft(line, " ")) > 3 {
+		return 0, ""
+	}
+	line = strings.TrimLeft(line, " ")
+
+	for (level < len(line)) && (line[level] == '#') {
+		level++
+	}
+	if (level == 0) || (level > 6) {
+		return 0, ""
+	}
+	if (level < len(line)) && (line[level] != ' ') && (line[level] != '\t') {
+		return 0, ""
+	}
+
+	title = strings.TrimSpace(line[level:])
+	title = strings.TrimSpace(strings.TrimRight(title, "#"))
+	return level, title
+}
+
+func (s *MarkdownSplitter) splitSection(text string, section span, headings []string) []Chunk {
+	var sectionChunks []Chunk
+	if s.Splitter == nil {
+		sectionChunks = chunks(text, []span{section}, headings)
+	} else {
+		for _, chunk := range s.Splitter.Split(text[section.start:section.end]) {
+			chunk.Start += section.start
+			chunk.End += section.start
+			chunk.Headings = headings
+			sectionChunks = append(sectionChunks, chunk)
+		}
+	}
+
+	if s.IncludeHeadings && (len(headings) > 0) {
+		prefix := strings.Join(headings, " > ") + "\n\n"
+		for i := range sectionChunks {
+			sectionChunks[i].Text = prefix + sectionChunks[i].Text
+		}
+	}
+	return sectionChunks
+}
@@ -2,10 +2,42 @@ package agens
 
 import (
 	"context"
+	"strings"
 
 	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
 )
 
+const RetrieveKnowledgeStep = "retrieveKnowledge"
+
+// DefaultKnowledgeContextPreface introduces the documents injected into the
+// system message when the agent runs in KnowledgeModeInject or KnowledgeModeInjectAndTool.
+const DefaultKnowledgeContextPreface = "Use the following information, retrieved from the knowledge base, to answer the user:"
+
+// KnowledgeMode controls how an agent uses its KnowledgeMemory.
+type KnowledgeMode int
+
+const (
+	// KnowledgeModeTool exposes the knowledge base only as a tool the model may call.
+	KnowledgeModeTool KnowledgeMode = iota
+
+	// KnowledgeModeInject queries the knowledge base with the incoming batch
+	// before generation and injects the top documents as context, without the tool.
+	KnowledgeModeInject
+
+	// KnowledgeModeInjectAndTool injects the top documents as context and also
+	// exposes the knowledge base as a tool for follow-up queries.
+	KnowledgeModeInjectAndTool
+)
+
+func (mode KnowledgeMode) useTool() bool {
+	return mode != KnowledgeModeInject
+}
+
+func (mode KnowledgeMode) inject() bool {
+	return (mode == KnowledgeModeInject) || (mode == KnowledgeModeInjectAndTool)
+}
+
 // KnowledgeProvider defines the interface for creating or retrieving
 // a KnowledgeMemory instance for a specific agent.
 type KnowledgeProvider interface {
@@ -27,4 +59,62 @@ type KnowledgeMemory interface {
 	// Index stores and indexes a set of documents under a specific label
 	// to make them searchable by the agent.
 	IndexKnowledge(ctx context.Context, label string, docs []*ai.Document) error
+
+	// RetrieveKnowledge returns the documents most relevant to the query,
+	// up to the limit the memory was created with.
+	RetrieveKnowledge(ctx context.Context, query string) ([]*ai.Document, error)
+}
+
+func retrieveKnowledgeStep(ctx context.Context, cfg *AgentConfig, knowledgeMemory KnowledgeMemory, batch []*ai.Message) ([]*ai.Document, error) {
+	if (knowledgeMemory == nil) || !cfg.KnowledgeMode.inject() {
+		return nil, nil
+	}
+
+	queryFunc := cfg.KnowledgeQueryFunc
+	if queryFunc == nil {
+		queryFunc = messagesText
+	}
+
+	query := strings.TrimSpace(queryFunc(batch))
+	if query == "" {
+		return nil, nil
+	}
+
+	return genkit.Run(ctx, RetrieveKnowledgeStep, func() ([]*ai.Document, error) {
+		return knowledgeMemory.RetrieveKnowledge(ctx, query)
+	})
+}
+
+// knowledgeContext formats the documents to be appended to the system message.
+func knowledgeContext(docs []*ai.Document) string {
+	var b strings.Builder
+	for _, doc := range docs {
+		text := documentText(doc)
+		if text == "" {
+			continue
+		}
+
+		if b.Len() == 0 {
+			b.WriteString(DefaultKnowledgeContextPreface)
+			b.WriteString("\n")
+		}
+		b.WriteString("- ")
+		b.WriteString(text)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func documentText(doc *ai.Document) string {
+	if doc == nil {
+		return ""
+	}
+
+	texts := make([]string, 0, len(doc.Content))
+	for _, part := range doc.Content {
+		if part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.TrimSpace(strings.Join(texts, "\n"))
 }
@@ -0,0 +1,254 @@
+package agens
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+const ConversationLockStep = "conversationLock"
+
+const (
+	// DefaultBusyReply is the reply returned to rejected runs when no reply is configured.
+	DefaultBusyReply = "I'm still working on your previous message. Please wait for my reply before sending a new one."
+
+	// ConversationBusyMessage is the finish message of the responses returned to
+	// runs rejected because the conversation was busy.
+	ConversationBusyMessage = "conversation busy"
+
+	// ConversationMergedMessage is the finish message of the delegated responses
+	// returned to runs whose messages were merged into another run.
+	ConversationMergedMessage = "messages merged into another turn"
+)
+
+// ConcurrencyPolicy selects what happens when a run starts while another run
+// of the same conversation is in progress.
+type ConcurrencyPolicy int
+
+const (
+	// ConcurrencyQueue waits for the run in progress to finish.
+	ConcurrencyQueue ConcurrencyPolicy = iota
+
+	// ConcurrencyMerge waits for the run in progress to finish and merges all
+	// the messages received meanwhile into the next turn. The run that answers
+	// them returns the response; the others return a delegated response.
+	// Messages are only merged within the same process.
+	ConcurrencyMerge
+
+	// ConcurrencyReject answers the run with the busy reply.
+	ConcurrencyReject
+
+	// ConcurrencyParallel does not serialize the runs.
+	ConcurrencyParallel
+)
+
+// ConversationLocker provides mutual exclusion between the runs of a conversation.
+type ConversationLocker interface {
+	// Lock blocks until the lock identified by key is acquired or ctx is done.
+	// It returns the function that releases the lock.
+	Lock(ctx context.Context, key string) (func(), error)
+
+	// TryLock acquires the lock identified by key only if it is free.
+	// It returns the function that releases the lock and whether it was acquired.
+	TryLock(ctx context.Context, key string) (func(), bool, error)
+}
+
+var _ ConversationLocker = &localConversationLocker{}
+
+type localLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+type localConversationLocker struct {
+	mu    sync.Mutex
+	locks map[string]*localLock
+}
+
+// NewLocalConversationLocker returns a ConversationLocker whose locks only hold
+// within the current process. It is the default locker of the agents.
+func NewLocalConversationLocker() ConversationLocker {
+	return &localConversationLocker{locks: make(map[string]*localLock)}
+}
+
+func (l *localConversationLocker) Lock(ctx context.Context, key string) (func(), error) {
+	lock := l.acquire(key)
+
+	select {
+	case lock.ch <- struct{}{}:
+		return l.unlockFunc(key, lock), nil
+	case <-ctx.Done():
+		l.release(key, lock)
+		return nil, ctx.Err()
+	}
+}
+
+func (l *localConversationLocker) TryLock(_ context.Context, key string) (func(), bool, error) {
+	lock := l.acquire(key)
+
+	select {
+	case lock.ch <- struct{}{}:
+		return l.unlockFunc(key, lock), true, nil
+	default:
+		l.release(key, lock)
+		return nil, false, nil
+	}
+}
+
+func (l *localConversationLocker) acquire(key string) *localLock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &localLock{ch: make(chan struct{}, 1)}
+		l.locks[key] = lock
+	}
+	lock.refs++
+	return lock
+}
+
+func (l *localConversationLocker) release(key string, lock *localLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, key)
+	}
+}
+
+func (l *localConversationLocker) unlockFunc(key string, lock *localLock) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-lock.ch
+			l.release(key, lock)
+		})
+	}
+}
+
+// conversationLock serializes the runs of the conversations of an agent
+// according to its ConcurrencyPolicy.
+type conversationLock struct {
+	locker ConversationLocker
+	policy ConcurrencyPolicy
+
+	mu      sync.Mutex
+	pending map[string][]*ai.Message
+}
+
+func newConversationLock(cfg *AgentConfig) *conversationLock {
+	locker := cfg.ConversationLocker
+	if locker == nil {
+		locker = NewLocalConversationLocker()
+	}
+
+	return &conversationLock{
+		locker:  locker,
+		policy:  cfg.ConcurrencyPolicy,
+		pending: make(map[string][]*ai.Message),
+	}
+}
+
+// acquire locks the conversation and returns the function that unlocks it and
+// the batch to run, which includes the merged messages under ConcurrencyMerge.
+// A nil unlock function means that the run must not proceed: the conversation
+// was busy (ConcurrencyReject) or the batch was merged into another run
+// (ConcurrencyMerge, with an empty batch).
+func (l *conversationLock) acquire(ctx context.Context, key string, batch []*ai.Message) (func(), []*ai.Message, error) {
+	switch l.policy {
+	case ConcurrencyParallel:
+		return func() {}, batch, nil
+
+	case ConcurrencyReject:
+		unlock, ok, err := l.locker.TryLock(ctx, key)
+		if (err != nil) || !ok {
+			return nil, batch, err
+		}
+		return unlock, batch, nil
+
+	case ConcurrencyMerge:
+		unlock, ok, err := l.locker.TryLock(ctx, key)
+		if err != nil {
+			return nil, batch, err
+		}
+		if ok {
+			return unlock, append(l.takePending(key), batch...), nil
+		}
+
+		l.addPending(key, batch)
+
+		unlock, err = l.locker.Lock(ctx, key)
+		if err != nil {
+			l.removePending(key, batch)
+			return nil, batch, err
+		}
+
+		merged := l.takePending(key)
+		if !slices.Contains(merged, batch[0]) {
+			// another run answered the batch
+			unlock()
+			return nil, nil, nil
+		}
+		return unlock, merged, nil
+
+	default:
+		unlock, err := l.locker.Lock(ctx, key)
+		return unlock, batch, err
+	}
+}
+
+func (l *conversationLock) addPending(key string, batch []*ai.Message) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.pending[key] = append(l.pending[key], batch...)
+}
+
+func (l *conversationLock) takePending(key string) []*ai.Message {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	pending := l.pending[key]
+	delete(l.pending, key)
+	return pending
+}
+
+func (l *conversationLock) removePending(key string, batch []*ai.Message) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	pending := slices.DeleteFunc(l.pending[key], func(msg *ai.Message) bool {
+		return slices.Contains(batch, msg)
+	})
+
+	if len(pending) == 0 {
+		delete(l.pending, key)
+	} else {
+		l.pending[key] = pending
+	}
+}
+
+func mergedModelResponse() *ai.ModelResponse {
+	resp := DelegatedModelResponse()
+	resp.FinishMessage = ConversationMergedMessage
+	return resp
+}
+
+// busyModelResponse builds the response of a run rejected because the
+// conversation was busy. Nothing of it is stored in the history.
+func busyModelResponse(reply string) *ai.ModelResponse {
+	if reply == "" {
+		reply = DefaultBusyReply
+	}
+
+	return &ai.ModelResponse{
+		FinishReason:  ai.FinishReasonBlocked,
+		FinishMessage: ConversationBusyMessage,
+		Message:       ai.NewModelTextMessage(reply),
+		Request:       &ai.ModelRequest{},
+	}
+}
@@ -14,6 +14,11 @@ const (
 	// SourceKey is the key used in message metadata to store the source of the message
 	SourceKey = "source"
 
+	// MessageIDKey is the key used in message metadata to store the identifier
+	// the platform (Telegram, WhatsApp...) gave to the incoming message. It is
+	// used to detect redelivered messages.
+	MessageIDKey = "message_id"
+
 	// StoredIDKey is the key used in the message metadata to store the unique identifier
 	// of the message with which it was stored in a database or external system.
 	StoredIDKey = "stored_id"
@@ -21,6 +26,10 @@ const (
 	// UserIDKey is the key used in message metadata to store the ID of
 	// the user who sent the message.
 	UserIDKey = "user_id"
+
+	// ModelNameKey is the key used in the metadata of a model message to store
+	// the name of the model that generated it.
+	ModelNameKey = "model_name"
 )
 
 var (
@@ -43,6 +52,9 @@ var (
 	// is not a string.
 	ErrChannelIDNotAString = errors.New("channel ID is not a string type")
 
+	// ErrMessageIDNotAString is returned if the message ID in metadata is not a string.
+	ErrMessageIDNotAString = errors.New("message ID is not a string type")
+
 	// ErrSourceNotAString is returned if the source in metadata is not a string.
 	ErrSourceNotAString = errors.New("source is not a string type")
 
@@ -51,6 +63,9 @@ var (
 
 	// ErrUserIDNotAString is returned if the user ID in metadata is not a string.
 	ErrUserIDNotAString = errors.New("user ID is not a string type")
+
+	// ErrModelNameNotAString is returned if the model name in metadata is not a string.
+	ErrModelNameNotAString = errors.New("model name is not a string type")
 )
 
 func getMetadata(msg *ai.Message, key string) (value any, ok bool, err error) {
@@ -86,6 +101,34 @@ func GetChannelID(msg *ai.Message) (string, error) {
 	return "", ErrChannelIDNotAString
 }
 
+// GetMessageID retrieves the platform message identifier from a message's metadata.
+// It returns an empty string if the key is missing.
+func GetMessageID(msg *ai.Message) (string, error) {
+	v, ok, _ := getMetadata(msg, MessageIDKey)
+	if !ok {
+		return "", nil
+	}
+
+	if id, ok := v.(string); ok {
+		return id, nil
+	}
+	return "", ErrMessageIDNotAString
+}
+
+// GetModelName retrieves the name of the model that generated a message from its metadata.
+// It returns an empty string if the key is missing.
+func GetModelName(msg *ai.Message) (string, error) {
+	v, ok, _ := getMetadata(msg, ModelNameKey)
+	if !ok {
+		return "", nil
+	}
+
+	if name, ok := v.(string); ok {
+		return name, nil
+	}
+	return "", ErrModelNameNotAString
+}
+
 // GetSource retrieves the message source from a message's metadata.
 // It returns the source as a string and an error if the key is missing or invalid.
 func GetSource(msg *ai.Message) (string, error) {
@@ -136,6 +179,16 @@ func SetChannelID(msg *ai.Message, id string) *ai.Message {
 	return setMetadata(msg, ChannelIDKey, id)
 }
 
+// SetMessageID sets the platform message identifier in a message's metadata.
+func SetMessageID(msg *ai.Message, id string) *ai.Message {
+	return setMetadata(msg, MessageIDKey, id)
+}
+
+// SetModelName sets the name of the model that generated a message in its metadata.
+func SetModelName(msg *ai.Message, name string) *ai.Message {
+	return setMetadata(msg, ModelNameKey, name)
+}
+
 // SetSource sets the message source in a message's metadata.
 func SetSource(msg *ai.Message, source string) *ai.Message {
 	return setMetadata(msg, SourceKey, source)
@@ -0,0 +1,87 @@
+package agens
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+func TestMetadataRoundTrip(t *testing.T) {
+	msg := ai.NewUserTextMessage("hi")
+
+	SetChannelID(msg, "channel")
+	SetSource(msg, "source")
+	SetUserID(msg, "user")
+	SetMessageID(msg, "message")
+	SetStoredID(msg, "stored")
+	SetModelName(msg, "model")
+
+	tests := []struct {
+		name string
+		get  func(*ai.Message) (string, error)
+		want string
+	}{
+		{"channel ID", GetChannelID, "channel"},
+		{"source", GetSource, "source"},
+		{"user ID", GetUserID, "user"},
+		{"message ID", GetMessageID, "message"},
+		{"stored ID", GetStoredID, "stored"},
+		{"model name", GetModelName, "model"},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.get(msg)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		} else if got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMetadataMissing(t *testing.T) {
+	tests := []struct {
+		name    string
+		get     func(*ai.Message) (string, error)
+		nilErr  error
+		keyErr  error
+		typeErr error
+		key     string
+	}{
+		{"channel ID", GetChannelID, ErrMetadataNotFound, ErrChannelIDNotInMetadata, ErrChannelIDNotAString, ChannelIDKey},
+		{"source", GetSource, ErrMetadataNotFound, ErrSourceNotInMetadata, ErrSourceNotAString, SourceKey},
+		{"user ID", GetUserID, ErrMetadataNotFound, ErrUserIDNotInMetadata, ErrUserIDNotAString, UserIDKey},
+		{"message ID", GetMessageID, nil, nil, ErrMessageIDNotAString, MessageIDKey},
+		{"stored ID", GetStoredID, nil, nil, ErrStoredIDNotAString, StoredIDKey},
+		{"model name", GetModelName, nil, nil, ErrModelNameNotAString, ModelNameKey},
+	}
+
+	for _, tt := range tests {
+		if _, err := tt.get(ai.NewUserTextMessage("hi")); !errors.Is(err, tt.nilErr) {
+			t.Errorf("%s without metadata: error = %v, want %v", tt.name, err, tt.nilErr)
+		}
+
+		msg := SetSource(ai.NewUserTextMessage("hi"), "other")
+		if tt.key == SourceKey {
+			msg = SetChannelID(ai.NewUserTextMessage("hi"), "other")
+		}
+		if v, err := tt.get(msg); !errors.Is(err, tt.keyErr) || (v != "") {
+			t.Errorf("%s without key: got %q, %v, want %v", tt.name, v, err, tt.keyErr)
+		}
+
+		msg = setMetadata(ai.NewUserTextMessage("hi"), tt.key, 42)
+		if _, err := tt.get(msg); !errors.Is(err, tt.typeErr) {
+			t.Errorf("%s not a string: error = %v, want %v", tt.name, err, tt.typeErr)
+		}
+	}
+}
+
+func TestGetMetadataNilMessage(t *testing.T) {
+	if _, err := GetChannelID(nil); !errors.Is(err, ErrMetadataNotFound) {
+		t.Errorf("error = %v, want %v", err, ErrMetadataNotFound)
+	}
+	if id, err := GetStoredID(nil); (id != "") || (err != nil) {
+		t.Errorf("GetStoredID(nil) = %q, %v, want empty", id, err)
+	}
+}
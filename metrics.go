@@ -0,0 +1,200 @@
+package agens
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// MeterName is the name of the OpenTelemetry meter of the agents and triggers.
+const MeterName = "github.com/gonzxlezs/agens"
+
+// Metric names.
+const (
+	// MetricAgentRuns counts the agent runs, by agent, source and finish reason.
+	MetricAgentRuns = "agens.agent.runs"
+
+	// MetricAgentErrors counts the agent runs that failed, by agent and source.
+	MetricAgentErrors = "agens.agent.errors"
+
+	// MetricAgentRunDuration records the duration of the agent runs, in seconds.
+	MetricAgentRunDuration = "agens.agent.run.duration"
+
+	// MetricAgentStepDuration records the duration of each flow step, in seconds.
+	MetricAgentStepDuration = "agens.agent.step.duration"
+
+	// MetricAgentBatchSize records the number of incoming messages of each turn.
+	MetricAgentBatchSize = "agens.agent.batch.size"
+
+	// MetricAgentHistoryLength records the number of history messages sent to the model.
+	MetricAgentHistoryLength = "agens.agent.history.length"
+
+	// MetricTriggerMessages counts the messages handled by the triggers, by
+	// trigger, agent and finish reason.
+	MetricTriggerMessages = "agens.trigger.messages"
+
+	// MetricTriggerErrors counts the messages whose handling failed, by trigger and agent.
+	MetricTriggerErrors = "agens.trigger.errors"
+
+	// MetricTriggerDuration records the time the triggers took to handle a message, in seconds.
+	MetricTriggerDuration = "agens.trigger.duration"
+)
+
+// Metric attribute keys.
+const (
+	AttrAgentName    = attribute.Key("agens.agent.name")
+	AttrSource       = attribute.Key("agens.source")
+	AttrFinishReason = attribute.Key("agens.finish_reason")
+	AttrStep         = attribute.Key("agens.step")
+	AttrTrigger      = attribute.Key("agens.trigger")
+)
+
+// FinishReasonError is the finish reason attribute of the runs that failed.
+const FinishReasonError = "error"
+
+func meter(mp metric.MeterProvider) metric.Meter {
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	return mp.Meter(MeterName)
+}
+
+func finishReason(resp *ai.ModelResponse, err error) string {
+	if err != nil {
+		return FinishReasonError
+	}
+	if (resp == nil) || (resp.FinishReason == "") {
+		return string(ai.FinishReasonUnknown)
+	}
+	return string(resp.FinishReason)
+}
+
+// agentMetrics holds the instruments recorded by the agent flow.
+type agentMetrics struct {
+	runs          metric.Int64Counter
+	errors        metric.Int64Counter
+	runDuration   metric.Float64Histogram
+	stepDuration  metric.Float64Histogram
+	batchSize     metric.Int64Histogram
+	historyLength metric.Int64Histogram
+}
+
+func newAgentMetrics(mp metric.MeterProvider) (*agentMetrics, error) {
+	var (
+		m    = meter(mp)
+		am   = &agentMetrics{}
+		errs = make([]error, 6)
+	)
+
+	am.runs, errs[0] = m.Int64Counter(MetricAgentRuns,
+		metric.WithDescription("Number of agent runs."),
+		metric.WithUnit("{run}"),
+	)
+	am.errors, errs[1] = m.Int64Counter(MetricAgentErrors,
+		metric.WithDescription("Number of agent runs that failed."),
+		metric.WithUnit("{run}"),
+	)
+	am.runDuration, errs[2] = m.Float64Histogram(MetricAgentRunDuration,
+		metric.WithDescription("Duration of the agent runs."),
+		metric.WithUnit("s"),
+	)
+	am.stepDuration, errs[3] = m.Float64Histogram(MetricAgentStepDuration,
+		metric.WithDescription("Duration of the agent flow steps."),
+		metric.WithUnit("s"),
+	)
+	am.batchSize, errs[4] = m.Int64Histogram(MetricAgentBatchSize,
+		metric.WithDescription("Number of incoming messages answered in a turn."),
+		metric.WithUnit("{message}"),
+	)
+	am.historyLength, errs[5] = m.Int64Histogram(MetricAgentHistoryLength,
+		metric.WithDescription("Number of history messages sent to the model."),
+		metric.WithUnit("{message}"),
+	)
+
+	return am, errors.Join(errs...)
+}
+
+func agentAttributes(agentName string, msg *ai.Message) []attribute.KeyValue {
+	source, _ := GetSource(msg)
+	return []attribute.KeyValue{AttrAgentName.String(agentName), AttrSource.String(source)}
+}
+
+func (am *agentMetrics) recordRun(ctx context.Context, agentName string, msg *ai.Message, resp *ai.ModelResponse, err error, duration time.Duration) {
+	attrs := agentAttributes(agentName, msg)
+
+	am.runs.Add(ctx, 1, metric.WithAttributes(append(attrs, AttrFinishReason.String(finishReason(resp, err)))...))
+	am.runDuration.Record(ctx, duration.Seconds(), metric.WithAttributes(attrs...))
+	if err != nil {
+		am.errors.Add(ctx, 1, metric.WithAttributes(attrs...))
+	}
+}
+
+func (am *agentMetrics) recordStep(ctx context.Context, state *FlowState, step string, duration time.Duration) {
+	attrs := append(agentAttributes(state.AgentName, state.Message), AttrStep.String(step))
+	am.stepDuration.Record(ctx, duration.Seconds(), metric.WithAttributes(attrs...))
+}
+
+func (am *agentMetrics) recordBatch(ctx context.Context, state *FlowState) {
+	am.batchSize.Record(ctx, int64(len(state.Batch)), metric.WithAttributes(agentAttributes(state.AgentName, state.Message)...))
+}
+
+func (am *agentMetrics) recordHistory(ctx context.Context, state *FlowState) {
+	am.historyLength.Record(ctx, int64(len(state.History)), metric.WithAttributes(agentAttributes(state.AgentName, state.Message)...))
+}
+
+// TriggerMetrics holds the instruments recorded by the triggers while they
+// handle the incoming messages. A nil *TriggerMetrics records nothing.
+type TriggerMetrics struct {
+	trigger string
+
+	messages metric.Int64Counter
+	errors   metric.Int64Counter
+	duration metric.Float64Histogram
+}
+
+// NewTriggerMetrics creates the instruments of the trigger with the given name.
+// If mp is nil, the global MeterProvider is used. The returned metrics are
+// usable even if an instrument could not be created.
+func NewTriggerMetrics(mp metric.MeterProvider, trigger string) (*TriggerMetrics, error) {
+	var (
+		m    = meter(mp)
+		tm   = &TriggerMetrics{trigger: trigger}
+		errs = make([]error, 3)
+	)
+
+	tm.messages, errs[0] = m.Int64Counter(MetricTriggerMessages,
+		metric.WithDescription("Number of messages handled by the triggers."),
+		metric.WithUnit("{message}"),
+	)
+	tm.errors, errs[1] = m.Int64Counter(MetricTriggerErrors,
+		metric.WithDescription("Number of messages whose handling failed."),
+		metric.WithUnit("{message}"),
+	)
+	tm.duration, errs[2] = m.Float64Histogram(MetricTriggerDuration,
+		metric.WithDescription("Time taken to handle a message, including the agent run and the reply."),
+		metric.WithUnit("s"),
+	)
+
+	return tm, errors.Join(errs...)
+}
+
+// Record records a message handled by the trigger for the agent, with the
+// response of the agent run and the error of the whole handling.
+func (tm *TriggerMetrics) Record(ctx context.Context, agentName string, resp *ai.ModelResponse, err error, duration time.Duration) {
+	if tm == nil {
+		return
+	}
+
+	attrs := []attribute.KeyValue{AttrTrigger.String(tm.trigger), AttrAgentName.String(agentName)}
+
+	tm.messages.Add(ctx, 1, metric.WithAttributes(append(attrs, AttrFinishReason.String(finishReason(resp, err)))...))
+	tm.duration.Record(ctx, duration.Seconds(), metric.WithAttributes(attrs...))
+	if err != nil {
+		tm.errors.Add(ctx, 1, metric.WithAttributes(attrs...))
+	}
+}
@@ -0,0 +1,161 @@
+package agens_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/gonzxlezs/agens"
+	"github.com/gonzxlezs/agens/agenstest"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func newMeterProvider() (*sdkmetric.MeterProvider, *sdkmetric.ManualReader) {
+	reader := sdkmetric.NewManualReader()
+	return sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)), reader
+}
+
+// collect returns the metrics collected by the reader, by name.
+func collect(t *testing.T, reader *sdkmetric.ManualReader) map[string]metricdata.Aggregation {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := make(map[string]metricdata.Aggregation)
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+	return metrics
+}
+
+// counts returns the values of an int64 counter by the given attribute.
+func counts(t *testing.T, data metricdata.Aggregation, key attribute.Key) map[string]int64 {
+	t.Helper()
+
+	sum, ok := data.(metricdata.Sum[int64])
+	if !ok {
+		t.Fatalf("metric data is %T, want an int64 sum", data)
+	}
+
+	values := make(map[string]int64)
+	for _, dp := range sum.DataPoints {
+		v, _ := dp.Attributes.Value(key)
+		values[v.AsString()] += dp.Value
+	}
+	return values
+}
+
+// histogram returns the number and the sum of the values of an int64 histogram.
+func histogram(t *testing.T, data metricdata.Aggregation) (uint64, int64) {
+	t.Helper()
+
+	h, ok := data.(metricdata.Histogram[int64])
+	if !ok {
+		t.Fatalf("metric data is %T, want an int64 histogram", data)
+	}
+
+	var (
+		count uint64
+		sum   int64
+	)
+	for _, dp := range h.DataPoints {
+		count += dp.Count
+		sum += dp.Sum
+	}
+	return count, sum
+}
+
+func TestAgentMetrics(t *testing.T) {
+	mp, reader := newMeterProvider()
+
+	env := newTestEnv(t)
+	env.newAgent(t, agens.AgentConfig{MeterProvider: mp})
+	env.model.Reply("Hello").Fail(errors.New("unavailable"))
+
+	env.send(t, "Hi")
+	if _, err := env.trigger.SendText(context.Background(), testChannelID, testUserID, "Again"); err == nil {
+		t.Fatal("expected the second run to fail")
+	}
+
+	metrics := collect(t, reader)
+
+	runs, ok := metrics[agens.MetricAgentRuns].(metricdata.Sum[int64])
+	if !ok {
+		t.Fatalf("%s not recorded", agens.MetricAgentRuns)
+	}
+	want := map[string]bool{string(ai.FinishReasonStop): true, agens.FinishReasonError: true}
+	for _, dp := range runs.DataPoints {
+		agent, _ := dp.Attributes.Value(agens.AttrAgentName)
+		source, _ := dp.Attributes.Value(agens.AttrSource)
+		reason, _ := dp.Attributes.Value(agens.AttrFinishReason)
+
+		if agent.AsString() != "tester" || source.AsString() != agenstest.DefaultTriggerName {
+			t.Errorf("run attributes = %v", dp.Attributes.ToSlice())
+		}
+		if !want[reason.AsString()] || dp.Value != 1 {
+			t.Errorf("%d runs finished with %q", dp.Value, reason.AsString())
+		}
+		delete(want, reason.AsString())
+	}
+	if len(want) > 0 {
+		t.Errorf("no runs finished with %v", want)
+	}
+
+	if errs := counts(t, metrics[agens.MetricAgentErrors], agens.AttrAgentName); errs["tester"] != 1 {
+		t.Errorf("errors = %v, want 1 for tester", errs)
+	}
+
+	if count, sum := histogram(t, metrics[agens.MetricAgentBatchSize]); count != 2 || sum != 2 {
+		t.Errorf("batch size recorded %d times with sum %d, want 2 single message batches", count, sum)
+	}
+
+	// the second run gets the two messages of the first one
+	if count, sum := histogram(t, metrics[agens.MetricAgentHistoryLength]); count != 2 || sum != 2 {
+		t.Errorf("history length recorded %d times with sum %d, want 0 and 2", count, sum)
+	}
+
+	if _, ok := metrics[agens.MetricAgentStepDuration]; !ok {
+		t.Errorf("%s not recorded", agens.MetricAgentStepDuration)
+	}
+}
+
+func TestTriggerMetricsRecord(t *testing.T) {
+	mp, reader := newMeterProvider()
+
+	tm, err := agens.NewTriggerMetrics(mp, "webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	tm.Record(ctx, "tester", &ai.ModelResponse{FinishReason: ai.FinishReasonStop}, nil, time.Second)
+	tm.Record(ctx, "tester", nil, errors.New("send failed"), time.Second)
+
+	// a nil *TriggerMetrics records nothing
+	(*agens.TriggerMetrics)(nil).Record(ctx, "tester", nil, nil, time.Second)
+
+	metrics := collect(t, reader)
+
+	messages := counts(t, metrics[agens.MetricTriggerMessages], agens.AttrFinishReason)
+	if messages[string(ai.FinishReasonStop)] != 1 || messages[agens.FinishReasonError] != 1 {
+		t.Errorf("messages by finish reason = %v", messages)
+	}
+
+	if errs := counts(t, metrics[agens.MetricTriggerErrors], agens.AttrTrigger); errs["webhook"] != 1 {
+		t.Errorf("errors = %v, want 1 for webhook", errs)
+	}
+
+	duration, ok := metrics[agens.MetricTriggerDuration].(metricdata.Histogram[float64])
+	if !ok || len(duration.DataPoints) != 1 || duration.DataPoints[0].Count != 2 {
+		t.Errorf("duration = %+v, want 2 records", metrics[agens.MetricTriggerDuration])
+	}
+}
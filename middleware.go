@@ -0,0 +1,130 @@
+package agens
+
+import (
+	"context"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// FlowState holds the data of an agent run as it moves through the flow steps.
+// Middlewares can inspect and modify it; changes are visible to the following steps.
+type FlowState struct {
+	// AgentName is the name of the agent being run.
+	AgentName string
+
+	// Message is the incoming message that started the run.
+	Message *ai.Message
+
+	// ConversationID is the identifier of the conversation the run belongs to.
+	ConversationID string
+
+	// Batch contains the incoming messages that will be sent to the model.
+	// It is available after the MessageBatchStep.
+	Batch []*ai.Message
+
+	// History contains the previous messages of the conversation.
+	// It is available after the RetrieveHistoryStep.
+	History []*ai.Message
+
+	// Knowledge contains the documents injected as context before generation.
+	// It is available after the RetrieveKnowledgeStep (see KnowledgeMode).
+	Knowledge []*ai.Document
+
+	// GenerateOptions are extra options appended to the genkit.Generate call.
+	GenerateOptions []ai.GenerateOption
+
+	// Response is the model response. It is available after the GenerateStep,
+	// and its history is what the StoreHistoryStep persists.
+	Response *ai.ModelResponse
+
+	// Usage describes the tokens, tool calls and latency of the generation.
+	// It is available after the GenerateStep and is recorded by the RecordUsageStep.
+	Usage *UsageRecord
+}
+
+// Middleware defines hooks that run around the named steps of the agent flow
+// (MessageBatchStep, RateLimitStep, ConversationLockStep, HandoffStep,
+// InputGuardStep, RetrieveHistoryStep, RetrieveKnowledgeStep, GenerateStep,
+// RecordUsageStep, OutputGuardStep and StoreHistoryStep).
+//
+// Before hooks run in the order in which the middlewares are configured and
+// After hooks run in reverse order. A hook that returns a non-nil response
+// short-circuits the flow: the response is returned as is and the remaining
+// steps (including storing the history) are skipped. A hook that returns an
+// error aborts the run.
+type Middleware interface {
+	// Before is invoked before the named step runs.
+	Before(ctx context.Context, step string, state *FlowState) (*ai.ModelResponse, error)
+
+	// After is invoked after the named step has run.
+	After(ctx context.Context, step string, state *FlowState) (*ai.ModelResponse, error)
+}
+
+// StepHook is a function invoked around a flow step. See Middleware.
+type StepHook func(ctx context.Context, state *FlowState) (*ai.ModelResponse, error)
+
+// StepHooks is a Middleware built from per-step hooks, keyed by step name.
+type StepHooks struct {
+	// BeforeStep contains the hooks invoked before each named step.
+	BeforeStep map[string]StepHook
+
+	// AfterStep contains the hooks invoked after each named step.
+	AfterStep map[string]StepHook
+}
+
+var _ Middleware = StepHooks{}
+
+// Before invokes the hook registered for the step in BeforeStep, if any.
+func (h StepHooks) Before(ctx context.Context, step string, state *FlowState) (*ai.ModelResponse, error) {
+	if hook, ok := h.BeforeStep[step]; ok && hook != nil {
+		return hook(ctx, state)
+	}
+	return nil, nil
+}
+
+// After invokes the hook registered for the step in AfterStep, if any.
+func (h StepHooks) After(ctx context.Context, step string, state *FlowState) (*ai.ModelResponse, error) {
+	if hook, ok := h.AfterStep[step]; ok && hook != nil {
+		return hook(ctx, state)
+	}
+	return nil, nil
+}
+
+func runStep(ctx context.Context, middlewares []Middleware, step string, state *FlowState, fn func() error) (*ai.ModelResponse, error) {
+	if resp, err := beforeStep(ctx, middlewares, step, state); (resp != nil) || (err != nil) {
+		return resp, err
+	}
+
+	if err := fn(); err != nil {
+		return nil, err
+	}
+
+	return afterStep(ctx, middlewares, step, state)
+}
+
+func beforeStep(ctx context.Context, middlewares []Middleware, step string, state *FlowState) (*ai.ModelResponse, error) {
+	for _, mw := range middlewares {
+		resp, err := mw.Before(ctx, step, state)
+		if (resp != nil) || (err != nil) {
+			return resp, err
+		}
+	}
+	return nil, nil
+}
+
+func afterStep(ctx context.Context, middlewares []Middleware, step string, state *FlowState) (*ai.ModelResponse, error) {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		resp, err := middlewares[i].After(ctx, step, state)
+		if (resp != nil) || (err != nil) {
+			return resp, err
+		}
+	}
+	return nil, nil
+}
+
+func shortCircuit(resp *ai.ModelResponse, err error) (*ai.ModelResponse, error) {
+	if err != nil {
+		return EmptyModelResponse(), err
+	}
+	return resp, nil
+}
@@ -0,0 +1,125 @@
+package agens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// ErrInvalidPromptVars is returned when a value associated with the prompt vars key exists in the context,
+// but it is not of the expected type (map[string]any).
+var ErrInvalidPromptVars = errors.New("prompt vars in context are invalid")
+
+// PromptVarsKey is used as a context key to store and retrieve the variables
+// available to the system prompt template within a context.Context.
+type PromptVarsKey struct{}
+
+// WithPromptVars returns a new context.Context derived from the provided ctx,
+// with the specified variables attached to it. They are merged with the
+// variables already present in ctx, the new ones taking precedence.
+func WithPromptVars(ctx context.Context, vars map[string]any) context.Context {
+	merged := make(map[string]any)
+	if current, err := GetPromptVars(ctx); err == nil {
+		for k, v := range current {
+			merged[k] = v
+		}
+	}
+
+	for k, v := range vars {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, PromptVarsKey{}, merged)
+}
+
+// GetPromptVars retrieves the prompt variables from the provided context.
+// It returns (nil, nil) if no variables are found. If the value stored in the context
+// is not of type map[string]any, it returns nil and ErrInvalidPromptVars.
+func GetPromptVars(ctx context.Context) (map[string]any, error) {
+	v := ctx.Value(PromptVarsKey{})
+	if v == nil {
+		return nil, nil
+	}
+
+	vars, ok := v.(map[string]any)
+	if ok {
+		return vars, nil
+	}
+	return nil, ErrInvalidPromptVars
+}
+
+// SystemPromptData is the data the SystemPromptTemplate is executed with.
+type SystemPromptData struct {
+	// Name, Description and Instructions are copied from the AgentConfig.
+	Name         string
+	Description  string
+	Instructions []string
+
+	// ConversationID is the identifier of the conversation being run.
+	ConversationID string
+
+	// Source, ChannelID and UserID are read from the metadata of the incoming
+	// message. They are empty when missing.
+	Source    string
+	ChannelID string
+	UserID    string
+
+	// Metadata is the metadata of the incoming message.
+	Metadata map[string]any
+
+	// Now is the time at which the prompt is rendered.
+	Now time.Time
+
+	// Vars are the variables attached to the context with WithPromptVars.
+	Vars map[string]any
+}
+
+// systemPromptFuncs are the functions available to the SystemPromptTemplate
+// besides the text/template builtins.
+var systemPromptFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+func parseSystemPromptTemplate(cfg *AgentConfig) (*template.Template, error) {
+	if cfg.SystemPromptTemplate == "" {
+		return nil, nil
+	}
+
+	tmpl, err := template.New(cfg.Name).Funcs(systemPromptFuncs).Parse(cfg.SystemPromptTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid system prompt template: %w", err)
+	}
+	return tmpl, nil
+}
+
+func renderSystemPrompt(ctx context.Context, tmpl *template.Template, cfg *AgentConfig, conversationID string, msg *ai.Message) (string, error) {
+	vars, err := GetPromptVars(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	data := SystemPromptData{
+		Name:           cfg.Name,
+		Description:    cfg.Description,
+		Instructions:   cfg.Instructions,
+		ConversationID: conversationID,
+		Metadata:       msg.Metadata,
+		Now:            time.Now(),
+		Vars:           vars,
+	}
+
+	// missing metadata is not an error for the prompt
+	data.Source, _ = GetSource(msg)
+	data.ChannelID, _ = GetChannelID(msg)
+	data.UserID, _ = GetUserID(msg)
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("error rendering system prompt: %w", err)
+	}
+	return b.String(), nil
+}
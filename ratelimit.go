@@ -0,0 +1,191 @@
+package agens
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+const RateLimitStep = "rateLimit"
+
+const (
+	// DefaultRateLimitReply is the reply returned to rate limited runs when no reply is configured.
+	DefaultRateLimitReply = "You're sending messages too fast. Please slow down and try again in a moment."
+
+	// RateLimitedMessage is the finish message of the responses returned to rate limited runs.
+	RateLimitedMessage = "rate limited"
+)
+
+// RateLimitMode selects what happens to a run that exceeds its rate limit.
+type RateLimitMode int
+
+const (
+	// RateLimitReject answers the run with the slow down reply.
+	RateLimitReject RateLimitMode = iota
+
+	// RateLimitDelay waits for the next token before running, up to
+	// RateLimitConfig.MaxDelay. Runs that would wait longer are rejected.
+	RateLimitDelay
+)
+
+// RateLimit describes a token bucket: it holds up to Burst tokens and gets a
+// new one every Every. Each run takes a token. The zero value disables the limit.
+type RateLimit struct {
+	// Every is the time it takes to refill one token.
+	Every time.Duration
+
+	// Burst is the capacity of the bucket. Values lower than 1 mean 1.
+	Burst int
+}
+
+// Enabled reports whether the limit applies.
+func (limit RateLimit) Enabled() bool {
+	return limit.Every > 0
+}
+
+func (limit RateLimit) burst() float64 {
+	return float64(max(limit.Burst, 1))
+}
+
+// Take applies the token bucket algorithm to a bucket that had the given tokens
+// elapsed ago (a new bucket should start with Burst tokens). If a token is
+// available it is taken. Otherwise, the next token is reserved only if it is
+// due within maxDelay. It returns the tokens left in the bucket, the time to
+// wait before running and whether the run is allowed.
+func (limit RateLimit) Take(tokens float64, elapsed time.Duration, maxDelay time.Duration) (float64, time.Duration, bool) {
+	tokens = min(limit.burst(), tokens+float64(elapsed)/float64(limit.Every))
+
+	if tokens >= 1 {
+		return tokens - 1, 0, true
+	}
+
+	delay := time.Duration((1 - tokens) * float64(limit.Every))
+	if delay <= maxDelay {
+		return tokens - 1, delay, true
+	}
+	return tokens, delay, false
+}
+
+// Refund returns a token taken by Take to a bucket that has the given tokens.
+func (limit RateLimit) Refund(tokens float64) float64 {
+	return min(limit.burst(), tokens+1)
+}
+
+// RateLimiter keeps the token buckets of the rate limits.
+type RateLimiter interface {
+	// Reserve takes a token from the bucket identified by key (see RateLimit.Take).
+	// It returns the time to wait before running and whether the run is allowed.
+	Reserve(ctx context.Context, key string, limit RateLimit, maxDelay time.Duration) (time.Duration, bool, error)
+
+	// Refund returns a token taken by an allowed Reserve (see RateLimit.Refund),
+	// e.g. when another bucket of the run rejects it.
+	Refund(ctx context.Context, key string, limit RateLimit) error
+}
+
+// RateLimitConfig configures the rate limits of an agent.
+type RateLimitConfig struct {
+	// Limiter keeps the token buckets.
+	Limiter RateLimiter
+
+	// PerUser is the limit applied to each user ID (see GetUserID).
+	// Runs whose message has no user ID are not limited per user.
+	PerUser RateLimit
+
+	// PerConversation is the limit applied to each conversation ID.
+	PerConversation RateLimit
+
+	// Mode selects whether limited runs are rejected or delayed.
+	Mode RateLimitMode
+
+	// MaxDelay is the longest a run is delayed in RateLimitDelay mode.
+	MaxDelay time.Duration
+
+	// Reply is the slow down reply. Defaults to DefaultRateLimitReply.
+	Reply string
+}
+
+func (cfg *RateLimitConfig) maxDelay() time.Duration {
+	if cfg.Mode == RateLimitDelay {
+		return cfg.MaxDelay
+	}
+	return 0
+}
+
+// rateLimitStep reserves a token from every enabled bucket of the run and
+// waits for the longest delay. It returns false if any bucket rejects the run,
+// refunding the tokens taken from the others.
+func rateLimitStep(ctx context.Context, cfg *RateLimitConfig, agentName string, conversationID string, msg *ai.Message) (bool, error) {
+	if (cfg == nil) || (cfg.Limiter == nil) {
+		return true, nil
+	}
+
+	type bucket struct {
+		key   string
+		limit RateLimit
+	}
+
+	var buckets []bucket
+	if userID, _ := GetUserID(msg); (userID != "") && cfg.PerUser.Enabled() {
+		buckets = append(buckets, bucket{fmt.Sprintf("%s:user:%s", agentName, userID), cfg.PerUser})
+	}
+	if cfg.PerConversation.Enabled() {
+		buckets = append(buckets, bucket{fmt.Sprintf("%s:conversation:%s", agentName, conversationID), cfg.PerConversation})
+	}
+
+	if len(buckets) == 0 {
+		return true, nil
+	}
+
+	delay, err := genkit.Run(ctx, RateLimitStep, func() (time.Duration, error) {
+		var longest time.Duration
+		for i, b := range buckets {
+			delay, ok, err := cfg.Limiter.Reserve(ctx, b.key, b.limit, cfg.maxDelay())
+			if (err == nil) && ok {
+				longest = max(longest, delay)
+				continue
+			}
+
+			for _, reserved := range buckets[:i] {
+				if err := cfg.Limiter.Refund(ctx, reserved.key, reserved.limit); err != nil {
+					return 0, err
+				}
+			}
+			if err != nil {
+				return 0, err
+			}
+			return -1, nil
+		}
+		return longest, nil
+	})
+	if (err != nil) || (delay < 0) {
+		return false, err
+	}
+
+	if delay > 0 {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+	return true, nil
+}
+
+// rateLimitedModelResponse builds the response of a rejected run. Nothing of
+// it is stored in the history.
+func rateLimitedModelResponse(cfg *RateLimitConfig) *ai.ModelResponse {
+	reply := cfg.Reply
+	if reply == "" {
+		reply = DefaultRateLimitReply
+	}
+
+	return &ai.ModelResponse{
+		FinishReason:  ai.FinishReasonBlocked,
+		FinishMessage: RateLimitedMessage,
+		Message:       ai.NewModelTextMessage(reply),
+		Request:       &ai.ModelRequest{},
+	}
+}
@@ -0,0 +1,82 @@
+package agens_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/gonzxlezs/agens"
+	"github.com/gonzxlezs/agens/extensions/memratelimit"
+)
+
+func TestRateLimitRefundsRejectedRuns(t *testing.T) {
+	env := newTestEnv(t)
+	env.newAgent(t, agens.AgentConfig{
+		RateLimit: &agens.RateLimitConfig{
+			Limiter:         &memratelimit.RateLimiter{},
+			PerUser:         agens.RateLimit{Every: time.Hour},
+			PerConversation: agens.RateLimit{Every: time.Hour},
+		},
+	})
+	env.model.Reply("first").Reply("second")
+
+	send := func(channelID string, userID string) *ai.ModelResponse {
+		t.Helper()
+
+		resp, err := env.trigger.SendText(context.Background(), channelID, userID, "Hi")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := send("one", "alice"); resp.Text() != "first" {
+		t.Fatalf("first run = %q, want it allowed", resp.Text())
+	}
+
+	// bob's user bucket allows the run, but the conversation rejects it
+	if resp := send("one", "bob"); resp.FinishMessage != agens.RateLimitedMessage {
+		t.Fatalf("run in a limited conversation = %q, want it rate limited", resp.Text())
+	}
+
+	// so the token of bob is refunded for another conversation
+	if resp := send("two", "bob"); resp.Text() != "second" {
+		t.Errorf("run in another conversation = %q (%s), want it allowed", resp.Text(), resp.FinishMessage)
+	}
+}
+
+func TestRateLimitRunsBeforeConversationLock(t *testing.T) {
+	var steps []string
+	record := func(name string) agens.StepHook {
+		return func(context.Context, *agens.FlowState) (*ai.ModelResponse, error) {
+			steps = append(steps, name)
+			return nil, nil
+		}
+	}
+
+	env := newTestEnv(t)
+	env.newAgent(t, agens.AgentConfig{
+		RateLimit: &agens.RateLimitConfig{
+			Limiter: &memratelimit.RateLimiter{},
+			PerUser: agens.RateLimit{Every: time.Hour},
+		},
+		Middlewares: []agens.Middleware{
+			agens.StepHooks{
+				BeforeStep: map[string]agens.StepHook{
+					agens.RateLimitStep:        record(agens.RateLimitStep),
+					agens.ConversationLockStep: record(agens.ConversationLockStep),
+				},
+			},
+		},
+	})
+	env.model.Reply("Hello!")
+
+	env.send(t, "Hi")
+
+	// a delayed run waits without holding the conversation lock
+	want := []string{agens.RateLimitStep, agens.ConversationLockStep}
+	if (len(steps) != len(want)) || (steps[0] != want[0]) || (steps[1] != want[1]) {
+		t.Errorf("steps = %v, want %v", steps, want)
+	}
+}
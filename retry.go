@@ -0,0 +1,176 @@
+package agens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/core"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+const (
+	// DefaultRetryBackoff is the delay before the first retry when RetryPolicy.Backoff is not set.
+	DefaultRetryBackoff = 500 * time.Millisecond
+
+	// DefaultRetryMultiplier is the backoff growth factor when RetryPolicy.Multiplier is not set.
+	DefaultRetryMultiplier = 2
+)
+
+// nonRetryableStatuses are the Genkit error statuses that are not worth retrying
+// with the same model, since the request itself is wrong.
+var nonRetryableStatuses = []core.StatusName{
+	core.INVALID_ARGUMENT,
+	core.NOT_FOUND,
+	core.ALREADY_EXISTS,
+	core.PERMISSION_DENIED,
+	core.UNAUTHENTICATED,
+	core.FAILED_PRECONDITION,
+	core.OUT_OF_RANGE,
+	core.UNIMPLEMENTED,
+}
+
+// RetryPolicy controls how failed generations are retried before falling
+// through to the next model of the fallback chain.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts per model, including the
+	// first one. Values lower than 1 mean a single attempt.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry. Defaults to DefaultRetryBackoff.
+	Backoff time.Duration
+
+	// MaxBackoff caps the delay between retries. Zero means no cap.
+	MaxBackoff time.Duration
+
+	// Multiplier is the factor applied to the delay after each retry.
+	// Defaults to DefaultRetryMultiplier.
+	Multiplier float64
+
+	// Retryable reports whether an error should be retried with the same model.
+	// If nil, DefaultRetryable is used.
+	Retryable func(error) bool
+}
+
+// DefaultRetryable reports whether err is a transient failure. Context
+// cancellations and Genkit errors caused by the request itself (invalid
+// argument, not found, permission denied, etc.) are not retryable; any other
+// error is.
+func DefaultRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var gErr *core.GenkitError
+	if errors.As(err, &gErr) {
+		return !slices.Contains(nonRetryableStatuses, gErr.Status)
+	}
+	return true
+}
+
+func (p *RetryPolicy) attempts() int {
+	if (p == nil) || (p.MaxAttempts < 1) {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return DefaultRetryable(err)
+}
+
+func (p *RetryPolicy) delay(retry int) time.Duration {
+	var (
+		delay      = p.Backoff
+		multiplier = p.Multiplier
+	)
+
+	if delay <= 0 {
+		delay = DefaultRetryBackoff
+	}
+	if multiplier <= 0 {
+		multiplier = DefaultRetryMultiplier
+	}
+
+	for range retry {
+		delay = time.Duration(float64(delay) * multiplier)
+		if (p.MaxBackoff > 0) && (delay >= p.MaxBackoff) {
+			return p.MaxBackoff
+		}
+	}
+	return delay
+}
+
+type modelChoice struct {
+	name string
+	opt  ai.GenerateOption
+}
+
+// resolveModels returns the primary model followed by the fallback models.
+func resolveModels(cfg *AgentConfig) []modelChoice {
+	models := make([]modelChoice, 0, len(cfg.FallbackModels)+1)
+
+	if cfg.Model != nil {
+		models = append(models, modelChoice{name: cfg.Model.Name(), opt: ai.WithModel(cfg.Model)})
+	} else if cfg.ModelName != "" {
+		models = append(models, modelChoice{name: cfg.ModelName, opt: ai.WithModelName(cfg.ModelName)})
+	}
+
+	for _, model := range cfg.FallbackModels {
+		models = append(models, modelChoice{name: model.Name(), opt: ai.WithModel(model)})
+	}
+	return models
+}
+
+// generateWithFallback calls genkit.Generate with each model in order, retrying
+// each one according to the policy, until one of them succeeds. The name of the
+// model that answered is recorded in the response message metadata (ModelNameKey).
+func generateWithFallback(ctx context.Context, g *genkit.Genkit, policy *RetryPolicy, models []modelChoice, opts []ai.GenerateOption) (*ai.ModelResponse, error) {
+	if len(models) == 0 {
+		return generateWithRetry(ctx, g, policy, opts)
+	}
+
+	var errs []error
+	for _, model := range models {
+		resp, err := generateWithRetry(ctx, g, policy, append(slices.Clip(opts), model.opt))
+		if err == nil {
+			if resp.Message != nil {
+				SetModelName(resp.Message, model.name)
+			}
+			return resp, nil
+		}
+
+		errs = append(errs, fmt.Errorf("model %s: %w", model.name, err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+func generateWithRetry(ctx context.Context, g *genkit.Genkit, policy *RetryPolicy, opts []ai.GenerateOption) (*ai.ModelResponse, error) {
+	attempts := policy.attempts()
+
+	for attempt := 0; ; attempt++ {
+		resp, err := genkit.Generate(ctx, g, opts...)
+		if err == nil {
+			return resp, nil
+		}
+
+		if (attempt+1 >= attempts) || !policy.retryable(err) {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Join(err, ctx.Err())
+		case <-time.After(policy.delay(attempt)):
+		}
+	}
+}
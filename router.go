@@ -0,0 +1,340 @@
+package agens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/core"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+const RouteStep = "route"
+
+// DefaultClassifierInstructions are the instructions given to the model used by
+// ClassifierPolicy when no custom instructions are provided.
+const DefaultClassifierInstructions = `You are a message router.
+Choose the agent best suited to handle the user's message.
+Answer only with the name of one of the following agents:
+%s`
+
+var (
+	// ErrRouterWithoutRunners is returned when a Router is created without child runners.
+	ErrRouterWithoutRunners = errors.New("router has no runners")
+
+	// ErrDuplicateRunnerName is returned when two child runners of a Router share the same name.
+	ErrDuplicateRunnerName = errors.New("router runner names must be unique")
+
+	// ErrNilRunner is returned when a child runner of a Router is nil.
+	ErrNilRunner = errors.New("router runner is nil")
+
+	// ErrClassifierWithoutGenkit is returned when a ClassifierPolicy has no Genkit instance.
+	ErrClassifierWithoutGenkit = errors.New("classifier policy has no Genkit instance")
+
+	// ErrRouterNotInitialized is returned if an attempt is made to run a router
+	// that has not been properly initialized.
+	ErrRouterNotInitialized = errors.New("router not initialized")
+)
+
+var _ StreamRunner = &Router{}
+
+// RoutingPolicy decides which child runners of a Router should attempt to
+// handle a message.
+type RoutingPolicy interface {
+	// Route returns the runners that should attempt to handle msg, in the order
+	// in which they should be tried. Returning an empty slice delegates the message.
+	Route(ctx context.Context, msg *ai.Message, runners []Runner) ([]Runner, error)
+}
+
+// RouterConfig contains the configuration of a Router.
+type RouterConfig struct {
+	// Name is the name of the router, used to identify its flow in Genkit.
+	Name string
+
+	// Description is a brief description of the router's purpose.
+	Description string
+
+	// Runners is the ordered set of child runners (usually agents) the router forwards messages to.
+	// Child agents should not use a Batcher, since a batched message is reported
+	// as delegated and would be forwarded to the next runner.
+	Runners []Runner
+
+	// Policy decides which runners handle each message.
+	// If nil, FallbackPolicy is used.
+	Policy RoutingPolicy
+}
+
+// Router is a Runner that fronts several child runners. It asks its routing
+// policy for the candidate runners and forwards the message to each of them in
+// order until one of them does not delegate it (FinishReasonDelegated with
+// DelegationMessage).
+type Router struct {
+	config  *RouterConfig
+	runners map[string]Runner
+
+	flow *core.Flow[*ai.Message, *ai.ModelResponse, *ai.ModelResponseChunk]
+}
+
+// NewRouter initializes a new Router instance. It defines a Genkit flow based on the provided RouterConfig.
+func NewRouter(g *genkit.Genkit, cfg RouterConfig) (*Router, error) {
+	if len(cfg.Runners) == 0 {
+		return nil, ErrRouterWithoutRunners
+	}
+
+	switch p := cfg.Policy.(type) {
+	case nil:
+		cfg.Policy = FallbackPolicy{}
+	case ClassifierPolicy:
+		if p.Genkit == nil {
+			return nil, ErrClassifierWithoutGenkit
+		}
+	case *ClassifierPolicy:
+		if (p == nil) || (p.Genkit == nil) {
+			return nil, ErrClassifierWithoutGenkit
+		}
+	}
+
+	router := &Router{
+		config:  &cfg,
+		runners: make(map[string]Runner, len(cfg.Runners)),
+	}
+
+	for i, runner := range cfg.Runners {
+		if isNilRunner(runner) {
+			return nil, fmt.Errorf("%w: runner %d", ErrNilRunner, i)
+		}
+		if _, ok := router.runners[runner.Name()]; ok {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateRunnerName, runner.Name())
+		}
+		router.runners[runner.Name()] = runner
+	}
+
+	router.flow = genkit.DefineStreamingFlow(g, cfg.Name, router.routerFlow())
+
+	return router, nil
+}
+
+// isNilRunner reports whether runner is nil, including a nil pointer (e.g. a
+// nil *Agent), which would panic when run.
+func isNilRunner(runner Runner) bool {
+	if runner == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(runner)
+	return (v.Kind() == reflect.Pointer) && v.IsNil()
+}
+
+// Name returns the identifier of the router defined in its configuration.
+// If the router or its configuration is nil, it returns an empty string.
+func (router *Router) Name() string {
+	if router == nil || router.config == nil {
+		return ""
+	}
+	return router.config.Name
+}
+
+// Description returns the description of the router defined in its configuration.
+// If the router or its configuration is nil, it returns an empty string.
+func (router *Router) Description() string {
+	if router == nil || router.config == nil {
+		return ""
+	}
+	return router.config.Description
+}
+
+// Run executes the router's internal flow with a given message within the provided context.
+// It returns the response of the first runner that handles the message, or a
+// delegated response if every candidate runner delegated it.
+func (router *Router) Run(ctx context.Context, msg *ai.Message) (*ai.ModelResponse, error) {
+	if router.flow == nil {
+		return EmptyModelResponse(), ErrRouterNotInitialized
+	}
+	return router.flow.Run(ctx, msg)
+}
+
+// RunStream executes the router's internal flow like Run, streaming the response
+// of the child runners that support it (StreamRunner).
+func (router *Router) RunStream(ctx context.Context, msg *ai.Message, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+	if router.flow == nil {
+		return EmptyModelResponse(), ErrRouterNotInitialized
+	}
+	return runFlowStream(ctx, router.flow, msg, cb)
+}
+
+func (router *Router) routerFlow() core.StreamingFunc[*ai.Message, *ai.ModelResponse, *ai.ModelResponseChunk] {
+	return func(ctx context.Context, msg *ai.Message, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+		streaming := isStreaming(ctx)
+		ctx = withStreaming(ctx, false)
+
+		// route
+		names, err := genkit.Run(ctx, RouteStep, func() ([]string, error) {
+			runners, err := router.config.Policy.Route(ctx, msg, router.config.Runners)
+			if err != nil {
+				return nil, err
+			}
+
+			names := make([]string, 0, len(runners))
+			for _, runner := range runners {
+				names = append(names, runner.Name())
+			}
+			return names, nil
+		})
+		if err != nil {
+			return EmptyModelResponse(), err
+		}
+
+		// forward
+		for _, name := range names {
+			runner, ok := router.runners[name]
+			if !ok {
+				continue
+			}
+
+			var resp *ai.ModelResponse
+			if sr, ok := runner.(StreamRunner); ok && streaming {
+				resp, err = sr.RunStream(ctx, msg, cb)
+			} else {
+				resp, err = runner.Run(ctx, msg)
+			}
+			if err != nil {
+				return EmptyModelResponse(), err
+			}
+
+			// only plain delegations are forwarded: paused conversations belong to
+			// their runner's human operator and merged messages are already answered
+			if (resp.FinishReason != FinishReasonDelegated) || (resp.FinishMessage != DelegationMessage) {
+				return resp, nil
+			}
+		}
+
+		return DelegatedModelResponse(), nil
+	}
+}
+
+// FallbackPolicy is a RoutingPolicy that tries every runner in the order in
+// which they were configured.
+type FallbackPolicy struct{}
+
+// Route returns all the runners in their original order.
+func (FallbackPolicy) Route(_ context.Context, _ *ai.Message, runners []Runner) ([]Runner, error) {
+	return runners, nil
+}
+
+// MetadataPolicy is a RoutingPolicy that selects a runner based on the value
+// stored under a metadata key of the incoming message.
+type MetadataPolicy struct {
+	// Key is the metadata key whose value is used for routing (e.g. SourceKey).
+	Key string
+
+	// Routes maps metadata values to runner names.
+	Routes map[string]string
+
+	// Fallback indicates whether the remaining runners should be tried, in order,
+	// after the selected one (or when no route matches).
+	Fallback bool
+}
+
+// Route returns the runner mapped to the message metadata value, followed by
+// the remaining runners if Fallback is enabled.
+func (p MetadataPolicy) Route(_ context.Context, msg *ai.Message, runners []Runner) ([]Runner, error) {
+	v, _, _ := getMetadata(msg, p.Key)
+	value, _ := v.(string)
+	return selectRunner(runners, p.Routes[value], p.Fallback), nil
+}
+
+// RouteDecision is the structured output requested from the model used by ClassifierPolicy.
+type RouteDecision struct {
+	Agent string `json:"agent" jsonschema_description:"Name of the agent that must handle the message."`
+}
+
+// ClassifierPolicy is a RoutingPolicy that asks an LLM to choose the runner
+// best suited to handle the message, based on the runners' names and descriptions.
+type ClassifierPolicy struct {
+	// Genkit is the Genkit instance used to generate the routing decision. It is required.
+	Genkit *genkit.Genkit
+
+	// Model is the AI model used to classify messages.
+	// If specified, it takes precedence over ModelName.
+	Model ai.ModelArg
+
+	// ModelName is the name of the AI model used to classify messages.
+	// It is used only if Model is not defined (nil).
+	ModelName string
+
+	// Instructions is an optional format string for the classifier system message.
+	// It receives the list of available agents as its only argument.
+	// If empty, DefaultClassifierInstructions is used.
+	Instructions string
+
+	// Fallback indicates whether the remaining runners should be tried, in order,
+	// after the selected one (or when the model selects an unknown runner).
+	Fallback bool
+}
+
+// Route asks the model which runner should handle the message and returns it,
+// followed by the remaining runners if Fallback is enabled.
+func (p ClassifierPolicy) Route(ctx context.Context, msg *ai.Message, runners []Runner) ([]Runner, error) {
+	if p.Genkit == nil {
+		return nil, ErrClassifierWithoutGenkit
+	}
+
+	instructions := p.Instructions
+	if instructions == "" {
+		instructions = DefaultClassifierInstructions
+	}
+
+	var b strings.Builder
+	for _, runner := range runners {
+		fmt.Fprintf(&b, "- %s", runner.Name())
+		if d, ok := runner.(interface{ Description() string }); ok && d.Description() != "" {
+			fmt.Fprintf(&b, ": %s", d.Description())
+		}
+		b.WriteString("\n")
+	}
+
+	opts := []ai.GenerateOption{
+		ai.WithSystem(instructions, b.String()),
+		ai.WithMessages(msg),
+	}
+
+	if p.Model != nil {
+		opts = append(opts, ai.WithModel(p.Model))
+	} else if p.ModelName != "" {
+		opts = append(opts, ai.WithModelName(p.ModelName))
+	}
+
+	decision, _, err := genkit.GenerateData[RouteDecision](ctx, p.Genkit, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return selectRunner(runners, decision.Agent, p.Fallback), nil
+}
+
+func selectRunner(runners []Runner, name string, fallback bool) []Runner {
+	idx := slices.IndexFunc(runners, func(r Runner) bool {
+		return r.Name() == name
+	})
+
+	if idx < 0 {
+		if fallback {
+			return runners
+		}
+		return nil
+	}
+
+	if !fallback {
+		return []Runner{runners[idx]}
+	}
+
+	selected := make([]Runner, 0, len(runners))
+	selected = append(selected, runners[idx])
+	selected = append(selected, runners[:idx]...)
+	selected = append(selected, runners[idx+1:]...)
+	return selected
+}
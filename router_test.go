@@ -0,0 +1,45 @@
+package agens_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gonzxlezs/agens"
+)
+
+func TestNewRouterValidates(t *testing.T) {
+	env := newTestEnv(t)
+	agent := env.newAgent(t, agens.AgentConfig{})
+
+	var nilAgent *agens.Agent
+
+	tests := []struct {
+		name string
+		cfg  agens.RouterConfig
+		want error
+	}{
+		{"no runners", agens.RouterConfig{}, agens.ErrRouterWithoutRunners},
+		{"nil runner", agens.RouterConfig{Runners: []agens.Runner{agent, nil}}, agens.ErrNilRunner},
+		{"nil agent", agens.RouterConfig{Runners: []agens.Runner{nilAgent}}, agens.ErrNilRunner},
+		{"duplicate runner", agens.RouterConfig{Runners: []agens.Runner{agent, agent}}, agens.ErrDuplicateRunnerName},
+		{
+			"classifier without genkit",
+			agens.RouterConfig{Runners: []agens.Runner{agent}, Policy: agens.ClassifierPolicy{Model: env.model}},
+			agens.ErrClassifierWithoutGenkit,
+		},
+		{
+			"nil classifier",
+			agens.RouterConfig{Runners: []agens.Runner{agent}, Policy: (*agens.ClassifierPolicy)(nil)},
+			agens.ErrClassifierWithoutGenkit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Name = "router"
+			if _, err := agens.NewRouter(env.g, tt.cfg); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package agens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+const (
+	// StateGetToolNameFormat is the format used to name the tool that reads the conversation state.
+	StateGetToolNameFormat = "%s_get_state"
+
+	// StateSetToolNameFormat is the format used to name the tool that writes a conversation state value.
+	StateSetToolNameFormat = "%s_set_state"
+
+	// StateDeleteToolNameFormat is the format used to name the tool that deletes a conversation state value.
+	StateDeleteToolNameFormat = "%s_delete_state"
+)
+
+// Statuses returned by the state tools.
+const (
+	StatusStateSuccess = "success"
+
+	StatusStateNotFound = "not_found"
+)
+
+// ErrNoRunConversation is returned by the state tools when they are called
+// outside of an agent run, so the conversation cannot be determined.
+var ErrNoRunConversation = errors.New("no agent run conversation in context")
+
+// StateProvider defines an interface for providing state memory instances
+// tailored for specific agents.
+type StateProvider interface {
+	// ForAgent initializes or retrieves a StateMemory implementation for the specified agentName.
+	ForAgent(agentName string) (StateMemory, error)
+}
+
+// StateMemory is an interface for managing structured key/value facts
+// (order number, chosen plan, user name...) scoped to a conversation.
+type StateMemory interface {
+	// GetState returns all the key/value pairs stored for the conversation.
+	// It returns an empty map if nothing has been stored.
+	GetState(ctx context.Context, conversationID string) (map[string]any, error)
+
+	// SetState stores a value under the given key for the conversation,
+	// replacing any previous value.
+	SetState(ctx context.Context, conversationID string, key string, value any) error
+
+	// DeleteState removes the given key from the conversation state.
+	DeleteState(ctx context.Context, conversationID string, key string) error
+
+	// Close performs any necessary cleanup, such as closing database connections.
+	Close() error
+}
+
+type (
+	// StateGetInput is the input schema of the get state tool.
+	StateGetInput struct {
+		Key string `json:"key,omitempty" jsonschema_description:"The key to read. Leave empty to read every stored key."`
+	}
+
+	// StateGetOutput is the output schema of the get state tool.
+	StateGetOutput struct {
+		State  map[string]any `json:"state" jsonschema_description:"The stored key/value pairs."`
+		Status string         `json:"status" jsonschema:"enum=success,enum=not_found,description=The outcome of the operation."`
+	}
+
+	// StateSetInput is the input schema of the set state tool.
+	StateSetInput struct {
+		Key   string `json:"key" jsonschema_description:"The key under which the value is stored, e.g. 'order_number' or 'user_name'."`
+		Value string `json:"value" jsonschema_description:"The value to store."`
+	}
+
+	// StateDeleteInput is the input schema of the delete state tool.
+	StateDeleteInput struct {
+		Key string `json:"key" jsonschema_description:"The key to delete."`
+	}
+
+	// StateStatusOutput is the output schema of the set and delete state tools.
+	StateStatusOutput struct {
+		Status string `json:"status" jsonschema:"enum=success,description=The outcome of the operation."`
+	}
+)
+
+// StateTools returns the tools that let an agent read, write and delete the
+// state of the conversation being run.
+func StateTools(agentName string, stateMemory StateMemory) []ai.Tool {
+	get := func(ctx *ai.ToolContext, input StateGetInput) (StateGetOutput, error) {
+		conversationID := GetRunConversationID(ctx)
+		if conversationID == "" {
+			return StateGetOutput{}, ErrNoRunConversation
+		}
+
+		state, err := stateMemory.GetState(ctx, conversationID)
+		if err != nil {
+			return StateGetOutput{}, err
+		}
+
+		if input.Key != "" {
+			v, ok := state[input.Key]
+			if !ok {
+				return StateGetOutput{State: map[string]any{}, Status: StatusStateNotFound}, nil
+			}
+			state = map[string]any{input.Key: v}
+		}
+
+		if len(state) == 0 {
+			return StateGetOutput{State: map[string]any{}, Status: StatusStateNotFound}, nil
+		}
+		return StateGetOutput{State: state, Status: StatusStateSuccess}, nil
+	}
+
+	set := func(ctx *ai.ToolContext, input StateSetInput) (StateStatusOutput, error) {
+		conversationID := GetRunConversationID(ctx)
+		if conversationID == "" {
+			return StateStatusOutput{}, ErrNoRunConversation
+		}
+
+		err := stateMemory.SetState(ctx, conversationID, input.Key, input.Value)
+		if err != nil {
+			return StateStatusOutput{}, err
+		}
+		return StateStatusOutput{Status: StatusStateSuccess}, nil
+	}
+
+	del := func(ctx *ai.ToolContext, input StateDeleteInput) (StateStatusOutput, error) {
+		conversationID := GetRunConversationID(ctx)
+		if conversationID == "" {
+			return StateStatusOutput{}, ErrNoRunConversation
+		}
+
+		err := stateMemory.DeleteState(ctx, conversationID, input.Key)
+		if err != nil {
+			return StateStatusOutput{}, err
+		}
+		return StateStatusOutput{Status: StatusStateSuccess}, nil
+	}
+
+	return []ai.Tool{
+		ai.NewTool(
+			fmt.Sprintf(StateGetToolNameFormat, agentName),
+			"Reads facts remembered for the current conversation (e.g. order number, chosen plan, user name).",
+			get,
+		),
+		ai.NewTool(
+			fmt.Sprintf(StateSetToolNameFormat, agentName),
+			"Remembers a fact for the current conversation under a key, replacing any previous value.",
+			set,
+		),
+		ai.NewTool(
+			fmt.Sprintf(StateDeleteToolNameFormat, agentName),
+			"Forgets a fact remembered for the current conversation.",
+			del,
+		),
+	}
+}
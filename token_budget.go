@@ -0,0 +1,96 @@
+package agens
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// DefaultCharsPerToken is the average number of characters per token assumed
+// by DefaultTokenEstimator.
+const DefaultCharsPerToken = 4
+
+// TokenEstimator estimates the number of tokens a message takes in the model's context window.
+type TokenEstimator func(msg *ai.Message) int
+
+// DefaultTokenEstimator roughly estimates the tokens of a message as its
+// number of characters divided by DefaultCharsPerToken. Text, reasoning, tool
+// requests and tool responses are all taken into account.
+func DefaultTokenEstimator(msg *ai.Message) int {
+	if msg == nil {
+		return 0
+	}
+
+	chars := 0
+	for _, part := range msg.Content {
+		chars += utf8.RuneCountInString(part.Text)
+
+		if part.ToolRequest != nil {
+			chars += utf8.RuneCountInString(part.ToolRequest.Name) + jsonLength(part.ToolRequest.Input)
+		}
+		if part.ToolResponse != nil {
+			chars += utf8.RuneCountInString(part.ToolResponse.Name) + jsonLength(part.ToolResponse.Output)
+		}
+	}
+
+	return (chars + DefaultCharsPerToken - 1) / DefaultCharsPerToken
+}
+
+func jsonLength(v any) int {
+	if v == nil {
+		return 0
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return utf8.RuneCount(b)
+}
+
+// trimHistoryToBudget drops the oldest turns of the history until its estimated
+// size fits within maxTokens. A model message requesting tools and the tool
+// messages that answer it are kept or dropped together, and the kept history
+// never starts with a tool response.
+func trimHistoryToBudget(history []*ai.Message, maxTokens int, estimate TokenEstimator) []*ai.Message {
+	if (maxTokens <= 0) || (len(history) == 0) {
+		return history
+	}
+
+	if estimate == nil {
+		estimate = DefaultTokenEstimator
+	}
+
+	var (
+		total = 0
+		start = len(history)
+	)
+
+	for end := len(history); end > 0; {
+		// group the message with the tool responses that follow its tool requests
+		begin := end - 1
+		for (begin > 0) && (history[begin].Role == ai.RoleTool) {
+			begin--
+		}
+
+		tokens := 0
+		for _, msg := range history[begin:end] {
+			tokens += estimate(msg)
+		}
+
+		if total+tokens > maxTokens {
+			break
+		}
+
+		total += tokens
+		start, end = begin, begin
+	}
+
+	// never start with orphan tool responses
+	for (start < len(history)) && (history[start].Role == ai.RoleTool) {
+		start++
+	}
+
+	return history[start:]
+}
@@ -7,8 +7,9 @@ type Trigger interface {
 	// Name returns the name of the trigger.
 	Name() string
 
-	// RegisterAgent registers an agent with the trigger.
-	RegisterAgent(*Agent) error
+	// RegisterAgent registers an agent (or any other Runner, such as a Router)
+	// with the trigger.
+	RegisterAgent(Runner) error
 
 	// Start begins the trigger's active listening or polling operation.
 	Start(context.Context) error
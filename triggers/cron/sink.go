@@ -0,0 +1,117 @@
+package cron
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+var (
+	_ Sink = &LogSink{}
+	_ Sink = &HTTPSink{}
+	_ Sink = SinkFunc(nil)
+	_ Sink = SenderSink(nil)
+)
+
+// Sink receives the responses of the job runs.
+type Sink interface {
+	Send(ctx context.Context, job *Job, resp *ai.ModelResponse) error
+}
+
+// SinkFunc is an adapter to use an ordinary function as a Sink.
+type SinkFunc func(ctx context.Context, job *Job, resp *ai.ModelResponse) error
+
+func (f SinkFunc) Send(ctx context.Context, job *Job, resp *ai.ModelResponse) error {
+	return f(ctx, job, resp)
+}
+
+// SenderSink sends the text of the responses through an outbound sender,
+// e.g. a function that posts it to an existing Telegram or WhatsApp chat.
+type SenderSink func(ctx context.Context, job *Job, text string) error
+
+func (f SenderSink) Send(ctx context.Context, job *Job, resp *ai.ModelResponse) error {
+	return f(ctx, job, resp.Text())
+}
+
+// LogSink logs the text of the responses.
+type LogSink struct {
+	Logger *slog.Logger
+}
+
+func (sink *LogSink) Send(ctx context.Context, job *Job, resp *ai.ModelResponse) error {
+	logger := sink.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	logger.InfoContext(ctx, "cron job response",
+		slog.String("job", job.Name),
+		slog.String("finish_reason", string(resp.FinishReason)),
+		slog.String("text", resp.Text()),
+	)
+	return nil
+}
+
+// HTTPPayload is the JSON body posted by HTTPSink.
+type HTTPPayload struct {
+	Job          string `json:"job"`
+	Agent        string `json:"agent,omitempty"`
+	Text         string `json:"text"`
+	FinishReason string `json:"finish_reason"`
+}
+
+// HTTPSink posts the responses as JSON (HTTPPayload) to a callback URL.
+type HTTPSink struct {
+	URL string
+
+	// Header contains extra headers added to the requests (e.g. Authorization).
+	Header http.Header
+
+	// Client is the HTTP client used. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+func (sink *HTTPSink) Send(ctx context.Context, job *Job, resp *ai.ModelResponse) error {
+	body, err := json.Marshal(HTTPPayload{
+		Job:          job.Name,
+		Agent:        job.Agent,
+		Text:         resp.Text(),
+		FinishReason: string(resp.FinishReason),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sink.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, values := range sink.Header {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+
+	client := sink.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if (res.StatusCode < 200) || (res.StatusCode >= 300) {
+		return fmt.Errorf("cron: http sink: unexpected status %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gonzxlezs/agens"
+
+	"github.com/firebase/genkit/go/ai"
+	robfig "github.com/robfig/cron/v3"
+)
+
+const TriggerName = "Cron"
+
+var (
+	ErrJobWithoutName = errors.New("cron: job without name")
+
+	ErrJobWithoutSchedule = errors.New("cron: job without schedule or interval")
+
+	ErrDuplicateJobName = errors.New("cron: duplicate job name")
+
+	ErrRunnerNotFound = errors.New("cron: runner not found")
+
+	ErrTriggerStarted = errors.New("cron: trigger already started")
+)
+
+var _ agens.Trigger = &Trigger{}
+
+// Job describes a proactive agent run.
+type Job struct {
+	// Name identifies the job. It is also used as the channel ID of the
+	// synthetic message unless Metadata overrides it.
+	Name string
+
+	// Schedule is a standard cron expression (e.g. "0 9 * * MON-FRI") or a
+	// descriptor such as "@hourly". It takes precedence over Interval.
+	Schedule string
+
+	// Interval runs the job at a fixed interval when Schedule is empty.
+	Interval time.Duration
+
+	// Agent is the name of the registered runner to run. If empty, the job
+	// runs every registered runner, one after another.
+	Agent string
+
+	// Text is the text of the synthetic user message sent to the agent.
+	Text string
+
+	// Metadata is merged into the metadata of the synthetic message, after the
+	// defaults (source, channel ID and user ID) are set.
+	Metadata map[string]any
+
+	// PromptVars are attached to the context of the runs with
+	// agens.WithPromptVars, for the system prompt templates.
+	PromptVars map[string]any
+
+	// Sink receives the responses of the job. If nil, the trigger sink is used.
+	Sink Sink
+}
+
+func (job *Job) schedule() (robfig.Schedule, error) {
+	if job.Schedule != "" {
+		return robfig.ParseStandard(job.Schedule)
+	}
+
+	if job.Interval > 0 {
+		return robfig.Every(job.Interval), nil
+	}
+	return nil, ErrJobWithoutSchedule
+}
+
+type TriggerOpts struct {
+	// Sink receives the responses of the jobs that do not define their own.
+	// Defaults to a LogSink.
+	Sink Sink
+
+	// Logger is used to report the errors of the job runs.
+	Logger *slog.Logger
+
+	// Location is the time zone of the cron expressions. Defaults to time.Local.
+	Location *time.Location
+}
+
+// Trigger runs the registered agents on a schedule with a synthetic message
+// and hands their responses to a Sink. Runs of the same job never overlap: if
+// a run is still in progress when the job is due again, the new run is skipped.
+type Trigger struct {
+	Sink   Sink
+	Logger *slog.Logger
+
+	mu       sync.Mutex
+	jobs     []*Job
+	runners  []agens.Runner
+	location *time.Location
+	cron     *robfig.Cron
+	cancel   context.CancelFunc
+
+	// schedule returns the schedule of a job (see Job.schedule). Tests replace
+	// it to decide when the jobs are due.
+	schedule func(job *Job) (robfig.Schedule, error)
+}
+
+func NewTrigger(opts *TriggerOpts) *Trigger {
+	if opts == nil {
+		opts = &TriggerOpts{}
+	}
+
+	trigger := &Trigger{
+		Sink:   opts.Sink,
+		Logger: opts.Logger,
+	}
+
+	if trigger.Logger == nil {
+		trigger.Logger = slog.New(slog.NewTextHandler(os.Stdout, nil))
+	}
+
+	if trigger.Sink == nil {
+		trigger.Sink = &LogSink{Logger: trigger.Logger}
+	}
+
+	trigger.location = opts.Location
+	if trigger.location == nil {
+		trigger.location = time.Local
+	}
+
+	trigger.schedule = (*Job).schedule
+
+	return trigger
+}
+
+func (trigger *Trigger) Name() string {
+	return TriggerName
+}
+
+// AddJob adds a job to the trigger. Jobs must be added before Start.
+func (trigger *Trigger) AddJob(job Job) error {
+	if job.Name == "" {
+		return ErrJobWithoutName
+	}
+
+	if _, err := job.schedule(); err != nil {
+		return fmt.Errorf("job %s: %w", job.Name, err)
+	}
+
+	trigger.mu.Lock()
+	defer trigger.mu.Unlock()
+
+	if trigger.cancel != nil {
+		return ErrTriggerStarted
+	}
+
+	for _, j := range trigger.jobs {
+		if j.Name == job.Name {
+			return fmt.Errorf("%w: %s", ErrDuplicateJobName, job.Name)
+		}
+	}
+
+	trigger.jobs = append(trigger.jobs, &job)
+	return nil
+}
+
+func (trigger *Trigger) RegisterAgent(agent agens.Runner) error {
+	trigger.mu.Lock()
+	defer trigger.mu.Unlock()
+
+	trigger.runners = append(trigger.runners, agent)
+	return nil
+}
+
+// Start schedules the jobs. The runs are canceled when ctx is done or the
+// trigger is stopped. A stopped trigger can be started again.
+func (trigger *Trigger) Start(ctx context.Context) error {
+	trigger.mu.Lock()
+	defer trigger.mu.Unlock()
+
+	if trigger.cancel != nil {
+		return ErrTriggerStarted
+	}
+
+	for _, job := range trigger.jobs {
+		if _, err := trigger.jobRunners(job); err != nil {
+			return err
+		}
+	}
+
+	cron := robfig.New(
+		robfig.WithLocation(trigger.location),
+		robfig.WithChain(robfig.SkipIfStillRunning(robfig.DiscardLogger)),
+	)
+
+	runCtx, cancel := context.WithCancel(ctx)
+
+	for _, job := range trigger.jobs {
+		schedule, err := trigger.schedule(job)
+		if err != nil {
+			cancel()
+			return fmt.Errorf("job %s: %w", job.Name, err)
+		}
+
+		cron.Schedule(schedule, robfig.FuncJob(func() {
+			trigger.runJob(runCtx, job)
+		}))
+	}
+
+	trigger.cron = cron
+	trigger.cancel = cancel
+	cron.Start()
+
+	go func() {
+		<-runCtx.Done()
+		cron.Stop()
+	}()
+
+	return nil
+}
+
+// Stop stops scheduling new runs, cancels the runs in progress and waits for
+// them to return or for ctx to be done, whichever happens first.
+func (trigger *Trigger) Stop(ctx context.Context) error {
+	trigger.mu.Lock()
+	cancel, cron := trigger.cancel, trigger.cron
+	trigger.cancel = nil
+	trigger.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	select {
+	case <-cron.Stop().Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (trigger *Trigger) jobRunners(job *Job) ([]agens.Runner, error) {
+	if job.Agent == "" {
+		if len(trigger.runners) == 0 {
+			return nil, fmt.Errorf("job %s: %w", job.Name, ErrRunnerNotFound)
+		}
+		return trigger.runners, nil
+	}
+
+	for _, runner := range trigger.runners {
+		if runner.Name() == job.Agent {
+			return []agens.Runner{runner}, nil
+		}
+	}
+	return nil, fmt.Errorf("job %s: %w: %s", job.Name, ErrRunnerNotFound, job.Agent)
+}
+
+func (trigger *Trigger) runJob(ctx context.Context, job *Job) {
+	trigger.mu.Lock()
+	runners, err := trigger.jobRunners(job)
+	trigger.mu.Unlock()
+
+	if err != nil {
+		trigger.Logger.Error(err.Error())
+		return
+	}
+
+	sink := job.Sink
+	if sink == nil {
+		sink = trigger.Sink
+	}
+
+	if job.PromptVars != nil {
+		ctx = agens.WithPromptVars(ctx, job.PromptVars)
+	}
+
+	for _, runner := range runners {
+		if ctx.Err() != nil {
+			return
+		}
+
+		resp, err := runner.Run(ctx, trigger.jobMessage(job))
+		if err != nil {
+			trigger.Logger.Error(fmt.Sprintf("job %s: %s", job.Name, err.Error()))
+			continue
+		}
+
+		if resp.FinishReason == agens.FinishReasonDelegated {
+			continue
+		}
+
+		if err := sink.Send(ctx, job, resp); err != nil {
+			trigger.Logger.Error(fmt.Sprintf("job %s: %s", job.Name, err.Error()))
+		}
+	}
+}
+
+func (trigger *Trigger) jobMessage(job *Job) *ai.Message {
+	aiMsg := ai.NewUserTextMessage(job.Text)
+
+	agens.SetSource(aiMsg, trigger.Name())
+	agens.SetUserID(aiMsg, job.Name)
+	agens.SetChannelID(aiMsg, job.Name)
+
+	for k, v := range job.Metadata {
+		aiMsg.Metadata[k] = v
+	}
+	return aiMsg
+}
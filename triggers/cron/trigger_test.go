@@ -0,0 +1,312 @@
+package cron
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/gonzxlezs/agens"
+	robfig "github.com/robfig/cron/v3"
+)
+
+// testTimeout bounds the waits for the runs started by the scheduler, which
+// are due as soon as the trigger starts.
+const testTimeout = 5 * time.Second
+
+// runnerFunc is a Runner that calls a function.
+type runnerFunc func(ctx context.Context, msg *ai.Message) (*ai.ModelResponse, error)
+
+func (fn runnerFunc) Name() string {
+	return "tester"
+}
+
+func (fn runnerFunc) Run(ctx context.Context, msg *ai.Message) (*ai.ModelResponse, error) {
+	return fn(ctx, msg)
+}
+
+// startSchedule is due once, when the trigger starts.
+type startSchedule struct {
+	started bool
+}
+
+func (s *startSchedule) Next(t time.Time) time.Time {
+	if s.started {
+		return time.Time{}
+	}
+	s.started = true
+	return t
+}
+
+// manualSchedule is never due: the jobs only run with runDue.
+type manualSchedule struct{}
+
+func (manualSchedule) Next(time.Time) time.Time {
+	return time.Time{}
+}
+
+func dueAtStart() robfig.Schedule {
+	return &startSchedule{}
+}
+
+func dueManually() robfig.Schedule {
+	return manualSchedule{}
+}
+
+// newTestTrigger starts a trigger with a job. newSchedule returns the schedule
+// of the job on every start.
+func newTestTrigger(t *testing.T, runner agens.Runner, job Job, newSchedule func() robfig.Schedule) *Trigger {
+	t.Helper()
+
+	trigger := NewTrigger(&TriggerOpts{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	trigger.schedule = func(*Job) (robfig.Schedule, error) {
+		return newSchedule(), nil
+	}
+
+	if err := trigger.RegisterAgent(runner); err != nil {
+		t.Fatal(err)
+	}
+	if err := trigger.AddJob(job); err != nil {
+		t.Fatal(err)
+	}
+	if err := trigger.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { trigger.Stop(context.Background()) })
+	return trigger
+}
+
+// runDue runs the jobs as if they were due, through the same wrappers as the
+// scheduled runs, and returns when they return.
+func runDue(trigger *Trigger) {
+	for _, entry := range trigger.cron.Entries() {
+		entry.WrappedJob.Run()
+	}
+}
+
+func TestJobSchedule(t *testing.T) {
+	start := time.Date(2026, time.March, 2, 8, 30, 0, 0, time.UTC) // a Monday
+
+	tests := []struct {
+		name string
+		job  Job
+		want time.Time
+	}{
+		{"interval", Job{Interval: 90 * time.Second}, start.Add(90 * time.Second)},
+		{"expression", Job{Schedule: "0 9 * * MON-FRI"}, start.Add(30 * time.Minute)},
+		{"expression first", Job{Schedule: "@hourly", Interval: time.Minute}, start.Add(30 * time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := tt.job.schedule()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next := schedule.Next(start); !next.Equal(tt.want) {
+				t.Errorf("next = %s, want %s", next, tt.want)
+			}
+		})
+	}
+
+	if _, err := (&Job{}).schedule(); err != ErrJobWithoutSchedule {
+		t.Errorf("err = %v, want %v", err, ErrJobWithoutSchedule)
+	}
+}
+
+func TestJobSendsToSink(t *testing.T) {
+	t.Parallel()
+
+	messages := make(chan *ai.Message, 10)
+	runner := runnerFunc(func(_ context.Context, msg *ai.Message) (*ai.ModelResponse, error) {
+		messages <- msg
+		return &ai.ModelResponse{Message: ai.NewModelTextMessage("Nothing new."), FinishReason: ai.FinishReasonStop}, nil
+	})
+
+	type sent struct {
+		job  string
+		text string
+	}
+	sink := make(chan sent, 10)
+
+	trigger := newTestTrigger(t, runner, Job{
+		Name:     "digest",
+		Interval: time.Hour,
+		Text:     "Any news?",
+		Metadata: map[string]any{agens.ChannelIDKey: "team", "tenant": "acme"},
+		Sink: SinkFunc(func(_ context.Context, job *Job, resp *ai.ModelResponse) error {
+			sink <- sent{job.Name, resp.Text()}
+			return nil
+		}),
+	}, dueManually)
+
+	runDue(trigger)
+
+	if got := <-sink; got.job != "digest" || got.text != "Nothing new." {
+		t.Errorf("sink got %+v", got)
+	}
+
+	msg := <-messages
+	if msg.Text() != "Any news?" {
+		t.Errorf("message text = %q", msg.Text())
+	}
+	if source, _ := agens.GetSource(msg); source != TriggerName {
+		t.Errorf("source = %q, want %q", source, TriggerName)
+	}
+	if userID, _ := agens.GetUserID(msg); userID != "digest" {
+		t.Errorf("user ID = %q, want the job name", userID)
+	}
+
+	// the job metadata is merged after the defaults
+	if channelID, _ := agens.GetChannelID(msg); channelID != "team" {
+		t.Errorf("channel ID = %q, want team", channelID)
+	}
+	if msg.Metadata["tenant"] != "acme" {
+		t.Errorf("metadata = %v, want the job metadata", msg.Metadata)
+	}
+}
+
+func TestJobPromptVars(t *testing.T) {
+	t.Parallel()
+
+	var vars map[string]any
+	runner := runnerFunc(func(ctx context.Context, _ *ai.Message) (*ai.ModelResponse, error) {
+		var err error
+		if vars, err = agens.GetPromptVars(ctx); err != nil {
+			t.Error(err)
+		}
+		return &ai.ModelResponse{Message: ai.NewModelTextMessage("Done.")}, nil
+	})
+
+	trigger := newTestTrigger(t, runner, Job{
+		Name:       "report",
+		Interval:   time.Hour,
+		PromptVars: map[string]any{"team": "sales"},
+		Sink:       SinkFunc(func(context.Context, *Job, *ai.ModelResponse) error { return nil }),
+	}, dueManually)
+
+	runDue(trigger)
+
+	if vars["team"] != "sales" {
+		t.Errorf("prompt vars = %v, want the job prompt vars", vars)
+	}
+}
+
+func TestSkipsOverlappingRuns(t *testing.T) {
+	t.Parallel()
+
+	var (
+		runs    atomic.Int32
+		started = make(chan struct{}, 10)
+		release = make(chan struct{})
+	)
+	runner := runnerFunc(func(ctx context.Context, _ *ai.Message) (*ai.ModelResponse, error) {
+		runs.Add(1)
+		started <- struct{}{}
+
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return &ai.ModelResponse{Message: ai.NewModelTextMessage("Done.")}, nil
+	})
+
+	trigger := newTestTrigger(t, runner, Job{
+		Name:     "slow",
+		Interval: time.Hour,
+		Sink:     SinkFunc(func(context.Context, *Job, *ai.ModelResponse) error { return nil }),
+	}, dueManually)
+
+	first := make(chan struct{})
+	go func() {
+		runDue(trigger)
+		close(first)
+	}()
+	<-started
+
+	// the job is due twice more while the first run is in progress
+	runDue(trigger)
+	runDue(trigger)
+	if n := runs.Load(); n != 1 {
+		t.Errorf("%d runs while the first one was in progress, want 1", n)
+	}
+
+	// once it finishes, the job runs again
+	close(release)
+	<-first
+
+	runDue(trigger)
+	if n := runs.Load(); n != 2 {
+		t.Errorf("%d runs, want the job run again", n)
+	}
+}
+
+func TestStopCancelsRuns(t *testing.T) {
+	t.Parallel()
+
+	var (
+		started  = make(chan struct{}, 1)
+		canceled = make(chan struct{})
+	)
+	runner := runnerFunc(func(ctx context.Context, _ *ai.Message) (*ai.ModelResponse, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		close(canceled)
+		return nil, ctx.Err()
+	})
+
+	trigger := newTestTrigger(t, runner, Job{Name: "blocked", Interval: time.Hour}, dueAtStart)
+
+	select {
+	case <-started:
+	case <-time.After(testTimeout):
+		t.Fatal("the job did not run")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	if err := trigger.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	select {
+	case <-canceled:
+	default:
+		t.Error("Stop returned before the run was canceled")
+	}
+}
+
+func TestRestartAfterStop(t *testing.T) {
+	t.Parallel()
+
+	runs := make(chan struct{}, 10)
+	runner := runnerFunc(func(context.Context, *ai.Message) (*ai.ModelResponse, error) {
+		runs <- struct{}{}
+		return &ai.ModelResponse{Message: ai.NewModelTextMessage("Done.")}, nil
+	})
+
+	trigger := newTestTrigger(t, runner, Job{
+		Name:     "restarted",
+		Interval: time.Hour,
+		Sink:     SinkFunc(func(context.Context, *Job, *ai.ModelResponse) error { return nil }),
+	}, dueAtStart)
+
+	for i := range 2 {
+		select {
+		case <-runs:
+		case <-time.After(testTimeout):
+			t.Fatalf("start %d: the job did not run", i+1)
+		}
+
+		if err := trigger.Stop(context.Background()); err != nil {
+			t.Fatalf("Stop: %v", err)
+		}
+		if err := trigger.Start(context.Background()); err != nil {
+			t.Fatalf("start %d: %v", i+2, err)
+		}
+	}
+}
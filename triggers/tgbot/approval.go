@@ -0,0 +1,131 @@
+package tgbot
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gonzxlezs/agens"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/callbackquery"
+	"github.com/firebase/genkit/go/ai"
+)
+
+const (
+	// ApprovalCallbackPrefix is the prefix of the callback data of the approval buttons.
+	ApprovalCallbackPrefix = "agens_approval:"
+
+	ApproveCallbackData = ApprovalCallbackPrefix + "approve"
+	RejectCallbackData  = ApprovalCallbackPrefix + "reject"
+)
+
+var (
+	// ApproveButtonText is the label of the button that approves a tool call.
+	ApproveButtonText = "✅ Approve"
+
+	// RejectButtonText is the label of the button that rejects a tool call.
+	RejectButtonText = "❌ Reject"
+
+	// ApprovalNotAllowedText is shown to the users who press the buttons of a
+	// tool call requested by someone else.
+	ApprovalNotAllowedText = "Only the user who made the request can answer it."
+)
+
+// approvalKeyboard builds the Approve and Reject buttons. The ID of the user
+// of the pending run is appended to their callback data, so that only that
+// user can answer.
+func approvalKeyboard(userID string) gotgbot.InlineKeyboardMarkup {
+	return gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{{
+			{Text: ApproveButtonText, CallbackData: ApproveCallbackData + ":" + userID},
+			{Text: RejectButtonText, CallbackData: RejectCallbackData + ":" + userID},
+		}},
+	}
+}
+
+// parseApprovalCallback splits the callback data of an approval button into
+// its decision (e.g. ApproveCallbackData) and the ID of the user who may answer.
+func parseApprovalCallback(data string) (decision string, userID string) {
+	decision, userID, _ = strings.Cut(strings.TrimPrefix(data, ApprovalCallbackPrefix), ":")
+	return ApprovalCallbackPrefix + decision, userID
+}
+
+// sendApprovalPrompts asks the user to approve the pending tool calls with
+// inline Approve and Reject buttons.
+func (trigger *Trigger) sendApprovalPrompts(chatID int64, userID string, requests []agens.ToolApprovalRequest) error {
+	for _, req := range requests {
+		_, err := trigger.Bot.SendMessage(chatID, req.Prompt(), &gotgbot.SendMessageOpts{
+			ReplyMarkup: approvalKeyboard(userID),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CallbackHandler handles the Approve and Reject buttons of the approval
+// prompts: it removes the buttons and resumes the agent with the decision.
+// Presses from users other than the one of the pending run are refused.
+func (trigger *Trigger) CallbackHandler(agent agens.Runner) ext.Handler {
+	return handlers.NewCallback(
+		callbackquery.Prefix(ApprovalCallbackPrefix),
+		func(b *gotgbot.Bot, tgCtx *ext.Context) error {
+			var (
+				cq     = tgCtx.CallbackQuery
+				userID = strconv.FormatInt(cq.From.Id, 10)
+
+				decision, requester = parseApprovalCallback(cq.Data)
+				approved            = decision == ApproveCallbackData
+			)
+
+			if requester != userID {
+				_, err := cq.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+					Text:      ApprovalNotAllowedText,
+					ShowAlert: true,
+				})
+				return err
+			}
+
+			if _, err := cq.Answer(b, nil); err != nil {
+				return err
+			}
+
+			if cq.Message == nil {
+				return nil
+			}
+
+			var (
+				chatID = cq.Message.GetChat().Id
+				text   = strings.TrimPrefix(decision, ApprovalCallbackPrefix)
+
+				aiMsg = ai.NewUserTextMessage(text)
+
+				ctx = agens.WithOutputOption(
+					trigger.promptVarsContext(tgCtx),
+					ai.WithOutputType(outputType),
+				)
+			)
+
+			agens.SetSource(aiMsg, trigger.Name())
+			agens.SetUserID(aiMsg, userID)
+			agens.SetChannelID(aiMsg, strconv.FormatInt(chatID, 10))
+			agens.SetMessageID(aiMsg, cq.Id)
+			agens.SetToolApproval(aiMsg, approved)
+
+			return agens.ProcessOnce(ctx, trigger.Deduplicator, aiMsg, func() error {
+				_, _, err := b.EditMessageReplyMarkup(&gotgbot.EditMessageReplyMarkupOpts{
+					ChatId:    chatID,
+					MessageId: cq.Message.GetMessageId(),
+				})
+				if err != nil {
+					return err
+				}
+
+				return trigger.reply(ctx, agent, aiMsg, chatID)
+			})
+		},
+	)
+}
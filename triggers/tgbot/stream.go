@@ -0,0 +1,140 @@
+package tgbot
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gonzxlezs/agens"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// DefaultStreamEditInterval is the default minimum time between two edits of
+// a draft message, chosen to stay within the Bot API limits.
+const DefaultStreamEditInterval = time.Second
+
+type messageDraft struct {
+	bot      *gotgbot.Bot
+	chatID   int64
+	interval time.Duration
+
+	msg      *gotgbot.Message
+	text     string
+	lastEdit time.Time
+}
+
+func (trigger *Trigger) streamReply(ctx context.Context, agent agens.StreamRunner, aiMsg *ai.Message, chatID int64) (*ai.ModelResponse, error) {
+	draft := &messageDraft{
+		bot:      trigger.Bot,
+		chatID:   chatID,
+		interval: trigger.StreamEditInterval,
+	}
+
+	resp, err := agent.RunStream(ctx, aiMsg, draft.update)
+	if err != nil {
+		return resp, err
+	}
+
+	// batched, or paused while a human operator handles the conversation
+	if resp.FinishReason == agens.FinishReasonDelegated {
+		return resp, draft.discard()
+	}
+
+	// a tool call waits for approval
+	if resp.FinishReason == ai.FinishReasonInterrupted {
+		if err := draft.discard(); err != nil {
+			return resp, err
+		}
+
+		userID, _ := agens.GetUserID(aiMsg)
+		return resp, trigger.sendApprovalPrompts(chatID, userID, agens.PendingToolApprovals(resp))
+	}
+
+	messages, err := responseMessages(resp)
+	if err != nil {
+		return resp, err
+	}
+
+	return resp, trigger.finishDraft(draft, messages)
+}
+
+func (trigger *Trigger) finishDraft(draft *messageDraft, sendParams []*MessageResponse) error {
+	if draft.msg == nil {
+		return trigger.SendMessage(draft.chatID, sendParams)
+	}
+
+	split := splitMessageText(sendParams)
+	if len(split) == 0 {
+		return draft.discard()
+	}
+
+	first := split[0]
+	if (first.Text != draft.text) || (first.ParseMode != "") {
+		_, _, err := trigger.Bot.EditMessageText(first.Text, &gotgbot.EditMessageTextOpts{
+			ChatId:    draft.chatID,
+			MessageId: draft.msg.MessageId,
+			ParseMode: first.ParseMode,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return trigger.sendMessages(draft.chatID, draft.msg, split[1:])
+}
+
+func (d *messageDraft) update(_ context.Context, chunk *ai.ModelResponseChunk) error {
+	var params MessageResponses
+	if err := chunk.Output(&params); err != nil {
+		// Partial output that cannot be parsed yet.
+		return nil
+	}
+
+	text := draftText(params.Messages)
+	if (text == "") || (text == d.text) || (time.Since(d.lastEdit) < d.interval) {
+		return nil
+	}
+
+	var err error
+	if d.msg == nil {
+		d.msg, err = d.bot.SendMessage(d.chatID, text, nil)
+	} else {
+		_, _, err = d.bot.EditMessageText(text, &gotgbot.EditMessageTextOpts{
+			ChatId:    d.chatID,
+			MessageId: d.msg.MessageId,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	d.text = text
+	d.lastEdit = time.Now()
+	return nil
+}
+
+func (d *messageDraft) discard() error {
+	if d.msg == nil {
+		return nil
+	}
+
+	_, err := d.bot.DeleteMessage(d.chatID, d.msg.MessageId, nil)
+	return err
+}
+
+func draftText(sendParams []*MessageResponse) string {
+	texts := make([]string, 0, len(sendParams))
+	for _, params := range sendParams {
+		if params != nil && params.Text != "" {
+			texts = append(texts, params.Text)
+		}
+	}
+
+	runes := []rune(strings.Join(texts, "\n\n"))
+	if len(runes) > MaxLengthMessageText {
+		runes = runes[:MaxLengthMessageText]
+	}
+	return string(runes)
+}
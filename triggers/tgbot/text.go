@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gonzxlezs/agens"
 
@@ -43,7 +45,7 @@ type MessageResponses struct {
 
 var outputType = MessageResponses{}
 
-func (trigger *Trigger) TextHandler(agent *agens.Agent) ext.Handler {
+func (trigger *Trigger) TextHandler(agent agens.Runner) ext.Handler {
 	return handlers.NewMessage(
 		message.Text,
 		func(b *gotgbot.Bot, tgCtx *ext.Context) error {
@@ -61,7 +63,7 @@ func (trigger *Trigger) TextHandler(agent *agens.Agent) ext.Handler {
 				channelID = strconv.FormatInt(chatID, 10)
 
 				ctx = agens.WithOutputOption(
-					context.Background(),
+					trigger.promptVarsContext(tgCtx),
 					ai.WithOutputType(outputType),
 				)
 			)
@@ -69,33 +71,93 @@ func (trigger *Trigger) TextHandler(agent *agens.Agent) ext.Handler {
 			agens.SetSource(aiMsg, trigger.Name())
 			agens.SetUserID(aiMsg, userID)
 			agens.SetChannelID(aiMsg, channelID)
+			agens.SetMessageID(aiMsg, strconv.FormatInt(msg.MessageId, 10))
 
-			resp, err := agent.Run(ctx, aiMsg)
-			if err != nil {
-				return err
-			}
-
-			if resp.FinishReason == agens.FinishReasonDelegated {
-				return nil
-			}
-
-			var params MessageResponses
-			if err := resp.Output(&params); err != nil {
-				return err
+			if approved, ok := agens.ParseToolApproval(msg.Text); ok {
+				agens.SetToolApproval(aiMsg, approved)
 			}
 
-			return trigger.SendMessage(chatID, params.Messages)
+			return agens.ProcessOnce(ctx, trigger.Deduplicator, aiMsg, func() error {
+				return trigger.reply(ctx, agent, aiMsg, chatID)
+			})
 		},
 	)
 }
 
-func (trigger *Trigger) SendMessage(chatID int64, sendParams []*MessageResponse) error {
+// promptVarsContext returns a context with the prompt vars of the update (see
+// TriggerOpts.PromptVars).
+func (trigger *Trigger) promptVarsContext(tgCtx *ext.Context) context.Context {
+	ctx := context.Background()
+	if trigger.PromptVars == nil {
+		return ctx
+	}
+	return agens.WithPromptVars(ctx, trigger.PromptVars(tgCtx))
+}
+
+// KnowledgeQuery builds the knowledge query of a batch from the text written
+// by the users instead of the JSON encoded Telegram messages. It is meant for
+// agens.AgentConfig.KnowledgeQueryFunc.
+func KnowledgeQuery(batch []*ai.Message) string {
+	texts := make([]string, 0, len(batch))
+	for _, aiMsg := range batch {
+		var msg gotgbot.Message
+		if err := json.Unmarshal([]byte(aiMsg.Text()), &msg); err != nil {
+			// e.g. the decision of an approval button
+			texts = append(texts, aiMsg.Text())
+			continue
+		}
+		texts = append(texts, msg.Text)
+	}
+	return strings.Join(texts, "\n")
+}
+
+// reply runs the agent and sends its response to the chat.
+func (trigger *Trigger) reply(ctx context.Context, agent agens.Runner, aiMsg *ai.Message, chatID int64) (err error) {
 	var (
-		lastMsg *gotgbot.Message
-		err     error
+		resp    *ai.ModelResponse
+		started = time.Now()
 	)
+	defer func() {
+		trigger.Metrics.Record(ctx, agent.Name(), resp, err, time.Since(started))
+	}()
 
-	for _, params := range splitMessageText(sendParams) {
+	if sr, ok := agent.(agens.StreamRunner); ok && trigger.Streaming {
+		resp, err = trigger.streamReply(ctx, sr, aiMsg, chatID)
+		return err
+	}
+
+	resp, err = agent.Run(ctx, aiMsg)
+	if err != nil {
+		return err
+	}
+
+	// batched, or paused while a human operator handles the conversation
+	if resp.FinishReason == agens.FinishReasonDelegated {
+		return nil
+	}
+
+	// a tool call waits for approval
+	if resp.FinishReason == ai.FinishReasonInterrupted {
+		userID, _ := agens.GetUserID(aiMsg)
+		return trigger.sendApprovalPrompts(chatID, userID, agens.PendingToolApprovals(resp))
+	}
+
+	messages, err := responseMessages(resp)
+	if err != nil {
+		return err
+	}
+
+	return trigger.SendMessage(chatID, messages)
+}
+
+func (trigger *Trigger) SendMessage(chatID int64, sendParams []*MessageResponse) error {
+	return trigger.sendMessages(chatID, nil, splitMessageText(sendParams))
+}
+
+func (trigger *Trigger) sendMessages(chatID int64, lastMsg *gotgbot.Message, sendParams []*MessageResponse) error {
+	var err error
+
+	for _, params := range sendParams {
 		// reply to
 		if params.ReplyTo == -1 {
 			if lastMsg != nil {
@@ -114,6 +176,22 @@ func (trigger *Trigger) SendMessage(chatID int64, sendParams []*MessageResponse)
 	return nil
 }
 
+// responseMessages extracts the messages to send from the agent response.
+// Responses produced by the agent itself instead of the model (e.g. the canned
+// reply of a blocked turn) are plain text and are sent as a single message.
+func responseMessages(resp *ai.ModelResponse) ([]*MessageResponse, error) {
+	var params MessageResponses
+	err := resp.Output(&params)
+	if err == nil {
+		return params.Messages, nil
+	}
+
+	if resp.FinishReason == ai.FinishReasonBlocked && resp.Text() != "" {
+		return []*MessageResponse{{Text: resp.Text()}}, nil
+	}
+	return nil, err
+}
+
 func splitMessageText(sendParams []*MessageResponse) []*MessageResponse {
 	var result []*MessageResponse
 
@@ -3,11 +3,13 @@ package tgbot
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/gonzxlezs/agens"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"go.opentelemetry.io/otel/metric"
 )
 
 var _ agens.Trigger = &Trigger{}
@@ -18,6 +20,29 @@ type TriggerOpts struct {
 	UpdaterOpts    *ext.UpdaterOpts
 
 	PollingOpts *ext.PollingOpts
+
+	// Streaming enables progressive replies: a draft message is sent as soon as
+	// the first chunk arrives and edited as the response is generated.
+	// It requires the registered agent to implement agens.StreamRunner.
+	Streaming bool
+
+	// StreamEditInterval is the minimum time between two edits of the draft message.
+	// Defaults to DefaultStreamEditInterval.
+	StreamEditInterval time.Duration
+
+	// Deduplicator detects the messages redelivered by Telegram, which are
+	// then ignored. If nil, every message is run.
+	Deduplicator agens.MessageDeduplicator
+
+	// PromptVars, if set, returns the variables of the system prompt template
+	// for an update (e.g. the name of the user), attached to the context of the
+	// run with agens.WithPromptVars.
+	PromptVars func(tgCtx *ext.Context) map[string]any
+
+	// MeterProvider provides the meter of the OpenTelemetry metrics of the
+	// handled messages (see agens.MetricTriggerMessages). If nil, the global
+	// MeterProvider is used.
+	MeterProvider metric.MeterProvider
 }
 
 type Trigger struct {
@@ -26,6 +51,15 @@ type Trigger struct {
 	Updater    *ext.Updater
 
 	PollingOpts *ext.PollingOpts
+
+	Streaming          bool
+	StreamEditInterval time.Duration
+
+	Deduplicator agens.MessageDeduplicator
+
+	PromptVars func(tgCtx *ext.Context) map[string]any
+
+	Metrics *agens.TriggerMetrics
 }
 
 func NewTrigger(token string, opts *TriggerOpts) (*Trigger, error) {
@@ -49,6 +83,22 @@ func NewTrigger(token string, opts *TriggerOpts) (*Trigger, error) {
 
 	trigger.PollingOpts = opts.PollingOpts
 
+	trigger.Streaming = opts.Streaming
+
+	trigger.Deduplicator = opts.Deduplicator
+
+	trigger.PromptVars = opts.PromptVars
+
+	trigger.Metrics, err = agens.NewTriggerMetrics(opts.MeterProvider, trigger.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	trigger.StreamEditInterval = DefaultStreamEditInterval
+	if opts.StreamEditInterval > 0 {
+		trigger.StreamEditInterval = opts.StreamEditInterval
+	}
+
 	return trigger, nil
 }
 
@@ -56,8 +106,9 @@ func (trigger *Trigger) Name() string {
 	return "TelegramBot"
 }
 
-func (trigger *Trigger) RegisterAgent(agent *agens.Agent) error {
+func (trigger *Trigger) RegisterAgent(agent agens.Runner) error {
 	trigger.Dispatcher.AddHandler(trigger.TextHandler(agent))
+	trigger.Dispatcher.AddHandler(trigger.CallbackHandler(agent))
 	return nil
 }
 
@@ -2,10 +2,12 @@ package tgbot
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 	"github.com/gonzxlezs/agens"
+	"go.opentelemetry.io/otel/metric"
 )
 
 const DefaultSubPath = "/tgbot/"
@@ -20,6 +22,15 @@ type WebhookTriggerOpts struct {
 	SubPath        string
 	SecretToken    string
 	SetWebhookOpts *gotgbot.SetWebhookOpts
+
+	Streaming          bool
+	StreamEditInterval time.Duration
+
+	Deduplicator agens.MessageDeduplicator
+
+	PromptVars func(tgCtx *ext.Context) map[string]any
+
+	MeterProvider metric.MeterProvider
 }
 
 type WebhookTrigger struct {
@@ -44,6 +55,15 @@ func NewWebhookTrigger(token string, opts *WebhookTriggerOpts) (*WebhookTrigger,
 		BotOpts:        opts.BotOpts,
 		DispatcherOpts: opts.DispatcherOpts,
 		UpdaterOpts:    opts.UpdaterOpts,
+
+		Streaming:          opts.Streaming,
+		StreamEditInterval: opts.StreamEditInterval,
+
+		Deduplicator: opts.Deduplicator,
+
+		PromptVars: opts.PromptVars,
+
+		MeterProvider: opts.MeterProvider,
 	})
 
 	if err != nil {
@@ -66,7 +86,7 @@ func (trigger *WebhookTrigger) Name() string {
 	return trigger.BaseTrigger.Name() + "Webhook"
 }
 
-func (trigger *WebhookTrigger) RegisterAgent(agent *agens.Agent) error {
+func (trigger *WebhookTrigger) RegisterAgent(agent agens.Runner) error {
 	err := trigger.BaseTrigger.RegisterAgent(agent)
 	if err != nil {
 		return err
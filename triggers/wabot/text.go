@@ -3,6 +3,9 @@ package wabot
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/firebase/genkit/go/ai"
 	"github.com/gonzxlezs/agens"
@@ -10,7 +13,10 @@ import (
 	"github.com/wapikit/wapi.go/pkg/events"
 )
 
-func (trigger *WebhookTrigger) TextHandler(agent *agens.Agent) func(event events.BaseEvent) {
+// ApprovalReplyHint is appended to the approval prompts, which are answered by text.
+var ApprovalReplyHint = "Reply yes or no."
+
+func (trigger *WebhookTrigger) TextHandler(agent agens.Runner) func(event events.BaseEvent) {
 	return func(event events.BaseEvent) {
 		textMessageEvent := event.(*events.TextMessageEvent)
 
@@ -27,32 +33,82 @@ func (trigger *WebhookTrigger) TextHandler(agent *agens.Agent) func(event events
 			ctx = context.Background()
 		)
 
+		if trigger.PromptVars != nil {
+			ctx = agens.WithPromptVars(ctx, trigger.PromptVars(textMessageEvent))
+		}
+
 		agens.SetSource(aiMsg, trigger.Name())
 		agens.SetUserID(aiMsg, from)
 		agens.SetChannelID(aiMsg, from)
+		agens.SetMessageID(aiMsg, textMessageEvent.MessageId)
 
-		resp, err := agent.Run(ctx, aiMsg)
+		if approved, ok := agens.ParseToolApproval(textMessageEvent.Text); ok {
+			agens.SetToolApproval(aiMsg, approved)
+		}
+
+		err = agens.ProcessOnce(ctx, trigger.Deduplicator, aiMsg, func() error {
+			return trigger.reply(ctx, agent, textMessageEvent, aiMsg)
+		})
 		if err != nil {
 			trigger.Logger.Error(err.Error())
-			return
 		}
+	}
+}
 
-		if resp.FinishReason == agens.FinishReasonDelegated {
-			return
+// KnowledgeQuery builds the knowledge query of a batch from the text written
+// by the users instead of the JSON encoded WhatsApp events. It is meant for
+// agens.AgentConfig.KnowledgeQueryFunc.
+func KnowledgeQuery(batch []*ai.Message) string {
+	texts := make([]string, 0, len(batch))
+	for _, aiMsg := range batch {
+		var event events.TextMessageEvent
+		if err := json.Unmarshal([]byte(aiMsg.Text()), &event); err != nil {
+			texts = append(texts, aiMsg.Text())
+			continue
 		}
+		texts = append(texts, event.Text)
+	}
+	return strings.Join(texts, "\n")
+}
 
-		msg, err := components.NewTextMessage(components.TextMessageConfigs{
-			Text: resp.Text(),
-		})
+// reply runs the agent and replies to the message with its response.
+func (trigger *WebhookTrigger) reply(ctx context.Context, agent agens.Runner, event *events.TextMessageEvent, aiMsg *ai.Message) (err error) {
+	var (
+		resp    *ai.ModelResponse
+		started = time.Now()
+	)
+	defer func() {
+		trigger.Metrics.Record(ctx, agent.Name(), resp, err, time.Since(started))
+	}()
 
-		if err != nil {
-			trigger.Logger.Error("error creating text message: " + err.Error())
-			return
-		}
+	resp, err = agent.Run(ctx, aiMsg)
+	if err != nil {
+		return err
+	}
 
-		_, err = textMessageEvent.Reply(msg)
-		if err != nil {
-			trigger.Logger.Error(err.Error())
+	// batched, or paused while a human operator handles the conversation
+	if resp.FinishReason == agens.FinishReasonDelegated {
+		return nil
+	}
+
+	text := resp.Text()
+
+	// a tool call waits for approval: ask the user to reply yes or no
+	if resp.FinishReason == ai.FinishReasonInterrupted {
+		var prompts []string
+		for _, req := range agens.PendingToolApprovals(resp) {
+			prompts = append(prompts, req.Prompt()+" "+ApprovalReplyHint)
 		}
+		text = strings.Join(prompts, "\n\n")
 	}
+
+	msg, err := components.NewTextMessage(components.TextMessageConfigs{
+		Text: text,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating text message: %w", err)
+	}
+
+	_, err = event.Reply(msg)
+	return err
 }
@@ -25,22 +25,45 @@ type WebhookTrigger struct {
 	Echo    *echo.Echo
 	Logger  *slog.Logger
 	SubPath string
+
+	// Deduplicator detects the messages redelivered by the WhatsApp Cloud API,
+	// which are then ignored. If nil, every message is run.
+	Deduplicator agens.MessageDeduplicator
+
+	// PromptVars, if set, returns the variables of the system prompt template
+	// for a message (e.g. the name of the sender), attached to the context of
+	// the run with agens.WithPromptVars.
+	PromptVars func(event *events.TextMessageEvent) map[string]any
+
+	// Metrics records the OpenTelemetry metrics of the handled messages (see
+	// agens.NewTriggerMetrics). It uses the global MeterProvider by default;
+	// if nil, nothing is recorded.
+	Metrics *agens.TriggerMetrics
 }
 
 func NewWebhookTrigger(config *wapi.ClientConfig) *WebhookTrigger {
-	return &WebhookTrigger{
+	trigger := &WebhookTrigger{
 		Client:  wapi.New(config),
 		Echo:    echo.New(),
 		Logger:  slog.New(slog.NewTextHandler(os.Stdout, nil)),
 		SubPath: DefaultSubPath,
 	}
+
+	// the instruments are usable even if they could not be registered
+	var err error
+	trigger.Metrics, err = agens.NewTriggerMetrics(nil, TriggerName)
+	if err != nil {
+		trigger.Logger.Error(err.Error())
+	}
+
+	return trigger
 }
 
 func (trigger *WebhookTrigger) Name() string {
 	return TriggerName
 }
 
-func (trigger *WebhookTrigger) RegisterAgent(agent *agens.Agent) error {
+func (trigger *WebhookTrigger) RegisterAgent(agent agens.Runner) error {
 	trigger.Client.On(events.TextMessageEventType, trigger.TextHandler(agent))
 	return nil
 }
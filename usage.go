@@ -0,0 +1,192 @@
+package agens
+
+import (
+	"context"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+const RecordUsageStep = "recordUsage"
+
+// UsageErrorKey is the key used in the metadata of the response message to
+// store the error of the UsageRecorder, if it failed. Usage is recorded on a
+// best-effort basis: the tokens are already spent, so the run goes on.
+const UsageErrorKey = "usage_error"
+
+// UsageRecord describes the resources used by the generation of an agent run.
+type UsageRecord struct {
+	// AgentName is the name of the agent that ran.
+	AgentName string
+
+	// ConversationID is the identifier of the conversation of the run.
+	ConversationID string
+
+	// UserID is the ID of the user who sent the message, if known (see GetUserID).
+	UserID string
+
+	// ModelName is the name of the model that answered, if known (see GetModelName).
+	ModelName string
+
+	// InputTokens, OutputTokens and TotalTokens are the tokens reported by the model.
+	InputTokens  int
+	OutputTokens int
+	TotalTokens  int
+
+	// ToolCalls is the number of tool calls requested by the model during the run.
+	ToolCalls int
+
+	// Latency is the time the generation took, including tool calls, retries and fallbacks.
+	Latency time.Duration
+
+	// Cost is the cost of the tokens according to the PriceTable of the agent.
+	// It is zero if the model has no price.
+	Cost float64
+
+	// Time is when the generation finished.
+	Time time.Time
+}
+
+// UsageTotals are the sums of a set of usage records.
+type UsageTotals struct {
+	Runs         int
+	InputTokens  int
+	OutputTokens int
+	TotalTokens  int
+	ToolCalls    int
+	Cost         float64
+}
+
+// Add adds a record to the totals.
+func (t *UsageTotals) Add(record UsageRecord) {
+	t.Runs++
+	t.InputTokens += record.InputTokens
+	t.OutputTokens += record.OutputTokens
+	t.TotalTokens += record.TotalTokens
+	t.ToolCalls += record.ToolCalls
+	t.Cost += record.Cost
+}
+
+// DailyUsage are the usage totals of a day (in UTC).
+type DailyUsage struct {
+	Day time.Time
+	UsageTotals
+}
+
+// UserUsage are the usage totals of a user.
+type UserUsage struct {
+	UserID string
+	UsageTotals
+}
+
+// UsageFilter selects the records summed by the usage queries.
+// Empty fields match every record.
+type UsageFilter struct {
+	AgentName      string
+	ConversationID string
+	UserID         string
+
+	// From and To bound the time of the records: From is inclusive and To is exclusive.
+	From time.Time
+	To   time.Time
+}
+
+// Match reports whether the filter selects the record.
+func (f UsageFilter) Match(record UsageRecord) bool {
+	return ((f.AgentName == "") || (f.AgentName == record.AgentName)) &&
+		((f.ConversationID == "") || (f.ConversationID == record.ConversationID)) &&
+		((f.UserID == "") || (f.UserID == record.UserID)) &&
+		(f.From.IsZero() || !record.Time.Before(f.From)) &&
+		(f.To.IsZero() || record.Time.Before(f.To))
+}
+
+// UsageRecorder is the sink of the usage records of the agent runs.
+type UsageRecorder interface {
+	RecordUsage(ctx context.Context, record UsageRecord) error
+}
+
+// UsageStore is a UsageRecorder that can also sum the records it keeps.
+type UsageStore interface {
+	UsageRecorder
+
+	// UsageByDay returns the totals of the selected records per day, oldest first.
+	UsageByDay(ctx context.Context, filter UsageFilter) ([]DailyUsage, error)
+
+	// UsageByUser returns the totals of the selected records per user ID.
+	UsageByUser(ctx context.Context, filter UsageFilter) ([]UserUsage, error)
+}
+
+// ModelPrice is the price of the tokens of a model, per million tokens.
+type ModelPrice struct {
+	InputPerMillion  float64
+	OutputPerMillion float64
+}
+
+// PriceTable maps model names to their prices.
+type PriceTable map[string]ModelPrice
+
+// Cost computes the cost of the tokens used with a model. It returns zero if
+// the model is not in the table.
+func (prices PriceTable) Cost(modelName string, inputTokens int, outputTokens int) float64 {
+	price, ok := prices[modelName]
+	if !ok {
+		return 0
+	}
+	return (float64(inputTokens)*price.InputPerMillion + float64(outputTokens)*price.OutputPerMillion) / 1e6
+}
+
+// newUsageRecord builds the usage record of a generation. requestLen is the
+// number of messages given to the generation, without the system message: the
+// tool calls are counted in the messages added after them, so the calls of a
+// resumed generation are not counted again.
+func newUsageRecord(cfg *AgentConfig, state *FlowState, requestLen int, latency time.Duration) *UsageRecord {
+	resp := state.Response
+
+	record := &UsageRecord{
+		AgentName:      cfg.Name,
+		ConversationID: state.ConversationID,
+		Latency:        latency,
+		Time:           time.Now().UTC(),
+	}
+
+	record.UserID, _ = GetUserID(state.Message)
+	record.ModelName, _ = GetModelName(resp.Message)
+
+	if resp.Usage != nil {
+		record.InputTokens = resp.Usage.InputTokens
+		record.OutputTokens = resp.Usage.OutputTokens
+		record.TotalTokens = resp.Usage.TotalTokens
+	}
+
+	history := resp.History()
+	if (len(history) > 0) && (history[0].Role == ai.RoleSystem) {
+		// genkit prepends the system message to the request
+		requestLen++
+	}
+	for _, msg := range history[min(requestLen, len(history)):] {
+		if (msg == nil) || (msg.Role != ai.RoleModel) {
+			continue
+		}
+		for _, part := range msg.Content {
+			if part.IsToolRequest() {
+				record.ToolCalls++
+			}
+		}
+	}
+
+	record.Cost = cfg.PriceTable.Cost(record.ModelName, record.InputTokens, record.OutputTokens)
+	return record
+}
+
+func recordUsageStep(ctx context.Context, recorder UsageRecorder, record *UsageRecord) error {
+	if (recorder == nil) || (record == nil) {
+		return nil
+	}
+
+	_, err := genkit.Run(ctx, RecordUsageStep, func() (struct{}, error) {
+		err := recorder.RecordUsage(ctx, *record)
+		return struct{}{}, err
+	})
+	return err
+}
@@ -19,8 +19,9 @@ type WebhookTrigger interface {
 	// Name returns the name of the webhook trigger.
 	Name() string
 
-	// RegisterAgent associates an agent to handle incoming webhook data.
-	RegisterAgent(*Agent) error
+	// RegisterAgent associates an agent (or any other Runner, such as a Router)
+	// to handle incoming webhook data.
+	RegisterAgent(Runner) error
 
 	// GetRoutes returns the collection of WebhookTriggerRoute definitions 
 	// to be registered in an HTTP server.